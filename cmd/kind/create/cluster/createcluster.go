@@ -19,6 +19,7 @@ package cluster
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -37,6 +38,38 @@ type flagpole struct {
 	ImageName string
 	Retain    bool
 	Wait      time.Duration
+	// DockerAPIVersion pins the docker API version
+	DockerAPIVersion string
+	// Force deletes an existing cluster's node containers first
+	Force bool
+	// NodeDockerTimeout is how long to wait for docker on each node
+	NodeDockerTimeout time.Duration
+	// ProvisionTimeout is how long to wait for all of the node containers
+	ProvisionTimeout time.Duration
+	// InjectFailures is a hidden flag for testing error handling
+	InjectFailures []string
+	// DryRun prints the node containers instead of creating the cluster
+	DryRun bool
+	// SkipImageLoad skips loading the images stored in the node images
+	SkipImageLoad bool
+	// NamePrefix prefixes the node names instead of the cluster name
+	NamePrefix string
+	// SkipMountFixup skips remounting the node container mounts
+	SkipMountFixup bool
+	// PauseAfterMounts leaves the nodes waiting to boot into systemd
+	PauseAfterMounts bool
+	// LoadBalancerPort is the host port of the external load balancer
+	LoadBalancerPort int
+	// KeepLoadBalancer keeps the external load balancer with a single control plane
+	KeepLoadBalancer bool
+	// DedicatedNetwork creates the nodes on a docker network of their own
+	DedicatedNetwork bool
+	// Network is an existing docker network to create the nodes on
+	Network string
+	// WaitForAPIServer is how long to wait for the API server to respond
+	WaitForAPIServer time.Duration
+	// IPFamily is the IP family of the node network
+	IPFamily string
 }
 
 // NewCommand returns a new cobra.Command for cluster creation
@@ -56,6 +89,23 @@ func NewCommand() *cobra.Command {
 	cmd.Flags().StringVar(&flags.ImageName, "image", "", "node docker image to use for booting the cluster")
 	cmd.Flags().BoolVar(&flags.Retain, "retain", false, "retain nodes for debugging when cluster creation fails")
 	cmd.Flags().DurationVar(&flags.Wait, "wait", time.Duration(0), "Wait for control plane node to be ready (default 0s)")
+	cmd.Flags().DurationVar(&flags.WaitForAPIServer, "wait-for-api-server", time.Duration(0), "wait for the API server to respond once the cluster is bootstrapped (default 0s)")
+	cmd.Flags().StringVar(&flags.DockerAPIVersion, "docker-api-version", "", "docker API version to use instead of negotiating it, eg 1.39")
+	cmd.Flags().BoolVar(&flags.Force, "force", false, "delete the node containers of an existing cluster with the same name first")
+	cmd.Flags().DurationVar(&flags.NodeDockerTimeout, "node-docker-timeout", create.DefaultNodeDockerTimeout, "how long to wait for docker to be ready on each node")
+	cmd.Flags().DurationVar(&flags.ProvisionTimeout, "provision-timeout", create.DefaultProvisionTimeout, "how long to wait for all of the node containers to be provisioned")
+	cmd.Flags().BoolVar(&flags.DryRun, "dry-run", false, "print the node containers that would be created instead of creating the cluster")
+	cmd.Flags().BoolVar(&flags.SkipImageLoad, "skip-image-load", false, "skip loading the images stored in the node image into each node")
+	cmd.Flags().IntVar(&flags.LoadBalancerPort, "load-balancer-port", 0, "host port for the external load balancer, a random free port if 0")
+	cmd.Flags().BoolVar(&flags.DedicatedNetwork, "dedicated-network", false, "create the nodes on a docker network of their own, created if needed")
+	cmd.Flags().StringVar(&flags.Network, "network", "", "existing docker network to create the nodes on instead of the default bridge network")
+	cmd.Flags().StringVar(&flags.IPFamily, "ip-family", create.IPFamilyIPv4, "IP family of the node network, one of ipv4, ipv6 or dual")
+	cmd.Flags().BoolVar(&flags.KeepLoadBalancer, "keep-load-balancer", false, "create the external load balancer even with a single control plane node")
+	cmd.Flags().BoolVar(&flags.PauseAfterMounts, "pause-after-mounts", false, "leave the nodes waiting to boot into systemd after fixing their mounts, for debugging, the cluster is not bootstrapped")
+	cmd.Flags().BoolVar(&flags.SkipMountFixup, "skip-mount-fixup", false, "skip remounting the node container mounts, for hosts such as rootless docker")
+	cmd.Flags().StringVar(&flags.NamePrefix, "name-prefix", "", "prefix for the node names instead of the cluster name")
+	cmd.Flags().StringSliceVar(&flags.InjectFailures, "inject-failure", nil, "node=phase to deliberately fail, for testing only, requires KIND_INJECT_FAILURES=true")
+	cmd.Flags().MarkHidden("inject-failure")
 	return cmd
 }
 
@@ -77,13 +127,15 @@ func runE(flags *flagpole, cmd *cobra.Command, args []string) error {
 		return errors.New("aborting due to invalid configuration")
 	}
 
-	// Check if the cluster name already exists
-	known, err := cluster.IsKnown(flags.Name)
-	if err != nil {
-		return err
-	}
-	if known {
-		return errors.Errorf("a cluster with the name %q already exists", flags.Name)
+	// Check if the cluster name already exists, a dry run does not use docker
+	if !flags.DryRun {
+		known, err := cluster.IsKnown(flags.Name)
+		if err != nil {
+			return err
+		}
+		if known && !flags.Force {
+			return errors.Errorf("a cluster with the name %q already exists", flags.Name)
+		}
 	}
 
 	// create a cluster context and create the cluster
@@ -102,10 +154,39 @@ func runE(flags *flagpole, cmd *cobra.Command, args []string) error {
 			return errors.New("aborting due to invalid configuration")
 		}
 	}
-	fmt.Printf("Creating cluster %q ...\n", flags.Name)
+	injectFailures := make(map[string]string, len(flags.InjectFailures))
+	for _, failure := range flags.InjectFailures {
+		parts := strings.SplitN(failure, "=", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("invalid --inject-failure %q, expected node=phase", failure)
+		}
+		injectFailures[parts[0]] = parts[1]
+	}
+
+	if flags.DryRun {
+		fmt.Printf("Planning cluster %q (dry run) ...\n", flags.Name)
+	} else {
+		fmt.Printf("Creating cluster %q ...\n", flags.Name)
+	}
 	if err = ctx.Create(cfg,
 		create.Retain(flags.Retain),
 		create.WaitForReady(flags.Wait),
+		create.InjectFailures(injectFailures),
+		create.DockerAPIVersion(flags.DockerAPIVersion),
+		create.Force(flags.Force),
+		create.NodeDockerTimeout(flags.NodeDockerTimeout),
+		create.ProvisionTimeout(flags.ProvisionTimeout),
+		create.DryRun(flags.DryRun),
+		create.SkipImageLoad(flags.SkipImageLoad),
+		create.NamePrefix(flags.NamePrefix),
+		create.SkipMountFixup(flags.SkipMountFixup),
+		create.PauseAfterMounts(flags.PauseAfterMounts),
+		create.LoadBalancerPort(flags.LoadBalancerPort),
+		create.KeepLoadBalancer(flags.KeepLoadBalancer),
+		create.DedicatedNetwork(flags.DedicatedNetwork),
+		create.Network(flags.Network),
+		create.WaitForAPIServer(flags.WaitForAPIServer),
+		create.IPFamily(flags.IPFamily),
 	); err != nil {
 		return errors.Wrap(err, "failed to create cluster")
 	}
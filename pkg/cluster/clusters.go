@@ -17,9 +17,13 @@ limitations under the License.
 package cluster
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 
+	"sigs.k8s.io/kind/pkg/cluster/constants"
 	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/docker"
 )
 
 // List returns a list of clusters for which node containers exist
@@ -49,3 +53,23 @@ func IsKnown(name string) (bool, error) {
 	}
 	return false, nil
 }
+
+// DeleteByTestRun deletes all of the nodes and networks created with the
+// test run ID id, across all clusters, see create.TestRunID
+func DeleteByTestRun(id string) error {
+	if id == "" {
+		return errors.New("a test run ID is required")
+	}
+	label := fmt.Sprintf("label=%s=%s", constants.TestRunLabelKey, id)
+	n, err := nodes.List(label)
+	if err != nil {
+		return errors.Wrap(err, "error listing nodes")
+	}
+	if err := nodes.Delete(n...); err != nil {
+		return errors.Wrap(err, "error deleting nodes")
+	}
+	if err := docker.DeleteNetworks(label); err != nil {
+		return errors.Wrap(err, "error deleting networks")
+	}
+	return nil
+}
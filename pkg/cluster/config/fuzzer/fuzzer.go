@@ -39,6 +39,9 @@ func fuzzConfig(obj *config.Config, c fuzz.Continue) {
 		Image: "foo:bar",
 		Role:  config.ControlPlaneRole,
 	}}
+
+	// RoleDefaults are not representable in v1alpha1
+	obj.RoleDefaults = nil
 }
 
 func fuzzNode(obj *config.Node, c fuzz.Continue) {
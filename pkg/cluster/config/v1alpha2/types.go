@@ -32,6 +32,9 @@ type Config struct {
 
 	// nodes contains the list of nodes defined in the `kind` Config
 	Nodes []Node `json:"nodes"`
+
+	// RoleDefaults contains settings applied to every node with a given role
+	RoleDefaults []RoleDefaults `json:"roleDefaults,omitempty"`
 }
 
 // Node contains settings for a node in the `kind` Config.
@@ -57,7 +60,142 @@ type Node struct {
 	KubeadmConfigPatchesJSON6902 []kustomize.PatchJSON6902 `json:"kubeadmConfigPatchesJson6902,omitempty"`
 	// ExtraMounts describes additional mount points for the node container
 	// These may be used to bind a hostpath
+	// The host paths of replicated nodes may use the zero-based replica index
+	// as {{.Index}}, eg /data/{{.Index}}, to mount a distinct path per replica
+	ExtraMounts []cri.Mount `json:"extraMounts,omitempty"`
+	// MaskedPaths are paths in the node container that should be masked,
+	// like the container runtime does for unprivileged containers
+	MaskedPaths []string `json:"maskedPaths,omitempty"`
+	// ReadonlyPaths are paths in the node container that should be read only
+	ReadonlyPaths []string `json:"readonlyPaths,omitempty"`
+	// DomainName is the NIS domain name of the node container, unset by default
+	DomainName string `json:"domainName,omitempty"`
+	// Annotations are OCI annotations set on the node container with
+	// docker run --annotation, these are visible to the OCI runtime (e.g. runc)
+	// in the container config. This requires docker 24.0 or newer, on older
+	// versions the annotations are skipped with a warning.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Entrypoint overrides the node container entrypoint and its arguments.
+	// This is only intended for experimentation, nodes overriding the entrypoint
+	// will not boot like normal nodes.
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	// CapAdd are Linux capabilities to add to the node container
+	// Node containers are privileged and already have every capability, so these
+	// only take effect in combination with CapDrop
+	CapAdd []string `json:"capAdd,omitempty"`
+	// CapDrop are Linux capabilities to drop from the node container
+	CapDrop []string `json:"capDrop,omitempty"`
+	// PullConfig is the path to a docker config.json with the credentials to
+	// pull the node image, by default the host docker credentials are used
+	PullConfig string `json:"pullConfig,omitempty"`
+	// ConfigDir is a host directory of node specific configuration, mounted
+	// read only in the node at /kind/node-config
+	ConfigDir string `json:"configDir,omitempty"`
+	// SeccompProfile is the path to a seccomp JSON profile file for the node
+	// container, by default the node container is unconfined
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+	// InitScript is the path to an executable script on the host to run in the
+	// node on boot, it is mounted read only and run by a systemd oneshot unit
+	// after the local filesystems are mounted and before the kubelet starts
+	InitScript string `json:"initScript,omitempty"`
+	// Resources limits the node container resources, overriding the role
+	// defaults for the node role field by field
+	Resources *NodeResources `json:"resources,omitempty"`
+	// SystemdEnv are environment variables set for systemd in the node and, via
+	// its DefaultEnvironment, for the units it starts. They are separate from
+	// the proxy settings and other configuration kind writes during fixup.
+	// The variables in constants.ReservedNodeEnv are set by kind and may not
+	// be used
+	SystemdEnv map[string]string `json:"systemdEnv,omitempty"`
+	// ExtraPortMappings describes additional port mappings for the node container,
+	// publishing container ports on the host
+	ExtraPortMappings []cri.PortMapping `json:"extraPortMappings,omitempty"`
+	// Proxy overrides the proxy settings for the node, which by default are taken
+	// from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	Proxy *NodeProxy `json:"proxy,omitempty"`
+	// Labels are Kubernetes labels for the node, to be registered by its kubelet
+	// (as with --node-labels)
+	Labels map[string]string `json:"labels,omitempty"`
+	// Runtime is the container runtime in the node, "docker" (the default) or
+	// "containerd", which determines how kind waits for it and loads images
+	Runtime string `json:"runtime,omitempty"`
+	// ExtraEnv are environment variables set in the node container, unlike
+	// SystemdEnv they are not passed on to the units systemd starts.
+	// The variables in constants.ReservedNodeEnv and in SystemdEnv may not be used
+	ExtraEnv map[string]string `json:"extraEnv,omitempty"`
+	// GPUs requests GPUs for the node container as with docker run --gpus,
+	// e.g. "all" or "device=0", only for control-plane and worker nodes
+	GPUs string `json:"gpus,omitempty"`
+	// PostCreateExec are commands run in order in the node container once docker
+	// (or containerd) is ready in the node, before Kubernetes is set up, see
+	// PostCreateExecPhase
+	PostCreateExec [][]string `json:"postCreateExec,omitempty"`
+	// KubeletExtraArgs are extra kubelet flags for the node, by flag name without
+	// the leading dashes, e.g. "system-reserved": "cpu=500m", so that nodes of
+	// different roles may reserve different resources
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+	// Hostname is a text/template for the node container hostname, with the
+	// node .Name, .Role and .Index, its number among the nodes of its role
+	// starting at 1, e.g. "k8s-{{.Role}}-{{.Index}}". By default the hostname is
+	// the node name
+	Hostname string `json:"hostname,omitempty"`
+	// ContainerLabels are docker labels for the node container, for host side
+	// tooling e.g. docker ps --filter label=team=infra, unlike Labels they are
+	// not Kubernetes labels. The labels in constants.ReservedContainerLabels are
+	// set by kind and may not be used
+	ContainerLabels map[string]string `json:"containerLabels,omitempty"`
+	// ExtraHosts are additional "host:ip" entries for the node's /etc/hosts, as
+	// docker run --add-host, e.g. "registry.local:10.0.0.5" to reach a registry
+	// mirror on the host side
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+	// CreationPriority orders the creation of the node container when more nodes
+	// are waiting to be created than the concurrency limit allows, higher first.
+	// By default it is derived from the role, external-load-balancer 300,
+	// external-etcd 200, control-plane 100 and worker 0
+	CreationPriority *int32 `json:"creationPriority,omitempty"`
+}
+
+// RoleDefaults contains settings applied to every node with Role
+type RoleDefaults struct {
+	// Role is the role of the nodes these settings apply to
+	Role NodeRole `json:"role,omitempty"`
+	// ExtraMounts are added to every node with Role, before the node's own
+	// ExtraMounts
 	ExtraMounts []cri.Mount `json:"extraMounts,omitempty"`
+	// StopTimeout is how long nodes with Role are given to stop gracefully
+	// before they are killed, by default docker's standard timeout is used
+	StopTimeout *metav1.Duration `json:"stopTimeout,omitempty"`
+	// Resources are the default resource limits for nodes with Role
+	Resources *NodeResources `json:"resources,omitempty"`
+}
+
+// NodeResources are resource limits for a node container, unset fields are
+// not limited
+type NodeResources struct {
+	// CPUs is the number of CPUs the node may use, as a quantity (eg "1.5")
+	CPUs string `json:"cpus,omitempty"`
+	// Memory is the memory the node may use, as a quantity (eg "2Gi")
+	Memory string `json:"memory,omitempty"`
+	// MemorySwap is the memory and swap the node may use together, as a
+	// quantity (eg "4Gi"), it must not be less than Memory
+	MemorySwap string `json:"memorySwap,omitempty"`
+	// PidsLimit is the number of processes the node may run, zero is not
+	// limited
+	PidsLimit int64 `json:"pidsLimit,omitempty"`
+}
+
+// NodeProxy are the proxy settings for a node, they replace the settings
+// from the environment entirely rather than field by field
+type NodeProxy struct {
+	// Disabled configures the node without any proxy, the other fields
+	// must not be set
+	Disabled bool `json:"disabled,omitempty"`
+	// HTTPProxy is the node's HTTP_PROXY
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// HTTPSProxy is the node's HTTPS_PROXY
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy is the node's NO_PROXY
+	NoProxy string `json:"noProxy,omitempty"`
 }
 
 // NodeRole defines possible role for nodes in a Kubernetes cluster managed by `kind`
@@ -70,7 +208,7 @@ const (
 	// WorkerRole identifies a node that hosts a Kubernetes worker
 	WorkerRole NodeRole = "worker"
 	// ExternalEtcdRole identifies a node that hosts an external-etcd instance.
-	// WARNING: this node type is not yet implemented!
+	// NB. these nodes are only provisioned, they do not join the cluster
 	// Please note that `kind` nodes hosting external etcd are not kubernetes nodes
 	ExternalEtcdRole NodeRole = "external-etcd"
 	// ExternalLoadBalancerRole identifies a node that hosts an external load balancer for API server
@@ -23,6 +23,7 @@ package v1alpha2
 import (
 	unsafe "unsafe"
 
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	config "sigs.k8s.io/kind/pkg/cluster/config"
@@ -57,11 +58,42 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*NodeProxy)(nil), (*config.NodeProxy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_NodeProxy_To_config_NodeProxy(a.(*NodeProxy), b.(*config.NodeProxy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.NodeProxy)(nil), (*NodeProxy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_NodeProxy_To_v1alpha2_NodeProxy(a.(*config.NodeProxy), b.(*NodeProxy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*NodeResources)(nil), (*config.NodeResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_NodeResources_To_config_NodeResources(a.(*NodeResources), b.(*config.NodeResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.NodeResources)(nil), (*NodeResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_NodeResources_To_v1alpha2_NodeResources(a.(*config.NodeResources), b.(*NodeResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*RoleDefaults)(nil), (*config.RoleDefaults)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha2_RoleDefaults_To_config_RoleDefaults(a.(*RoleDefaults), b.(*config.RoleDefaults), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.RoleDefaults)(nil), (*RoleDefaults)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_RoleDefaults_To_v1alpha2_RoleDefaults(a.(*config.RoleDefaults), b.(*RoleDefaults), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
 func autoConvert_v1alpha2_Config_To_config_Config(in *Config, out *config.Config, s conversion.Scope) error {
 	out.Nodes = *(*[]config.Node)(unsafe.Pointer(&in.Nodes))
+	out.RoleDefaults = *(*[]config.RoleDefaults)(unsafe.Pointer(&in.RoleDefaults))
 	return nil
 }
 
@@ -72,6 +104,7 @@ func Convert_v1alpha2_Config_To_config_Config(in *Config, out *config.Config, s
 
 func autoConvert_config_Config_To_v1alpha2_Config(in *config.Config, out *Config, s conversion.Scope) error {
 	out.Nodes = *(*[]Node)(unsafe.Pointer(&in.Nodes))
+	out.RoleDefaults = *(*[]RoleDefaults)(unsafe.Pointer(&in.RoleDefaults))
 	return nil
 }
 
@@ -87,6 +120,31 @@ func autoConvert_v1alpha2_Node_To_config_Node(in *Node, out *config.Node, s conv
 	out.KubeadmConfigPatches = *(*[]string)(unsafe.Pointer(&in.KubeadmConfigPatches))
 	out.KubeadmConfigPatchesJSON6902 = *(*[]kustomize.PatchJSON6902)(unsafe.Pointer(&in.KubeadmConfigPatchesJSON6902))
 	out.ExtraMounts = *(*[]cri.Mount)(unsafe.Pointer(&in.ExtraMounts))
+	out.MaskedPaths = *(*[]string)(unsafe.Pointer(&in.MaskedPaths))
+	out.ReadonlyPaths = *(*[]string)(unsafe.Pointer(&in.ReadonlyPaths))
+	out.DomainName = in.DomainName
+	out.Annotations = *(*map[string]string)(unsafe.Pointer(&in.Annotations))
+	out.Entrypoint = *(*[]string)(unsafe.Pointer(&in.Entrypoint))
+	out.CapAdd = *(*[]string)(unsafe.Pointer(&in.CapAdd))
+	out.CapDrop = *(*[]string)(unsafe.Pointer(&in.CapDrop))
+	out.PullConfig = in.PullConfig
+	out.ConfigDir = in.ConfigDir
+	out.SeccompProfile = in.SeccompProfile
+	out.InitScript = in.InitScript
+	out.Resources = (*config.NodeResources)(unsafe.Pointer(in.Resources))
+	out.SystemdEnv = *(*map[string]string)(unsafe.Pointer(&in.SystemdEnv))
+	out.ExtraPortMappings = *(*[]cri.PortMapping)(unsafe.Pointer(&in.ExtraPortMappings))
+	out.Proxy = (*config.NodeProxy)(unsafe.Pointer(in.Proxy))
+	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
+	out.Runtime = in.Runtime
+	out.ExtraEnv = *(*map[string]string)(unsafe.Pointer(&in.ExtraEnv))
+	out.GPUs = in.GPUs
+	out.PostCreateExec = *(*[][]string)(unsafe.Pointer(&in.PostCreateExec))
+	out.KubeletExtraArgs = *(*map[string]string)(unsafe.Pointer(&in.KubeletExtraArgs))
+	out.Hostname = in.Hostname
+	out.ContainerLabels = *(*map[string]string)(unsafe.Pointer(&in.ContainerLabels))
+	out.ExtraHosts = *(*[]string)(unsafe.Pointer(&in.ExtraHosts))
+	out.CreationPriority = (*int32)(unsafe.Pointer(in.CreationPriority))
 	return nil
 }
 
@@ -102,6 +160,31 @@ func autoConvert_config_Node_To_v1alpha2_Node(in *config.Node, out *Node, s conv
 	out.KubeadmConfigPatches = *(*[]string)(unsafe.Pointer(&in.KubeadmConfigPatches))
 	out.KubeadmConfigPatchesJSON6902 = *(*[]kustomize.PatchJSON6902)(unsafe.Pointer(&in.KubeadmConfigPatchesJSON6902))
 	out.ExtraMounts = *(*[]cri.Mount)(unsafe.Pointer(&in.ExtraMounts))
+	out.MaskedPaths = *(*[]string)(unsafe.Pointer(&in.MaskedPaths))
+	out.ReadonlyPaths = *(*[]string)(unsafe.Pointer(&in.ReadonlyPaths))
+	out.DomainName = in.DomainName
+	out.Annotations = *(*map[string]string)(unsafe.Pointer(&in.Annotations))
+	out.Entrypoint = *(*[]string)(unsafe.Pointer(&in.Entrypoint))
+	out.CapAdd = *(*[]string)(unsafe.Pointer(&in.CapAdd))
+	out.CapDrop = *(*[]string)(unsafe.Pointer(&in.CapDrop))
+	out.PullConfig = in.PullConfig
+	out.ConfigDir = in.ConfigDir
+	out.SeccompProfile = in.SeccompProfile
+	out.InitScript = in.InitScript
+	out.Resources = (*NodeResources)(unsafe.Pointer(in.Resources))
+	out.SystemdEnv = *(*map[string]string)(unsafe.Pointer(&in.SystemdEnv))
+	out.ExtraPortMappings = *(*[]cri.PortMapping)(unsafe.Pointer(&in.ExtraPortMappings))
+	out.Proxy = (*NodeProxy)(unsafe.Pointer(in.Proxy))
+	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
+	out.Runtime = in.Runtime
+	out.ExtraEnv = *(*map[string]string)(unsafe.Pointer(&in.ExtraEnv))
+	out.GPUs = in.GPUs
+	out.PostCreateExec = *(*[][]string)(unsafe.Pointer(&in.PostCreateExec))
+	out.KubeletExtraArgs = *(*map[string]string)(unsafe.Pointer(&in.KubeletExtraArgs))
+	out.Hostname = in.Hostname
+	out.ContainerLabels = *(*map[string]string)(unsafe.Pointer(&in.ContainerLabels))
+	out.ExtraHosts = *(*[]string)(unsafe.Pointer(&in.ExtraHosts))
+	out.CreationPriority = (*int32)(unsafe.Pointer(in.CreationPriority))
 	return nil
 }
 
@@ -109,3 +192,81 @@ func autoConvert_config_Node_To_v1alpha2_Node(in *config.Node, out *Node, s conv
 func Convert_config_Node_To_v1alpha2_Node(in *config.Node, out *Node, s conversion.Scope) error {
 	return autoConvert_config_Node_To_v1alpha2_Node(in, out, s)
 }
+
+func autoConvert_v1alpha2_NodeProxy_To_config_NodeProxy(in *NodeProxy, out *config.NodeProxy, s conversion.Scope) error {
+	out.Disabled = in.Disabled
+	out.HTTPProxy = in.HTTPProxy
+	out.HTTPSProxy = in.HTTPSProxy
+	out.NoProxy = in.NoProxy
+	return nil
+}
+
+// Convert_v1alpha2_NodeProxy_To_config_NodeProxy is an autogenerated conversion function.
+func Convert_v1alpha2_NodeProxy_To_config_NodeProxy(in *NodeProxy, out *config.NodeProxy, s conversion.Scope) error {
+	return autoConvert_v1alpha2_NodeProxy_To_config_NodeProxy(in, out, s)
+}
+
+func autoConvert_config_NodeProxy_To_v1alpha2_NodeProxy(in *config.NodeProxy, out *NodeProxy, s conversion.Scope) error {
+	out.Disabled = in.Disabled
+	out.HTTPProxy = in.HTTPProxy
+	out.HTTPSProxy = in.HTTPSProxy
+	out.NoProxy = in.NoProxy
+	return nil
+}
+
+// Convert_config_NodeProxy_To_v1alpha2_NodeProxy is an autogenerated conversion function.
+func Convert_config_NodeProxy_To_v1alpha2_NodeProxy(in *config.NodeProxy, out *NodeProxy, s conversion.Scope) error {
+	return autoConvert_config_NodeProxy_To_v1alpha2_NodeProxy(in, out, s)
+}
+
+func autoConvert_v1alpha2_NodeResources_To_config_NodeResources(in *NodeResources, out *config.NodeResources, s conversion.Scope) error {
+	out.CPUs = in.CPUs
+	out.Memory = in.Memory
+	out.MemorySwap = in.MemorySwap
+	out.PidsLimit = in.PidsLimit
+	return nil
+}
+
+// Convert_v1alpha2_NodeResources_To_config_NodeResources is an autogenerated conversion function.
+func Convert_v1alpha2_NodeResources_To_config_NodeResources(in *NodeResources, out *config.NodeResources, s conversion.Scope) error {
+	return autoConvert_v1alpha2_NodeResources_To_config_NodeResources(in, out, s)
+}
+
+func autoConvert_config_NodeResources_To_v1alpha2_NodeResources(in *config.NodeResources, out *NodeResources, s conversion.Scope) error {
+	out.CPUs = in.CPUs
+	out.Memory = in.Memory
+	out.MemorySwap = in.MemorySwap
+	out.PidsLimit = in.PidsLimit
+	return nil
+}
+
+// Convert_config_NodeResources_To_v1alpha2_NodeResources is an autogenerated conversion function.
+func Convert_config_NodeResources_To_v1alpha2_NodeResources(in *config.NodeResources, out *NodeResources, s conversion.Scope) error {
+	return autoConvert_config_NodeResources_To_v1alpha2_NodeResources(in, out, s)
+}
+
+func autoConvert_v1alpha2_RoleDefaults_To_config_RoleDefaults(in *RoleDefaults, out *config.RoleDefaults, s conversion.Scope) error {
+	out.Role = config.NodeRole(in.Role)
+	out.ExtraMounts = *(*[]cri.Mount)(unsafe.Pointer(&in.ExtraMounts))
+	out.StopTimeout = (*v1.Duration)(unsafe.Pointer(in.StopTimeout))
+	out.Resources = (*config.NodeResources)(unsafe.Pointer(in.Resources))
+	return nil
+}
+
+// Convert_v1alpha2_RoleDefaults_To_config_RoleDefaults is an autogenerated conversion function.
+func Convert_v1alpha2_RoleDefaults_To_config_RoleDefaults(in *RoleDefaults, out *config.RoleDefaults, s conversion.Scope) error {
+	return autoConvert_v1alpha2_RoleDefaults_To_config_RoleDefaults(in, out, s)
+}
+
+func autoConvert_config_RoleDefaults_To_v1alpha2_RoleDefaults(in *config.RoleDefaults, out *RoleDefaults, s conversion.Scope) error {
+	out.Role = NodeRole(in.Role)
+	out.ExtraMounts = *(*[]cri.Mount)(unsafe.Pointer(&in.ExtraMounts))
+	out.StopTimeout = (*v1.Duration)(unsafe.Pointer(in.StopTimeout))
+	out.Resources = (*NodeResources)(unsafe.Pointer(in.Resources))
+	return nil
+}
+
+// Convert_config_RoleDefaults_To_v1alpha2_RoleDefaults is an autogenerated conversion function.
+func Convert_config_RoleDefaults_To_v1alpha2_RoleDefaults(in *config.RoleDefaults, out *RoleDefaults, s conversion.Scope) error {
+	return autoConvert_config_RoleDefaults_To_v1alpha2_RoleDefaults(in, out, s)
+}
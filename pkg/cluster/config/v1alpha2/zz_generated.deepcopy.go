@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha2
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	cri "sigs.k8s.io/kind/pkg/container/cri"
 	kustomize "sigs.k8s.io/kind/pkg/kustomize"
@@ -37,6 +38,13 @@ func (in *Config) DeepCopyInto(out *Config) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RoleDefaults != nil {
+		in, out := &in.RoleDefaults, &out.RoleDefaults
+		*out = make([]RoleDefaults, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -81,6 +89,109 @@ func (in *Node) DeepCopyInto(out *Node) {
 		*out = make([]cri.Mount, len(*in))
 		copy(*out, *in)
 	}
+	if in.MaskedPaths != nil {
+		in, out := &in.MaskedPaths, &out.MaskedPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReadonlyPaths != nil {
+		in, out := &in.ReadonlyPaths, &out.ReadonlyPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Entrypoint != nil {
+		in, out := &in.Entrypoint, &out.Entrypoint
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CapAdd != nil {
+		in, out := &in.CapAdd, &out.CapAdd
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CapDrop != nil {
+		in, out := &in.CapDrop, &out.CapDrop
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(NodeResources)
+		**out = **in
+	}
+	if in.SystemdEnv != nil {
+		in, out := &in.SystemdEnv, &out.SystemdEnv
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExtraPortMappings != nil {
+		in, out := &in.ExtraPortMappings, &out.ExtraPortMappings
+		*out = make([]cri.PortMapping, len(*in))
+		copy(*out, *in)
+	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(NodeProxy)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExtraEnv != nil {
+		in, out := &in.ExtraEnv, &out.ExtraEnv
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PostCreateExec != nil {
+		in, out := &in.PostCreateExec, &out.PostCreateExec
+		*out = make([][]string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+		}
+	}
+	if in.KubeletExtraArgs != nil {
+		in, out := &in.KubeletExtraArgs, &out.KubeletExtraArgs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ContainerLabels != nil {
+		in, out := &in.ContainerLabels, &out.ContainerLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ExtraHosts != nil {
+		in, out := &in.ExtraHosts, &out.ExtraHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CreationPriority != nil {
+		in, out := &in.CreationPriority, &out.CreationPriority
+		*out = new(int32)
+		**out = **in
+	}
 	return
 }
 
@@ -93,3 +204,66 @@ func (in *Node) DeepCopy() *Node {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeProxy) DeepCopyInto(out *NodeProxy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeProxy.
+func (in *NodeProxy) DeepCopy() *NodeProxy {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeProxy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeResources) DeepCopyInto(out *NodeResources) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeResources.
+func (in *NodeResources) DeepCopy() *NodeResources {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoleDefaults) DeepCopyInto(out *RoleDefaults) {
+	*out = *in
+	if in.ExtraMounts != nil {
+		in, out := &in.ExtraMounts, &out.ExtraMounts
+		*out = make([]cri.Mount, len(*in))
+		copy(*out, *in)
+	}
+	if in.StopTimeout != nil {
+		in, out := &in.StopTimeout, &out.StopTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(NodeResources)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoleDefaults.
+func (in *RoleDefaults) DeepCopy() *RoleDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(RoleDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
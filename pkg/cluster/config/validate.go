@@ -17,8 +17,19 @@ limitations under the License.
 package config
 
 import (
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/container/cri"
 	"sigs.k8s.io/kind/pkg/util"
 )
 
@@ -63,10 +74,70 @@ func (c *Config) Validate() error {
 		errs = append(errs, errors.Errorf("%d > 1 %s nodes requires a %s node", numControlPlane, string(ControlPlaneRole), string(ExternalLoadBalancerRole)))
 	}
 
-	// external-etcd is not actually supported yet
-	numExternalEtcd, _ := numByRole[ExternalEtcdRole]
-	if numExternalEtcd > 0 {
-		errs = append(errs, errors.Errorf("multi node support is still a work in progress, currently %s node is not supported", string(ExternalEtcdRole)))
+	// role defaults must be for a known role, at most once per role
+	seenRoles := make(map[NodeRole]bool)
+	for _, d := range c.RoleDefaults {
+		if !isValidRole(d.Role) {
+			errs = append(errs, errors.Errorf("%q is not a valid node role for role defaults", d.Role))
+		}
+		if seenRoles[d.Role] {
+			errs = append(errs, errors.Errorf("role defaults for %q are specified more than once", d.Role))
+		}
+		if d.StopTimeout != nil && d.StopTimeout.Duration < 0 {
+			errs = append(errs, errors.Errorf("stop timeout for %q must not be negative", d.Role))
+		}
+		if err := d.Resources.Validate(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid resources for %q", d.Role))
+		}
+		seenRoles[d.Role] = true
+	}
+
+	// nodes may not publish the same host port, a port published on every
+	// host IP conflicts with the same port on any other host IP
+	type hostPort struct {
+		port     int32
+		protocol cri.PortMappingProtocol
+	}
+	hostPortIPs := make(map[hostPort][]string)
+	for i, n := range c.Nodes {
+		for _, pm := range n.ExtraPortMappings {
+			if pm.HostPort == 0 {
+				continue
+			}
+			key := hostPort{port: pm.HostPort, protocol: pm.Protocol}
+			for _, ip := range hostPortIPs[key] {
+				if ip == "" || pm.HostIP == "" || ip == pm.HostIP {
+					errs = append(errs, errors.Errorf("invalid configuration for node %d: host port %d is published more than once", i, pm.HostPort))
+					break
+				}
+			}
+			hostPortIPs[key] = append(hostPortIPs[key], pm.HostIP)
+		}
+	}
+
+	// the role default mounts and node mounts must not target the same path
+	for i, n := range c.Nodes {
+		mounts := []cri.Mount{}
+		for _, d := range c.RoleDefaults {
+			if d.Role == n.Role {
+				mounts = append(mounts, d.ExtraMounts...)
+			}
+		}
+		mounts = append(mounts, n.ExtraMounts...)
+		if n.ConfigDir != "" {
+			mounts = append(mounts, cri.Mount{ContainerPath: constants.NodeConfigDirPath})
+		}
+		if n.InitScript != "" {
+			mounts = append(mounts, cri.Mount{ContainerPath: constants.NodeInitScriptPath})
+		}
+		targets := make(map[string]bool)
+		for _, m := range mounts {
+			target := filepath.Clean(m.ContainerPath)
+			if targets[target] {
+				errs = append(errs, errors.Errorf("invalid configuration for node %d: multiple extra mounts target %s", i, target))
+			}
+			targets[target] = true
+		}
 	}
 
 	if len(errs) > 0 {
@@ -81,12 +152,7 @@ func (n *Node) Validate() error {
 	errs := []error{}
 
 	// validate node role should be one of the expected values
-	switch n.Role {
-	case ControlPlaneRole,
-		WorkerRole,
-		ExternalEtcdRole,
-		ExternalLoadBalancerRole:
-	default:
+	if !isValidRole(n.Role) {
 		errs = append(errs, errors.Errorf("%q is not a valid node role", n.Role))
 	}
 
@@ -100,9 +166,295 @@ func (n *Node) Validate() error {
 		errs = append(errs, errors.New("replicas number should not be a negative number"))
 	}
 
+	// masked and read only paths must be absolute
+	for _, path := range n.MaskedPaths {
+		if !filepath.IsAbs(path) {
+			errs = append(errs, errors.Errorf("masked path %q is not absolute", path))
+		}
+	}
+	for _, path := range n.ReadonlyPaths {
+		if !filepath.IsAbs(path) {
+			errs = append(errs, errors.Errorf("read only path %q is not absolute", path))
+		}
+	}
+
+	// the domain name must be a valid DNS domain
+	if n.DomainName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(n.DomainName) {
+			errs = append(errs, errors.Errorf("invalid domain name %q: %s", n.DomainName, msg))
+		}
+	}
+
+	// an overridden entrypoint needs a command
+	if len(n.Entrypoint) > 0 && n.Entrypoint[0] == "" {
+		errs = append(errs, errors.New("entrypoint command must not be empty"))
+	}
+
+	// capabilities must be known to docker
+	for _, capability := range append(append([]string{}, n.CapAdd...), n.CapDrop...) {
+		if !isKnownCapability(capability) {
+			errs = append(errs, errors.Errorf("unknown capability %q", capability))
+		}
+	}
+
+	for i, command := range n.PostCreateExec {
+		if len(command) == 0 || command[0] == "" {
+			errs = append(errs, errors.Errorf("post create command %d must not be empty", i))
+		}
+	}
+
+	// GPUs are only for the nodes running workloads
+	if n.GPUs != "" && n.Role != ControlPlaneRole && n.Role != WorkerRole {
+		errs = append(errs, errors.Errorf("GPUs are not supported on %s nodes", n.Role))
+	}
+
+	if err := n.Resources.Validate(); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid resources"))
+	}
+
+	// mount host paths may be templated with the replica index
+	for _, mount := range n.ExtraMounts {
+		if strings.Contains(mount.HostPath, "{{") {
+			if _, err := template.New("hostPath").Parse(mount.HostPath); err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid mount host path template %q", mount.HostPath))
+			}
+		}
+	}
+
+	// annotation keys follow the same rules as Kubernetes annotation keys
+	for key := range n.Annotations {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, errors.Errorf("invalid annotation key %q: %s", key, msg))
+		}
+	}
+
+	for _, pm := range n.ExtraPortMappings {
+		if err := validatePortMapping(pm); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name, value := range n.SystemdEnv {
+		if err := validateSystemdEnv(name, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name := range n.ExtraEnv {
+		if err := validateExtraEnv(name); err != nil {
+			errs = append(errs, err)
+		}
+		if _, ok := n.SystemdEnv[name]; ok {
+			errs = append(errs, errors.Errorf("environment variable %q is set in both systemdEnv and extraEnv", name))
+		}
+	}
+
+	for name := range n.KubeletExtraArgs {
+		if !kubeletFlagRegexp.MatchString(name) {
+			errs = append(errs, errors.Errorf(
+				"kubelet extra arg %q is not a flag name, flags are named without the leading dashes e.g. system-reserved", name,
+			))
+		}
+	}
+
+	switch n.Runtime {
+	case "", constants.DockerNodeRuntimeValue, constants.ContainerdNodeRuntimeValue:
+	default:
+		errs = append(errs, errors.Errorf("%q is not a known node runtime", n.Runtime))
+	}
+
+	// labels follow the Kubernetes label syntax
+	for key, value := range n.Labels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, errors.Errorf("invalid label key %q: %s", key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			errs = append(errs, errors.Errorf("invalid label value %q for key %q: %s", value, key, msg))
+		}
+	}
+
+	for key := range n.ContainerLabels {
+		if err := validateContainerLabel(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, host := range n.ExtraHosts {
+		if err := validateExtraHost(host); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := n.Proxy.Validate(); err != nil {
+		errs = append(errs, errors.Wrap(err, "invalid proxy"))
+	}
+
 	if len(errs) > 0 {
 		return util.NewErrors(errs)
 	}
 
 	return nil
 }
+
+// validatePortMapping returns an error if the ports are out of range, the
+// host IP is not an IP address or the protocol is unknown
+func validatePortMapping(pm cri.PortMapping) error {
+	if pm.ContainerPort < 1 || pm.ContainerPort > 65535 {
+		return errors.Errorf("invalid container port %d, must be between 1 and 65535", pm.ContainerPort)
+	}
+	if pm.HostPort < 0 || pm.HostPort > 65535 {
+		return errors.Errorf("invalid host port %d, must be between 0 (random) and 65535", pm.HostPort)
+	}
+	if pm.HostIP != "" && net.ParseIP(pm.HostIP) == nil {
+		return errors.Errorf("invalid host IP %q", pm.HostIP)
+	}
+	if _, ok := cri.PortMappingProtocolValueToName[pm.Protocol]; !ok {
+		return errors.Errorf("unknown protocol value %d for container port %d", pm.Protocol, pm.ContainerPort)
+	}
+	return nil
+}
+
+// envNameRegexp matches the environment variable names accepted in SystemdEnv
+// and ExtraEnv
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// kubeletFlagRegexp matches the kubelet flag names accepted in
+// KubeletExtraArgs, without the leading dashes
+var kubeletFlagRegexp = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// validateSystemdEnv returns an error if name is not a valid, unreserved
+// environment variable name or value is not a single line
+func validateSystemdEnv(name, value string) error {
+	if !envNameRegexp.MatchString(name) {
+		return errors.Errorf("invalid systemd environment variable name %q", name)
+	}
+	for _, reserved := range constants.ReservedNodeEnv {
+		if name == reserved {
+			return errors.Errorf("systemd environment variable %q is reserved by kind", name)
+		}
+	}
+	if strings.ContainsAny(value, "\n\r") {
+		return errors.Errorf("systemd environment variable %q must be a single line", name)
+	}
+	return nil
+}
+
+// validateExtraEnv returns an error if name is not a valid, unreserved
+// environment variable name
+func validateExtraEnv(name string) error {
+	if !envNameRegexp.MatchString(name) {
+		return errors.Errorf("invalid extra environment variable name %q", name)
+	}
+	for _, reserved := range constants.ReservedNodeEnv {
+		if name == reserved {
+			return errors.Errorf("extra environment variable %q is reserved by kind", name)
+		}
+	}
+	return nil
+}
+
+// validateContainerLabel returns an error if key is not a valid, unreserved
+// docker label key
+func validateContainerLabel(key string) error {
+	if key == "" || strings.ContainsAny(key, "= \t\n") {
+		return errors.Errorf("invalid container label key %q", key)
+	}
+	for _, reserved := range constants.ReservedContainerLabels {
+		if key == reserved {
+			return errors.Errorf("container label %q is reserved by kind", key)
+		}
+	}
+	return nil
+}
+
+// validateExtraHost returns an error if host is not a "host:ip" entry, the
+// host is split at the first colon as IPv6 addresses contain colons
+func validateExtraHost(host string) error {
+	parts := strings.SplitN(host, ":", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("invalid extra host %q, must be host:ip", host)
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(parts[0]) {
+		return errors.Errorf("invalid extra host %q: %s", host, msg)
+	}
+	if net.ParseIP(parts[1]) == nil {
+		return errors.Errorf("invalid extra host %q: %q is not an IP address", host, parts[1])
+	}
+	return nil
+}
+
+// isValidRole returns true if role is one of the known node roles
+func isValidRole(role NodeRole) bool {
+	switch role {
+	case ControlPlaneRole,
+		WorkerRole,
+		ExternalEtcdRole,
+		ExternalLoadBalancerRole:
+		return true
+	}
+	return false
+}
+
+// Validate returns an error if the proxy is disabled but has settings, or
+// the settings are not valid, nil proxy settings are valid
+func (p *NodeProxy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Disabled && (p.HTTPProxy != "" || p.HTTPSProxy != "" || p.NoProxy != "") {
+		return errors.New("a disabled proxy must not have settings")
+	}
+	for name, value := range map[string]string{
+		"httpProxy":  p.HTTPProxy,
+		"httpsProxy": p.HTTPSProxy,
+		"noProxy":    p.NoProxy,
+	} {
+		// the settings are written quoted to a systemd drop-in
+		if strings.ContainsAny(value, "\"\n\r") {
+			return errors.Errorf("%s must be a single line without quotes", name)
+		}
+	}
+	// like net/http, accept proxies without a scheme
+	for name, value := range map[string]string{"httpProxy": p.HTTPProxy, "httpsProxy": p.HTTPSProxy} {
+		if value == "" {
+			continue
+		}
+		if _, err := url.Parse(value); err != nil {
+			if _, err := url.Parse("http://" + value); err != nil {
+				return errors.Wrapf(err, "invalid %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the resource limits are not positive
+// quantities or if the memory with swap is less than the memory, nil
+// resources are valid
+func (r *NodeResources) Validate() error {
+	if r == nil {
+		return nil
+	}
+	for name, value := range map[string]string{"cpus": r.CPUs, "memory": r.Memory, "memorySwap": r.MemorySwap} {
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s %q", name, value)
+		}
+		if quantity.Sign() <= 0 {
+			return errors.Errorf("%s must be positive, got %q", name, value)
+		}
+	}
+	if r.PidsLimit < 0 {
+		return errors.Errorf("pidsLimit must not be negative, got %d", r.PidsLimit)
+	}
+	if r.Memory != "" && r.MemorySwap != "" {
+		memory, swap := resource.MustParse(r.Memory), resource.MustParse(r.MemorySwap)
+		if swap.Cmp(memory) < 0 {
+			return errors.Errorf("memorySwap %q must not be less than memory %q", r.MemorySwap, r.Memory)
+		}
+	}
+	return nil
+}
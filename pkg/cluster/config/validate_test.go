@@ -19,6 +19,7 @@ package config
 import (
 	"testing"
 
+	"sigs.k8s.io/kind/pkg/container/cri"
 	"sigs.k8s.io/kind/pkg/util"
 )
 
@@ -69,6 +70,289 @@ func TestNodeValidate(t *testing.T) {
 			}(),
 			ExpectErrors: 1,
 		},
+		{
+			TestName: "Resource limits",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{CPUs: "1.5", Memory: "2Gi"}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Port mappings",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.ExtraPortMappings = []cri.PortMapping{
+					{ContainerPort: 80, HostPort: 8080, HostIP: "127.0.0.1"},
+					{ContainerPort: 53, Protocol: cri.PortMappingProtocolUDP},
+				}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Invalid port mappings",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.ExtraPortMappings = []cri.PortMapping{
+					{ContainerPort: 0},
+					{ContainerPort: 80, HostPort: 70000},
+					{ContainerPort: 80, HostIP: "localhost"},
+				}
+				return cfg
+			}(),
+			ExpectErrors: 3,
+		},
+		{
+			TestName: "Zero CPUs",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{CPUs: "0"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Negative memory",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{Memory: "-1Gi"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Invalid memory",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{Memory: "lots"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Memory swap and pids limit",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{Memory: "2Gi", MemorySwap: "2Gi", PidsLimit: 4096}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Memory swap less than memory",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{Memory: "2Gi", MemorySwap: "1Gi"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Negative pids limit",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Resources = &NodeResources{PidsLimit: -1}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Node proxy",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Proxy = &NodeProxy{HTTPProxy: "proxy.example.com:3128", NoProxy: "localhost,10.0.0.0/8"}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Disabled proxy with settings",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Proxy = &NodeProxy{Disabled: true, HTTPProxy: "http://proxy.example.com:3128"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Templated mount host path",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ExtraMounts = []cri.Mount{{HostPath: "/data/{{.Index}}", ContainerPath: "/data"}}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Invalid mount host path template",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ExtraMounts = []cri.Mount{{HostPath: "/data/{{.Index", ContainerPath: "/data"}}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Containerd runtime",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.Runtime = "containerd"
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Unknown runtime",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.Runtime = "rkt"
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Node labels",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.Labels = map[string]string{"example.com/pool": "gpu", "zone": ""}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Invalid label key",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.Labels = map[string]string{"not a key": "gpu"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Invalid label value",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.Labels = map[string]string{"pool": "not a value"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Quoted proxy",
+			Node: func() Node {
+				cfg := newDefaultedNode(ControlPlaneRole)
+				cfg.Proxy = &NodeProxy{NoProxy: `"localhost"`}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Worker GPUs",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.GPUs = "all"
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Load balancer GPUs",
+			Node: func() Node {
+				cfg := newDefaultedNode(ExternalLoadBalancerRole)
+				cfg.GPUs = "device=0"
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Extra env",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ExtraEnv = map[string]string{"FEATURE_FOO": "true", "_bar": ""}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Invalid and reserved extra env",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ExtraEnv = map[string]string{"1FOO": "true", "HTTP_PROXY": "http://proxy:3128"}
+				return cfg
+			}(),
+			ExpectErrors: 2,
+		},
+		{
+			TestName: "Extra env also in systemd env",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.SystemdEnv = map[string]string{"FOO": "systemd"}
+				cfg.ExtraEnv = map[string]string{"FOO": "extra"}
+				return cfg
+			}(),
+			ExpectErrors: 1,
+		},
+		{
+			TestName: "Container labels",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ContainerLabels = map[string]string{"team": "infra", "com.example/owner": ""}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Invalid and reserved container labels",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ContainerLabels = map[string]string{
+					"":                         "empty",
+					"a=b":                      "",
+					"io.k8s.sigs.kind.cluster": "other",
+					"io.k8s.sigs.kind.role":    "worker",
+				}
+				return cfg
+			}(),
+			ExpectErrors: 4,
+		},
+		{
+			TestName: "Extra hosts",
+			Node: func() Node {
+				cfg := newDefaultedNode(ExternalLoadBalancerRole)
+				cfg.ExtraHosts = []string{"registry.local:10.0.0.5", "mirror:fd00::5"}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Malformed extra hosts",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.ExtraHosts = []string{"registry.local", "registry.local:not-an-ip", ":10.0.0.5", "Registry_Local:10.0.0.5"}
+				return cfg
+			}(),
+			ExpectErrors: 4,
+		},
+		{
+			TestName: "Kubelet extra args",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.KubeletExtraArgs = map[string]string{"system-reserved": "cpu=500m", "v": "4"}
+				return cfg
+			}(),
+			ExpectErrors: 0,
+		},
+		{
+			TestName: "Invalid kubelet extra args",
+			Node: func() Node {
+				cfg := newDefaultedNode(WorkerRole)
+				cfg.KubeletExtraArgs = map[string]string{"--system-reserved": "cpu=500m", "System_Reserved": "", "": ""}
+				return cfg
+			}(),
+			ExpectErrors: 3,
+		},
 	}
 
 	for _, tc := range cases {
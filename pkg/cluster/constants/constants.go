@@ -27,6 +27,31 @@ const ClusterLabelKey = "io.k8s.sigs.kind.cluster"
 // of nodes by role
 const NodeRoleKey = "io.k8s.sigs.kind.role"
 
+// NodeInitScriptPath is where a node's InitScript is mounted in the node
+const NodeInitScriptPath = "/kind/init-script"
+
+// TestRunLabelKey is applied to each "node" docker container and network
+// created for a test run, see DeleteByTestRun
+const TestRunLabelKey = "io.k8s.sigs.kind.test-run"
+
+// GenerationLabelKey is applied to each "node" docker container with the ID
+// of the create invocation that provisioned it, to tell the containers of
+// different attempts to create a cluster apart
+const GenerationLabelKey = "io.k8s.sigs.kind.generation"
+
+// NodeConfigDirPath is where a node's ConfigDir is mounted in the node
+const NodeConfigDirPath = "/kind/node-config"
+
+// ReservedNodeEnv are the node environment variables kind sets itself, they
+// may not be set with a node's SystemdEnv or ExtraEnv. systemd checks "container" to
+// detect that it runs in a container, and the proxy variables are passed
+// from the host
+var ReservedNodeEnv = []string{"container", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// ReservedContainerLabels are the node container labels kind sets itself,
+// they may not be set with a node's ContainerLabels
+var ReservedContainerLabels = []string{ClusterLabelKey, NodeRoleKey, TestRunLabelKey, GenerationLabelKey}
+
 /* node role value constants */
 const (
 	// ControlPlaneNodeRoleValue identifies a node that hosts a Kubernetes
@@ -48,9 +73,21 @@ const (
 	// ExternalEtcdNodeRoleValue identifies a node that hosts an external-etcd
 	// instance.
 	//
-	// WARNING: this node type is not yet implemented!
+	// NOTE: these nodes are only provisioned, they do not join the cluster
+	// and the control plane nodes still run their own etcd
 	//
 	// Please note that `kind` nodes hosting external etcd are not
 	// kubernetes nodes
 	ExternalEtcdNodeRoleValue string = "external-etcd"
 )
+
+/* node container runtime value constants, see config.Node.Runtime */
+const (
+	// DockerNodeRuntimeValue is the default node container runtime, nodes
+	// run their containers with docker
+	DockerNodeRuntimeValue string = "docker"
+
+	// ContainerdNodeRuntimeValue identifies nodes that run their containers
+	// with containerd directly, images are imported with ctr
+	ContainerdNodeRuntimeValue string = "containerd"
+)
@@ -79,6 +79,18 @@ func (c *Context) Create(cfg *config.Config, options ...create.ClusterOption) er
 	return internalcreate.Cluster(c.ic, cfg, opts)
 }
 
+// AddWorkers creates count additional worker node containers from image in
+// the existing cluster, without touching the existing nodes.
+// The new nodes are not joined to the cluster.
+func (c *Context) AddWorkers(image string, count int, options ...create.ClusterOption) ([]nodes.Node, error) {
+	// apply create options
+	opts := &internalcreate.Options{}
+	for _, option := range options {
+		opts = option(opts)
+	}
+	return internalcreate.Workers(c.ic, image, count, opts)
+}
+
 // Delete tears down a kubernetes-in-docker cluster
 func (c *Context) Delete() error {
 	return internaldelete.Cluster(c.ic)
@@ -17,8 +17,10 @@ limitations under the License.
 package create
 
 import (
+	"context"
 	"time"
 
+	"sigs.k8s.io/kind/pkg/cluster/config"
 	internalcreate "sigs.k8s.io/kind/pkg/cluster/internal/create"
 )
 
@@ -40,3 +42,613 @@ func WaitForReady(interval time.Duration) ClusterOption {
 		return o
 	}
 }
+
+// AdoptNodes configures create to adopt pre-existing node containers instead
+// of creating new ones, adopt maps node roles to container names.
+// The containers must have been created with the node image, role, and cluster
+// labels that create would use, and must not have been signaled to boot yet.
+func AdoptNodes(adopt map[string][]string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.AdoptNodes = adopt
+		return o
+	}
+}
+
+/* node fixup phases, see FixupPhases */
+const (
+	FixMountsPhase     = internalcreate.FixMountsPhase
+	SetProxyPhase      = internalcreate.SetProxyPhase
+	SignalStartPhase   = internalcreate.SignalStartPhase
+	WaitForDockerPhase = internalcreate.WaitForDockerPhase
+	LoadImagesPhase    = internalcreate.LoadImagesPhase
+	// PostCreateExecPhase runs each node's PostCreateExec commands
+	PostCreateExecPhase = internalcreate.PostCreateExecPhase
+)
+
+// FixupPhases configures create to run the node fixup phases in the given
+// order instead of the default order. Every phase must be specified once,
+// and WaitForDocker must run before LoadImages and PostCreateExec, FixMounts
+// before SignalStart and SignalStart before WaitForDocker.
+func FixupPhases(phases ...string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.FixupPhases = phases
+		return o
+	}
+}
+
+// VerifyMounts configures create to check that each node's extra mounts are
+// actually mounted (and read only where requested) once the node has booted
+func VerifyMounts(verify bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.VerifyMounts = verify
+		return o
+	}
+}
+
+/* node name collision strategies, see NameCollision */
+const (
+	NameCollisionFail   = internalcreate.NameCollisionFail
+	NameCollisionAdopt  = internalcreate.NameCollisionAdopt
+	NameCollisionSuffix = internalcreate.NameCollisionSuffix
+)
+
+// NameCollision configures how create handles node names that are already
+// in use by an existing container: fail (the default), adopt the existing
+// container, or suffix the node name to make it unique
+func NameCollision(strategy string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.NameCollision = strategy
+		return o
+	}
+}
+
+// EstimateDownloads configures create to report the estimated download size
+// of the node images that are not present locally before pulling them
+func EstimateDownloads(estimate bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.EstimateDownloads = estimate
+		return o
+	}
+}
+
+// CreatePhase is the node container creation phase, see InjectFailures
+const CreatePhase = internalcreate.CreatePhase
+
+// InjectFailuresEnv must be set to "true" on the host to use InjectFailures
+const InjectFailuresEnv = internalcreate.InjectFailuresEnv
+
+// InjectFailures configures create to deliberately fail nodes at a phase,
+// failures maps node names to CreatePhase or one of the fixup phases.
+// This is only intended for testing error handling in kind and its callers,
+// and creating the cluster fails unless InjectFailuresEnv is set to "true".
+func InjectFailures(failures map[string]string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.InjectFailures = failures
+		return o
+	}
+}
+
+// EnvLabels configures create to label every node container with the values
+// of the named environment variables, keyed by variable name.
+// Variables that are not set are skipped.
+func EnvLabels(names ...string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.EnvLabels = names
+		return o
+	}
+}
+
+// IgnoreProxyDetectionErrors configures create to warn instead of failing
+// when the host proxy settings cannot be detected, no proxy is configured on
+// the nodes in that case. Errors applying a detected proxy are still fatal.
+func IgnoreProxyDetectionErrors(ignore bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.IgnoreProxyDetectionErrors = ignore
+		return o
+	}
+}
+
+// DockerAPIVersion configures create to use a fixed docker API version
+// instead of negotiating it with the docker daemon, eg "1.39"
+func DockerAPIVersion(version string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.DockerAPIVersion = version
+		return o
+	}
+}
+
+// HostGateway configures create to make the host reachable from every node
+// as alias, or as host.docker.internal if alias is empty.
+// This requires docker 20.10 or newer.
+func HostGateway(alias string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.HostGateway = true
+		o.HostGatewayAlias = alias
+		return o
+	}
+}
+
+// MinReadyNodes configures create to proceed once n nodes have been
+// provisioned, skipping failed workers. Nodes other than workers are always
+// required. If abandonStragglers is set, create will not wait on the remaining
+// nodes once n nodes are ready.
+func MinReadyNodes(n int, abandonStragglers bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.MinReadyNodes = n
+		o.AbandonStragglers = abandonStragglers
+		return o
+	}
+}
+
+// MaxWorkerFailures configures create to proceed without up to n worker
+// nodes that fail to be provisioned, which are removed. A failure of any
+// other node, or of more workers, still fails create.
+func MaxWorkerFailures(n int) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.MaxWorkerFailures = n
+		return o
+	}
+}
+
+// SkipBootPhases configures create to skip the fixup phases that depend on
+// the default node entrypoint for nodes overriding the entrypoint, this must
+// be set to create such nodes.
+func SkipBootPhases(skip bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.SkipBootPhases = skip
+		return o
+	}
+}
+
+// PreplaceJoinToken configures create to generate a kubeadm join token for the
+// cluster instead of using a well known one, and to write it to the worker
+// nodes while provisioning them, ahead of joining them.
+func PreplaceJoinToken(preplace bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.PreplaceJoinToken = preplace
+		return o
+	}
+}
+
+// ProvisionedRoleEnv is set for the BetweenRolesCommand to the role of the
+// nodes that were just provisioned
+const ProvisionedRoleEnv = internalcreate.ProvisionedRoleEnv
+
+// BetweenRolesCommand configures create to provision the nodes one role at
+// a time, running command on the host after each role but the last.
+// The role just provisioned is set in the environment as ProvisionedRoleEnv.
+// Creation fails if the command fails.
+func BetweenRolesCommand(command ...string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.BetweenRolesCommand = command
+		return o
+	}
+}
+
+/* provisioning result statuses, see ResultsFile */
+const (
+	ProvisioningSucceeded = internalcreate.ProvisioningSucceeded
+	ProvisioningFailed    = internalcreate.ProvisioningFailed
+)
+
+// ResultsFile configures create to atomically write the node provisioning
+// results to path as JSON, including whether provisioning succeeded.
+func ResultsFile(path string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.ResultsFile = path
+		return o
+	}
+}
+
+// OnAPIServerEndpoint configures create to call notify with the host:port at
+// which the API server will be reachable as soon as the node serving it is
+// created, so that it can be polled before the cluster is ready.
+// notify may be called concurrently with provisioning the other nodes.
+func OnAPIServerEndpoint(notify func(endpoint string)) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.OnAPIServerEndpoint = notify
+		return o
+	}
+}
+
+/* CPU governor check modes, see CPUGovernorCheck */
+const (
+	CPUGovernorCheckOff   = internalcreate.CPUGovernorCheckOff
+	CPUGovernorCheckWarn  = internalcreate.CPUGovernorCheckWarn
+	CPUGovernorCheckError = internalcreate.CPUGovernorCheckError
+)
+
+// CPUGovernorCheck configures create to check that the host CPUs use the
+// performance governor before provisioning the nodes, warning or failing
+// depending on mode. This is useful for reproducible benchmarks.
+func CPUGovernorCheck(mode string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.CPUGovernorCheck = mode
+		return o
+	}
+}
+
+// PlannedNode is a node container to be provisioned, see PlanNodes and
+// MutateNode
+type PlannedNode = internalcreate.PlannedNode
+
+// PlanNodes returns the node containers that would be provisioned for cfg,
+// the plan can be saved with WritePlanFile and provisioned with PlanFile.
+// cfg is not modified.
+func PlanNodes(cfg *config.Config, clusterName string) ([]PlannedNode, error) {
+	return internalcreate.PlanNodes(cfg, clusterName)
+}
+
+// PlanNodeNames returns the names of the node containers that would be
+// created for cfg, in provisioning order, e.g. to set up DNS or config files
+// before the cluster exists. cfg is not modified.
+func PlanNodeNames(cfg *config.Config, clusterName string) ([]string, error) {
+	return internalcreate.PlanNodeNames(cfg, clusterName)
+}
+
+// WritePlanFile writes a node plan to path, as a JSON NodePlan which is
+// validated again when it is read with PlanFile
+func WritePlanFile(path string, plan []PlannedNode) error {
+	return internalcreate.WritePlanFile(path, plan)
+}
+
+// PlanFile configures create to provision the node containers exactly as
+// planned in the plan file at path instead of from the config nodes.
+// The plan is validated before provisioning.
+func PlanFile(path string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.PlanFile = path
+		return o
+	}
+}
+
+// Force configures create to delete any existing node containers of the
+// cluster, such as those left over from a failed create, before provisioning.
+// This cannot be combined with adopting nodes.
+func Force(force bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.Force = force
+		return o
+	}
+}
+
+// WaitForNetwork configures create to wait up to timeout after fixing up
+// each node for it to have a routable IP on its primary interface
+func WaitForNetwork(timeout time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.WaitForNetwork = timeout
+		return o
+	}
+}
+
+// MaxNodesEnv may be set on the host to limit the number of nodes any
+// cluster may have, see MaxNodes
+const MaxNodesEnv = internalcreate.MaxNodesEnv
+
+// MaxNodes configures create to fail if the cluster would have more than max
+// nodes, the host may further limit this with MaxNodesEnv
+func MaxNodes(max int) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.MaxNodes = max
+		return o
+	}
+}
+
+// MacvlanNetwork configures a macvlan network for the nodes, see Macvlan
+type MacvlanNetwork = internalcreate.MacvlanNetwork
+
+// Macvlan configures create to attach the nodes to a macvlan network on the
+// host interface network.Parent, in addition to the default docker network.
+// The network is created for the cluster and deleted with it. Node IPs are
+// allocated by docker from network.Subnet rather than by DHCP.
+func Macvlan(network MacvlanNetwork) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.Macvlan = &network
+		return o
+	}
+}
+
+/* provisioning phases with independent log levels, see LogLevels */
+const (
+	PlanLogPhase      = internalcreate.PlanLogPhase
+	CreateLogPhase    = internalcreate.CreateLogPhase
+	FixupLogPhase     = internalcreate.FixupLogPhase
+	ImageLoadLogPhase = internalcreate.ImageLoadLogPhase
+)
+
+// LogLevels configures create to log the messages of each provisioning
+// phase at the given logrus level (eg "debug"), independently of the others.
+// Phases not in levels log at the standard logger's level.
+func LogLevels(levels map[string]string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.LogLevels = levels
+		return o
+	}
+}
+
+// TestRunID configures create to label the nodes and networks it creates
+// with the test run ID id, so that they can be deleted with
+// cluster.DeleteByTestRun even if cluster names collide
+func TestRunID(id string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.TestRunID = id
+		return o
+	}
+}
+
+// ImageLoadBatchSize configures create to load images on at most n nodes at
+// once, to avoid saturating slow storage. By default all nodes load at once.
+func ImageLoadBatchSize(n int) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.ImageLoadBatchSize = n
+		return o
+	}
+}
+
+/* image load retry defaults, see ImageLoadRetries */
+const (
+	DefaultImageLoadAttempts = internalcreate.DefaultImageLoadAttempts
+	DefaultImageLoadBackoff  = internalcreate.DefaultImageLoadBackoff
+)
+
+// ImageLoadRetries configures create to attempt loading the images on each
+// node up to attempts times, waiting backoff before the first retry and
+// doubling it after each one. Images that still fail to load fail the node.
+// By default loading is attempted DefaultImageLoadAttempts times, starting
+// with a DefaultImageLoadBackoff wait.
+func ImageLoadRetries(attempts int, backoff time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.ImageLoadAttempts = attempts
+		o.ImageLoadBackoff = backoff
+		return o
+	}
+}
+
+// HostsFile configures create to atomically write the node names and their
+// container IPs to path in /etc/hosts format once the nodes are ready
+func HostsFile(path string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.HostsFile = path
+		return o
+	}
+}
+
+// DefaultMaxConcurrency is how many node containers are created at once by
+// default, see MaxConcurrency
+const DefaultMaxConcurrency = internalcreate.DefaultMaxConcurrency
+
+// MaxConcurrency configures create to create at most n node containers at
+// once, to avoid overloading the docker daemon
+func MaxConcurrency(n int) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.MaxConcurrency = n
+		return o
+	}
+}
+
+// DefaultNodeDockerTimeout is how long to wait for docker to be ready on each
+// node by default, see NodeDockerTimeout
+const DefaultNodeDockerTimeout = internalcreate.DefaultNodeDockerTimeout
+
+// DefaultNodeDockerPollInterval is how often to check whether docker is
+// ready on each node by default, see NodeDockerPollInterval
+const DefaultNodeDockerPollInterval = internalcreate.DefaultNodeDockerPollInterval
+
+// NodeDockerPollInterval configures how often create checks whether docker
+// is ready on each node, a longer interval puts less load on constrained
+// hosts, zero uses DefaultNodeDockerPollInterval
+func NodeDockerPollInterval(interval time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.NodeDockerPollInterval = interval
+		return o
+	}
+}
+
+// NodeDockerTimeout configures how long create waits for docker to be ready
+// on each node, for slow hosts
+func NodeDockerTimeout(timeout time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.NodeDockerTimeout = timeout
+		return o
+	}
+}
+
+/* node provisioning retry defaults, see CreateRetries */
+const (
+	DefaultCreateAttempts = internalcreate.DefaultCreateAttempts
+	DefaultCreateBackoff  = internalcreate.DefaultCreateBackoff
+)
+
+// CreateRetries configures create to attempt creating and fixing up each
+// node up to attempts times, waiting backoff before the first retry and
+// doubling it after each one. The failed node container is deleted before
+// each retry. By default provisioning is attempted DefaultCreateAttempts
+// times, starting with a DefaultCreateBackoff wait.
+func CreateRetries(attempts int, backoff time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.CreateAttempts = attempts
+		o.CreateBackoff = backoff
+		return o
+	}
+}
+
+// RoleOrder configures the order in which nodes are provisioned by role for
+// this cluster instead of the default order: the external load balancer,
+// external etcd, control plane and then worker nodes. Roles not in roleOrder
+// are provisioned last, unknown roles are an error.
+func RoleOrder(roleOrder ...string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.RoleOrder = roleOrder
+		return o
+	}
+}
+
+// Context configures create to stop provisioning the nodes when ctx is done,
+// deleting the nodes created so far unless Retain is set
+func Context(ctx context.Context) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.Context = ctx
+		return o
+	}
+}
+
+// OnNodePhase configures create to call notify with the node name and phase
+// as each node enters CreatePhase and then each of the fixup phases, to report
+// progress per node. notify may be called concurrently for different nodes.
+func OnNodePhase(notify func(nodeName, phase string)) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.OnNodePhase = notify
+		return o
+	}
+}
+
+// DryRun configures create to print the node containers that would be
+// provisioned instead of creating the cluster, without using docker
+func DryRun(dryRun bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.DryRun = dryRun
+		return o
+	}
+}
+
+// SkipImageLoad configures create to skip loading the images stored in the
+// node images into each node, which speeds up provisioning when the nodes do
+// not need them, see LoadImagesPhase
+func SkipImageLoad(skip bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.SkipImageLoad = skip
+		return o
+	}
+}
+
+// NamePrefix configures create to name the nodes <prefix>-<role> instead of
+// <cluster name>-<role>, e.g. to keep the node names short for long cluster
+// names. The nodes are still labeled with the cluster name.
+func NamePrefix(prefix string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.NamePrefix = prefix
+		return o
+	}
+}
+
+// DefaultProvisionTimeout is how long to wait for all of the node containers
+// to be provisioned by default
+const DefaultProvisionTimeout = internalcreate.DefaultProvisionTimeout
+
+// ProvisionTimeout configures how long create waits for all of the node
+// containers to be provisioned before failing with the outstanding nodes,
+// zero uses DefaultProvisionTimeout
+func ProvisionTimeout(timeout time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.ProvisionTimeout = timeout
+		return o
+	}
+}
+
+// SkipMountFixup configures create to skip remounting the node container
+// mounts, which requires privileges that hosts such as rootless docker do not
+// grant and that they do not need, see FixMountsPhase
+func SkipMountFixup(skip bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.SkipMountFixup = skip
+		return o
+	}
+}
+
+// RoleImages configures create to use images by node role, e.g. one for the
+// control plane nodes and another for the workers, as the image of the nodes
+// configured without an image, instead of the default node image
+func RoleImages(images map[string]string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.RoleImages = images
+		return o
+	}
+}
+
+// LoadBalancerPort configures create to publish the external load balancer
+// of HA clusters on port of the host, instead of a random free port. Creating
+// a cluster without an external load balancer node fails, see
+// KeepLoadBalancer.
+func LoadBalancerPort(port int) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.LoadBalancerPort = port
+		return o
+	}
+}
+
+// KeepLoadBalancer configures create to create the external load balancer
+// node even for clusters with a single control plane node, where it is not
+// created by default as there is nothing to balance
+func KeepLoadBalancer(keep bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.KeepLoadBalancer = keep
+		return o
+	}
+}
+
+// DedicatedNetwork configures create to create the nodes on a docker network
+// of their own, created if needed and deleted with the cluster, so that they
+// are isolated from the nodes of other clusters
+func DedicatedNetwork(dedicated bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.DedicatedNetwork = dedicated
+		return o
+	}
+}
+
+// Network configures create to create the nodes on the existing docker
+// network instead of the default bridge network
+func Network(network string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.Network = network
+		return o
+	}
+}
+
+// PauseAfterMounts configures create to leave the node containers waiting to
+// boot into systemd once their mounts are fixed, for debugging why nodes do
+// not boot. The cluster is not bootstrapped.
+func PauseAfterMounts(pause bool) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.PauseAfterMounts = pause
+		return o
+	}
+}
+
+// MutateNode configures create to call mutate with each node container as
+// planned before it is created, for last-mile customization such as another
+// image or additional mounts. The node name and role may not be changed, and
+// an error aborts creating the cluster.
+func MutateNode(mutate func(node *PlannedNode) error) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.MutateNode = mutate
+		return o
+	}
+}
+
+// WaitForAPIServer configures create to wait up to timeout for the API server
+// of the first control plane node, or of the external load balancer, to
+// respond once the cluster is bootstrapped
+func WaitForAPIServer(timeout time.Duration) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.WaitForAPIServer = timeout
+		return o
+	}
+}
+
+/* node network IP families, see IPFamily */
+const (
+	IPFamilyIPv4 = internalcreate.IPFamilyIPv4
+	IPFamilyIPv6 = internalcreate.IPFamilyIPv6
+	IPFamilyDual = internalcreate.IPFamilyDual
+)
+
+// IPFamily configures create to create the nodes on a network of the IP
+// family, IPv6 and dual stack nodes use a dedicated network with IPv6
+// enabled unless Network is set, which must then have IPv6 enabled
+func IPFamily(family string) ClusterOption {
+	return func(o *internalcreate.Options) *internalcreate.Options {
+		o.IPFamily = family
+		return o
+	}
+}
@@ -91,11 +91,11 @@ func (c *Context) KubeConfigPath() string {
 
 // ClusterLabel returns the docker object label that will be applied
 // to cluster "node" containers
-func (c *Context) ClusterLabel() string {
-	return fmt.Sprintf("%s=%s", constants.ClusterLabelKey, c.Name())
+func (c *Context) ClusterLabel() nodes.ClusterLabel {
+	return nodes.NewClusterLabel(c.Name())
 }
 
 // ListNodes returns the list of container IDs for the "nodes" in the cluster
 func (c *Context) ListNodes() ([]nodes.Node, error) {
-	return nodes.List("label=" + c.ClusterLabel())
+	return nodes.List(c.ClusterLabel().Filter())
 }
@@ -70,6 +70,12 @@ func (cd *cachedData) setNodes(n []nodes.Node) {
 	cd.nodes = n
 }
 
+// SetNodes sets the cluster nodes returned by Nodes, so that they are not
+// listed, eg to the nodes just provisioned
+func (ac *ActionContext) SetNodes(n []nodes.Node) {
+	ac.cache.setNodes(n)
+}
+
 // Nodes returns the list of cluster nodes, this is a cached call
 func (ac *ActionContext) Nodes() ([]nodes.Node, error) {
 	cachedNodes := ac.cache.getNodes()
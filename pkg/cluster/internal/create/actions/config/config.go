@@ -31,11 +31,16 @@ import (
 
 // Action implements action for creating the kubeadm config
 // and deployng it on the bootrap control-plane node.
-type Action struct{}
+type Action struct {
+	token string
+}
 
-// NewAction returns a new action for creating the kubadm config
-func NewAction() actions.Action {
-	return &Action{}
+// NewAction returns a new action for creating the kubadm config, with
+// token as the bootstrap token
+func NewAction(token string) actions.Action {
+	return &Action{
+		token: token,
+	}
 }
 
 // Execute runs the action
@@ -76,7 +81,7 @@ func (a *Action) Execute(ctx *actions.ActionContext) error {
 			KubernetesVersion:    kubeVersion,
 			ControlPlaneEndpoint: controlPlaneEndpoint,
 			APIBindPort:          kubeadm.APIServerPort,
-			Token:                kubeadm.Token,
+			Token:                a.token,
 		},
 	)
 
@@ -86,7 +91,7 @@ func (a *Action) Execute(ctx *actions.ActionContext) error {
 	}
 
 	// copy the config to the node
-	if err := node.WriteFile("/kind/kubeadm.conf", kubeadmConfig); err != nil {
+	if err := node.WriteFile(kubeadm.ConfigPath, kubeadmConfig); err != nil {
 		// TODO(bentheelder): logging here
 		return errors.Wrap(err, "failed to copy kubeadm config to node")
 	}
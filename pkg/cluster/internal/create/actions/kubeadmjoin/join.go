@@ -37,11 +37,16 @@ import (
 
 // Action implements action for creating the kubeadm config
 // and deployng it on the bootrap control-plane node.
-type Action struct{}
+type Action struct {
+	token string
+}
 
-// NewAction returns a new action for creating the kubadm config
-func NewAction() actions.Action {
-	return &Action{}
+// NewAction returns a new action for creating the kubadm config, the nodes
+// join with token unless another was placed on them while provisioning
+func NewAction(token string) actions.Action {
+	return &Action{
+		token: token,
+	}
 }
 
 // Execute runs the action
@@ -52,7 +57,7 @@ func (a *Action) Execute(ctx *actions.ActionContext) error {
 	secondaryControlPlanes, err := nodes.SecondaryControlPlaneNodes(allNodes)
 	if len(secondaryControlPlanes) > 0 {
 		if err := joinSecondaryControlPlanes(
-			ctx, allNodes, secondaryControlPlanes,
+			ctx, allNodes, secondaryControlPlanes, a.token,
 		); err != nil {
 			return err
 		}
@@ -64,7 +69,7 @@ func (a *Action) Execute(ctx *actions.ActionContext) error {
 		return err
 	}
 	if len(workers) > 0 {
-		if err := joinWorkers(ctx, allNodes, workers); err != nil {
+		if err := joinWorkers(ctx, allNodes, workers, a.token); err != nil {
 			return err
 		}
 	}
@@ -76,13 +81,14 @@ func joinSecondaryControlPlanes(
 	ctx *actions.ActionContext,
 	allNodes []nodes.Node,
 	secondaryControlPlanes []nodes.Node,
+	token string,
 ) error {
 	ctx.Status.Start("Joining more control-plane nodes 🎮")
 	defer ctx.Status.End(false)
 
 	// TODO(bentheelder): this should be concurrent
 	for _, node := range secondaryControlPlanes {
-		if err := runKubeadmJoinControlPlane(ctx, allNodes, &node); err != nil {
+		if err := runKubeadmJoinControlPlane(ctx, allNodes, &node, token); err != nil {
 			return err
 		}
 	}
@@ -95,6 +101,7 @@ func joinWorkers(
 	ctx *actions.ActionContext,
 	allNodes []nodes.Node,
 	workers []nodes.Node,
+	token string,
 ) error {
 	ctx.Status.Start("Joining worker nodes 🚜")
 	defer ctx.Status.End(false)
@@ -105,7 +112,7 @@ func joinWorkers(
 	for _, node := range workers {
 		node := node // capture loop variable
 		go func() {
-			errChan <- runKubeadmJoin(ctx, allNodes, &node)
+			errChan <- runKubeadmJoin(ctx, allNodes, &node, token)
 		}()
 	}
 
@@ -132,6 +139,7 @@ func runKubeadmJoinControlPlane(
 	ctx *actions.ActionContext,
 	allNodes []nodes.Node,
 	node *nodes.Node,
+	token string,
 ) error {
 	// get the join address
 	joinAddress, err := getJoinAddress(ctx, allNodes)
@@ -199,8 +207,8 @@ func runKubeadmJoinControlPlane(
 		joinAddress,
 		// set the node to join as control-plane
 		"--experimental-control-plane",
-		// uses a well known token and skips ca certification for automating TLS bootstrap process
-		"--token", kubeadm.Token,
+		// uses the cluster's token and skips ca certification for automating TLS bootstrap process
+		"--token", token,
 		"--discovery-token-unsafe-skip-ca-verification",
 		// preflight errors are expected, in particular for swap being enabled
 		// TODO(bentheelder): limit the set of acceptable errors
@@ -222,6 +230,7 @@ func runKubeadmJoin(
 	ctx *actions.ActionContext,
 	allNodes []nodes.Node,
 	node *nodes.Node,
+	token string,
 ) error {
 	// get the join address
 	joinAddress, err := getJoinAddress(ctx, allNodes)
@@ -236,8 +245,8 @@ func runKubeadmJoin(
 		// the join command uses the docker ip and a well know port that
 		// are accessible only inside the docker network
 		joinAddress,
-		// uses a well known token and skipping ca certification for automating TLS bootstrap process
-		"--token", kubeadm.Token,
+		// uses the cluster's token and skipping ca certification for automating TLS bootstrap process
+		"--token", joinToken(node, token),
 		"--discovery-token-unsafe-skip-ca-verification",
 		// preflight errors are expected, in particular for swap being enabled
 		// TODO(bentheelder): limit the set of acceptable errors
@@ -254,6 +263,16 @@ func runKubeadmJoin(
 	return nil
 }
 
+// joinToken returns the join token placed on the node during provisioning,
+// falling back to token if there is none
+func joinToken(node *nodes.Node, token string) string {
+	lines, err := exec.CombinedOutputLines(node.Command("cat", kubeadm.JoinTokenPath))
+	if err != nil || len(lines) != 1 {
+		return token
+	}
+	return lines[0]
+}
+
 // getJoinAddress return the join address thas is the control plane endpoint in case the cluster has
 // an external load balancer in front of the control-plane nodes, otherwise the address of the
 // boostrap control plane node.
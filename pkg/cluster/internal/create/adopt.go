@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/docker"
+)
+
+// assignAdoptedNodes marks desired nodes as adopted, in provisioning order,
+// using the pre-existing container names in adopt (a mapping of role to
+// container names). The adopted container name replaces the generated name.
+func assignAdoptedNodes(desiredNodes []nodeSpec, adopt map[string][]string) error {
+	remaining := make(map[string][]string, len(adopt))
+	for role, names := range adopt {
+		if !knownRoles.Has(role) {
+			return errors.Errorf("cannot adopt node containers %v: unknown role %q", names, role)
+		}
+		remaining[role] = names
+	}
+	for i := range desiredNodes {
+		names := remaining[desiredNodes[i].Role]
+		if len(names) == 0 {
+			continue
+		}
+		desiredNodes[i].Name = names[0]
+		desiredNodes[i].Adopted = true
+		remaining[desiredNodes[i].Role] = names[1:]
+	}
+	// every container we were asked to adopt must have a matching node
+	roles := []string{}
+	for role, names := range remaining {
+		if len(names) > 0 {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) > 0 {
+		sort.Strings(roles)
+		return errors.Errorf(
+			"cannot adopt node containers %v: not enough %s nodes in the config",
+			remaining[roles[0]], roles[0],
+		)
+	}
+	return nil
+}
+
+// Adopt returns a handle to the pre-existing node container, validating that
+// it matches the expected image, role, and cluster.
+// The container is expected to have been created like createNode would,
+// and in particular it should still be waiting to be signaled to boot.
+func (d *nodeSpec) Adopt(clusterLabel nodes.ClusterLabel) (*nodes.Node, error) {
+	lines, err := docker.Inspect(d.Name, "{{.Config.Image}}")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect adopted node container %s", d.Name)
+	}
+	if len(lines) != 1 || lines[0] != d.Image {
+		return nil, errors.Errorf(
+			"adopted node container %s has image %q, expected %q",
+			d.Name, strings.Join(lines, ""), d.Image,
+		)
+	}
+
+	node := nodes.FromName(d.Name)
+	role, err := node.Role()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get role of adopted node container %s", d.Name)
+	}
+	if role != d.Role {
+		return nil, errors.Errorf(
+			"adopted node container %s has role %q, expected %q",
+			d.Name, role, d.Role,
+		)
+	}
+
+	// the cluster label is used to find the nodes later, so we require it
+	lines, err = docker.Inspect(d.Name, fmt.Sprintf("{{index .Config.Labels %q}}", constants.ClusterLabelKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %q label", constants.ClusterLabelKey)
+	}
+	label, err := nodes.ParseClusterLabel(
+		fmt.Sprintf("%s=%s", constants.ClusterLabelKey, strings.Trim(strings.Join(lines, ""), "'")),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "adopted node container %s has an invalid label", d.Name)
+	}
+	if label != clusterLabel {
+		return nil, errors.Errorf(
+			"adopted node container %s has label %q, expected %q",
+			d.Name, label, clusterLabel,
+		)
+	}
+
+	return node, nil
+}
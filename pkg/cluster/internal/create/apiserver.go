@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/internal/create/actions"
+)
+
+// DefaultAPIServerPollInterval is how often the API server is checked while
+// waiting for it, see Options.WaitForAPIServer
+const DefaultAPIServerPollInterval = time.Second
+
+// checkAPIServer returns an error if the API server at endpoint does not
+// report that it is healthy, it is a variable so that tests may fake it
+var checkAPIServer = func(endpoint string) error {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			// this only checks that the API server responds, the cluster CA
+			// is not known to the host yet
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(fmt.Sprintf("https://%s/healthz", endpoint))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// waitForAPIServer checks the API server at endpoint every interval until
+// check succeeds, or returns an error with the last check error once timeout
+// has passed
+func waitForAPIServer(endpoint string, timeout, interval time.Duration, check func(string) error) error {
+	until := time.Now().Add(timeout)
+	for {
+		err := check(endpoint)
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(interval).After(until) {
+			return errors.Wrapf(err, "the API server at %s did not respond within %v", endpoint, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// apiServerWaitAction waits for the API server of the provisioned nodes to
+// respond, see Options.WaitForAPIServer
+type apiServerWaitAction struct {
+	timeout time.Duration
+}
+
+// Execute runs the action
+func (a *apiServerWaitAction) Execute(ctx *actions.ActionContext) error {
+	allNodes, err := ctx.Nodes()
+	if err != nil {
+		return err
+	}
+	endpoint, err := apiServerEndpoint(allNodes)
+	if err != nil {
+		return err
+	}
+	ctx.Status.Start(fmt.Sprintf("Waiting ≤ %s for the API server 🔌", a.timeout.Round(time.Second)))
+	if err := waitForAPIServer(endpoint, a.timeout, DefaultAPIServerPollInterval, checkAPIServer); err != nil {
+		ctx.Status.End(false)
+		return err
+	}
+	ctx.Status.End(true)
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// MaxNodesEnv may be set on the host to limit the number of nodes any
+// cluster may have, regardless of Options.MaxNodes
+const MaxNodesEnv = "KIND_MAX_NODES"
+
+// nodeBudget returns the maximum number of nodes to provision given the
+// configured maxNodes and MaxNodesEnv, the lower limit wins. Zero means there
+// is no limit.
+func nodeBudget(maxNodes int) (int, error) {
+	if maxNodes < 0 {
+		return 0, errors.Errorf("the maximum number of nodes must not be negative, got %d", maxNodes)
+	}
+	value := os.Getenv(MaxNodesEnv)
+	if value == "" {
+		return maxNodes, nil
+	}
+	hostMax, err := strconv.Atoi(value)
+	if err != nil || hostMax < 0 {
+		return 0, errors.Errorf("invalid %s %q, expected a non-negative integer", MaxNodesEnv, value)
+	}
+	if maxNodes == 0 || (hostMax != 0 && hostMax < maxNodes) {
+		return hostMax, nil
+	}
+	return maxNodes, nil
+}
+
+// checkNodeBudget returns an error if count exceeds maxNodes
+func checkNodeBudget(count, maxNodes int) error {
+	if maxNodes != 0 && count > maxNodes {
+		return errors.Errorf(
+			"the cluster has %d nodes, which exceeds the maximum of %d nodes",
+			count, maxNodes,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/kind/pkg/container/docker"
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+/* strategies for handling node names that are already in use by a container */
+const (
+	// NameCollisionFail fails creation, this is the default
+	NameCollisionFail = "fail"
+	// NameCollisionAdopt adopts the existing container, see nodeSpec.Adopt
+	NameCollisionAdopt = "adopt"
+	// NameCollisionSuffix renames the node to a unique name
+	NameCollisionSuffix = "suffix"
+)
+
+// validateNameCollision checks that strategy is a known collision strategy
+func validateNameCollision(strategy string) error {
+	switch strategy {
+	case "", NameCollisionFail, NameCollisionAdopt, NameCollisionSuffix:
+		return nil
+	}
+	return errors.Errorf("unknown node name collision strategy: %s", strategy)
+}
+
+// resolveNameCollisions applies strategy to every desired node that is not
+// already adopted and whose name is in use by an existing container
+func resolveNameCollisions(desiredNodes []nodeSpec, strategy string, logger log.FieldLogger) error {
+	existing, err := listContainers()
+	if err != nil {
+		return err
+	}
+	// every name we may not rename a node to
+	inUse := sets.NewString(existing...)
+	taken := sets.NewString(existing...)
+	for _, desiredNode := range desiredNodes {
+		taken.Insert(desiredNode.Name)
+	}
+	uniqueName := makeUniqueNamer(taken)
+
+	conflicts := []string{}
+	for i := range desiredNodes {
+		desiredNode := &desiredNodes[i]
+		if desiredNode.Adopted || !inUse.Has(desiredNode.Name) {
+			continue
+		}
+		switch strategy {
+		case NameCollisionAdopt:
+			logger.Infof("Adopting existing container %s", desiredNode.Name)
+			desiredNode.Adopted = true
+		case NameCollisionSuffix:
+			name := uniqueName(desiredNode.Name)
+			logger.Infof("Container name %s is in use, using %s instead", desiredNode.Name, name)
+			desiredNode.Name = name
+		default:
+			conflicts = append(conflicts, desiredNode.Name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return errors.Errorf(
+			"containers with the node names already exist: %s", strings.Join(conflicts, ", "),
+		)
+	}
+	return nil
+}
+
+// checkDuplicateNodeNames returns an error listing the node names used by
+// more than one desired node
+func checkDuplicateNodeNames(desiredNodes []nodeSpec) error {
+	count := map[string]int{}
+	duplicates := []string{}
+	for _, desiredNode := range desiredNodes {
+		count[desiredNode.Name]++
+		if count[desiredNode.Name] == 2 {
+			duplicates = append(duplicates, desiredNode.Name)
+		}
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	conflicts := []string{}
+	for _, name := range duplicates {
+		conflicts = append(conflicts, fmt.Sprintf("%s (%d nodes)", name, count[name]))
+	}
+	return errors.Errorf("node names are used by more than one node: %s", strings.Join(conflicts, ", "))
+}
+
+// makeUniqueNamer returns a func(name string)(uniqueName string) used to
+// rename nodes to a name that is not in taken, the returned names are
+// added to taken
+func makeUniqueNamer(taken sets.String) func(string) string {
+	return func(name string) string {
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s-%d", name, i)
+			if !taken.Has(candidate) {
+				taken.Insert(candidate)
+				return candidate
+			}
+		}
+	}
+}
+
+// containerNames returns the names of all existing containers
+func containerNames() ([]string, error) {
+	cmd := docker.Command("ps", "-a", "--format", "{{.Names}}")
+	lines, err := exec.CombinedOutputLines(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list containers")
+	}
+	return lines, nil
+}
@@ -17,19 +17,27 @@ limitations under the License.
 package create
 
 import (
+	stdcontext "context"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"sigs.k8s.io/kind/pkg/cluster/internal/create/actions"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"sigs.k8s.io/kind/pkg/cluster/config"
 	"sigs.k8s.io/kind/pkg/cluster/config/encoding"
 	"sigs.k8s.io/kind/pkg/cluster/internal/context"
 	"sigs.k8s.io/kind/pkg/cluster/internal/delete"
+	"sigs.k8s.io/kind/pkg/cluster/internal/kubeadm"
+	"sigs.k8s.io/kind/pkg/container/docker"
 	logutil "sigs.k8s.io/kind/pkg/log"
 
 	configaction "sigs.k8s.io/kind/pkg/cluster/internal/create/actions/config"
@@ -44,10 +52,232 @@ import (
 type Options struct {
 	Retain       bool
 	WaitForReady time.Duration
+	// AdoptNodes maps node roles to the names of pre-existing node containers
+	// that should be adopted for nodes of that role instead of creating them
+	AdoptNodes map[string][]string
+	// FixupPhases overrides the order of the node fixup phases,
+	// see DefaultFixupPhases
+	FixupPhases []string
+	// VerifyMounts enables checking that each node's ExtraMounts are
+	// present in the running node after fixup
+	VerifyMounts bool
+	// NameCollision is the strategy for node names already in use by an
+	// existing container, see NameCollisionFail (the default)
+	NameCollision string
+	// NamePrefix prefixes the node names instead of the cluster name, the
+	// nodes are still labeled with the cluster name
+	NamePrefix string
+	// EstimateDownloads enables reporting how much will be downloaded to
+	// pull the node images before pulling them
+	EstimateDownloads bool
+	// InjectFailures maps node names to a phase at which to deliberately fail
+	// that node, for testing kind's error handling, see CreatePhase. This
+	// requires InjectFailuresEnv to be set to "true".
+	InjectFailures map[string]string
+	// EnvLabels names environment variables whose values are applied
+	// as labels to every node container, unset variables are skipped
+	EnvLabels []string
+	// IgnoreProxyDetectionErrors downgrades errors detecting the host proxy
+	// settings to warnings, in which case no proxy is configured
+	IgnoreProxyDetectionErrors bool
+	// DockerAPIVersion pins the docker API version of the docker commands
+	// instead of negotiating it, see docker.SetAPIVersion. By default
+	// docker.APIVersionEnv is respected if set
+	DockerAPIVersion string
+	// HostGateway makes the host reachable from every node as
+	// HostGatewayAlias, which defaults to host.docker.internal
+	HostGateway      bool
+	HostGatewayAlias string
+	// MinReadyNodes is the number of nodes that must be provisioned for
+	// creation to proceed, tolerating worker failures. Nodes other than workers
+	// are always required. Zero (the default) requires all nodes.
+	MinReadyNodes int
+	// AbandonStragglers stops waiting on the remaining nodes once
+	// MinReadyNodes are ready, removing them instead
+	AbandonStragglers bool
+	// MaxWorkerFailures is the number of worker nodes that may fail to be
+	// provisioned, these are warned about, removed and excluded from the
+	// ready nodes. Nodes other than workers are always required. Zero (the
+	// default) tolerates no failures, unless MinReadyNodes is set
+	MaxWorkerFailures int
+	// SkipBootPhases acknowledges that the SignalStart, WaitForDocker and
+	// LoadImages fixup phases are skipped for nodes overriding the entrypoint,
+	// it is required to create such nodes
+	SkipBootPhases bool
+	// PreplaceJoinToken generates the join token of the cluster and writes
+	// it to the worker nodes while they are provisioned, rather than passing
+	// the well known token when they are joined
+	PreplaceJoinToken bool
+	// joinToken is the bootstrap token of the cluster, generated when it is
+	// placed on the nodes, see PreplaceJoinToken
+	joinToken string
+	// BetweenRolesCommand is a host command to run after provisioning the
+	// nodes of each role before provisioning the nodes of the next role, see
+	// RoleOrder. When set nodes are provisioned one role at a time.
+	BetweenRolesCommand []string
+	// ResultsFile is a path to atomically write the provisioning results to
+	// as JSON, whether provisioning succeeds or not
+	ResultsFile string
+	// OnAPIServerEndpoint is called with the host:port at which the API
+	// server will be reachable from the host as soon as the node serving it
+	// (the external load balancer, or else the bootstrap control plane) is
+	// created, before the cluster is ready. It may be called concurrently with
+	// provisioning the other nodes.
+	OnAPIServerEndpoint func(endpoint string)
+	// CPUGovernorCheck checks the host CPU governor before provisioning, see
+	// CPUGovernorCheckOff (the default)
+	CPUGovernorCheck string
+	// PlanFile is the path to a node plan written by WritePlanFile, if set
+	// the node containers are provisioned exactly as planned rather than from
+	// the config nodes, the config is still used for everything else
+	PlanFile string
+	// Force deletes any existing node containers of the cluster before
+	// provisioning, instead of failing on them
+	Force bool
+	// WaitForNetwork is how long to wait after fixup for each node to have a
+	// routable IP on its primary interface, zero (the default) does not wait
+	WaitForNetwork time.Duration
+	// MaxNodes is the maximum number of nodes that may be provisioned, zero
+	// means there is no limit. MaxNodesEnv can only lower the limit further.
+	MaxNodes int
+	// LogLevels maps provisioning phases (see PlanLogPhase etc.) to the
+	// logrus level for the messages kind logs during that phase, by default
+	// the standard logger's level is used. Output from commands run during
+	// the phase still follows the standard logger's level.
+	LogLevels map[string]string
+	// TestRunID labels the nodes and networks with the test run ID, for
+	// deleting everything created for a test run, see constants.TestRunLabelKey
+	TestRunID string
+	// ImageLoadBatchSize is how many nodes may load images at once, zero
+	// (the default) loads images on all nodes at once
+	ImageLoadBatchSize int
+	// HostsFile is a path to atomically write the node names and IPs to in
+	// /etc/hosts format once the nodes are ready, if set
+	HostsFile string
+	// ImageLoadAttempts is how many times loading the images on a node is
+	// attempted before failing, zero uses DefaultImageLoadAttempts
+	ImageLoadAttempts int
+	// ImageLoadBackoff is the wait before the first image load retry, which
+	// doubles after each attempt, zero uses DefaultImageLoadBackoff
+	ImageLoadBackoff time.Duration
+	// Macvlan attaches the nodes to a macvlan network, if set
+	Macvlan *MacvlanNetwork
+	// DedicatedNetwork creates the nodes on a docker network of their own,
+	// see dedicatedNetworkName, instead of the default bridge network.
+	// The network is created if it does not exist and deleted with the cluster
+	DedicatedNetwork bool
+	// Network is an existing docker network to create the nodes on instead
+	// of the default bridge network, it is neither created nor deleted
+	Network string
+	// IPFamily is the IP family of the node network, see IPFamilyIPv4 (the
+	// default). IPv6 and dual stack nodes are created on the dedicated
+	// network, with IPv6 enabled, unless Network is set
+	IPFamily string
+	// NodeDockerTimeout is how long to wait for docker to be ready on each
+	// node, zero uses DefaultNodeDockerTimeout
+	NodeDockerTimeout time.Duration
+	// SignalStartRetries is how many times a node that does not start booting
+	// shortly after it is signaled in SignalStartPhase is signaled again, zero
+	// uses DefaultSignalStartRetries and negative values disable the check
+	SignalStartRetries int
+	// NodeDockerPollInterval is how often to check whether docker is ready
+	// on each node, zero uses DefaultNodeDockerPollInterval
+	NodeDockerPollInterval time.Duration
+	// CreateAttempts is how many times creating and fixing up each node is
+	// attempted before failing, zero uses DefaultCreateAttempts
+	CreateAttempts int
+	// CreateBackoff is the wait before the first node provisioning retry,
+	// which doubles after each attempt, zero uses DefaultCreateBackoff
+	CreateBackoff time.Duration
+	// ProvisionTimeout is how long to wait for all of the node containers to
+	// be provisioned, zero uses DefaultProvisionTimeout
+	ProvisionTimeout time.Duration
+	// RoleOrder overrides the order in which nodes are provisioned by role
+	// for this cluster, roles not in RoleOrder are provisioned last and
+	// unknown roles are an error. By default DefaultRoleOrder is used
+	RoleOrder []string
+	// KeepLoadBalancer keeps the external load balancer node of clusters
+	// with a single control plane node, which is not created by default
+	KeepLoadBalancer bool
+	// LoadBalancerPort is the host port publishing the external load
+	// balancer, zero picks a random free port. It is an error if there is no
+	// external load balancer node
+	LoadBalancerPort int
+	// RoleImages are the default node images by node role, for the nodes
+	// without an image, before the default node image
+	RoleImages map[string]string
+	// MaxConcurrency is how many node containers may be created at once,
+	// zero uses DefaultMaxConcurrency
+	MaxConcurrency int
+	// Context cancels provisioning the nodes when done, deleting the nodes
+	// created so far unless Retain is set. By default provisioning cannot
+	// be cancelled.
+	Context stdcontext.Context
+	// OnNodePhase is called with the node name and phase as each node enters
+	// CreatePhase and then each fixup phase, it may be called concurrently
+	// for different nodes. Adopted nodes are not created.
+	OnNodePhase func(nodeName, phase string)
+	// MutateNode is called with each node as planned before it is created,
+	// to customize it e.g. with another image or additional mounts. The node
+	// name and role may not be changed, and an error aborts creating the
+	// cluster. It is called sequentially.
+	MutateNode func(node *PlannedNode) error
+	// WaitForAPIServer is how long to wait for the API server of the first
+	// control plane node, or of the external load balancer, to respond once
+	// the cluster is bootstrapped, zero does not wait
+	WaitForAPIServer time.Duration
+	// DryRun prints the node containers that would be provisioned, after
+	// replica expansion and in provisioning order, instead of provisioning
+	// them or otherwise using docker
+	DryRun bool
+	// SkipImageLoad skips loading the images stored in the node images, see
+	// LoadImagesPhase, for node images whose images are not needed or are
+	// pulled by the nodes instead
+	SkipImageLoad bool
+	// SkipMountFixup skips remounting the node container mounts, see
+	// FixMountsPhase, for hosts such as rootless docker where the privileged
+	// remounts fail and are not needed
+	SkipMountFixup bool
+	// PauseAfterMounts stops fixing up the nodes before SignalStartPhase, so
+	// that the node containers are left waiting to boot into systemd for
+	// debugging their boot. The cluster is not bootstrapped.
+	PauseAfterMounts bool
+	// plan is the node plan read from PlanFile
+	plan []PlannedNode
+	// imageLoads limits how many nodes load images at once
+	imageLoads *imageLoadLimiter
+	// networks are the additional networks created for the nodes
+	networks []string
+	// network is the docker network the nodes are created on, see
+	// DedicatedNetwork and Network
+	network string
+	// adopted are the names of the adopted nodes, which existed before the
+	// cluster and are kept when creating it fails
+	adopted sets.String
+	// createSlots is a semaphore limiting how many node containers are
+	// created at once, see MaxConcurrency
+	createSlots *createSlots
+	// out is where the DryRun plan is printed, os.Stdout if nil
+	out io.Writer
+	// generation identifies this provisioning attempt, see
+	// constants.GenerationLabelKey
+	generation string
 }
 
 // Cluster creates a cluster
 func Cluster(ctx *context.Context, cfg *config.Config, opts *Options) error {
+	// the role default images must be applied before the defaulting sets
+	// the images of the nodes without one to the default node image
+	if err := validateRoleImages(opts.RoleImages); err != nil {
+		return err
+	}
+	if len(cfg.Nodes) == 0 {
+		cfg.Nodes = implicitNodes()
+	}
+	for i := range cfg.Nodes {
+		cfg.Nodes[i].Image = nodeImage(cfg.Nodes[i], opts.RoleImages)
+	}
+
 	// default config fields (important for usage as a library, where the config
 	// may be constructed in memory rather than from disk)
 	encoding.Scheme.Default(cfg)
@@ -56,39 +286,93 @@ func Cluster(ctx *context.Context, cfg *config.Config, opts *Options) error {
 	if err := cfg.Validate(); err != nil {
 		return err
 	}
+	if err := validateOptions(opts); err != nil {
+		return err
+	}
+	if opts.PlanFile != "" {
+		plan, err := ReadPlanFile(opts.PlanFile)
+		if err != nil {
+			return err
+		}
+		opts.plan = plan
+	}
+
+	if err := validateEntrypoints(cfg, opts); err != nil {
+		return err
+	}
 
 	status := logutil.NewStatus(os.Stdout)
 	status.MaybeWrapLogrus(log.StandardLogger())
 
-	// attempt to explicitly pull the required node images if they doesn't exist locally
-	// we don't care if this errors, we'll still try to run which also pulls
-	ensureNodeImages(status, cfg)
+	provisionCtx := opts.Context
+	if provisionCtx == nil {
+		provisionCtx = stdcontext.Background()
+	}
+
+	if opts.DryRun {
+		// the plan is printed without using docker at all, so there is
+		// nothing to configure, check or clean up, even on failure
+		_, err := provisionNodes(provisionCtx, status, cfg, ctx.Name(), ctx.ClusterLabel(), opts)
+		return err
+	}
+
+	if err := prepareHost(opts); err != nil {
+		return err
+	}
+
+	// the well known token is only used when it does not need to be placed
+	// on the nodes ahead of joining them
+	opts.joinToken = kubeadm.Token
+	if opts.PreplaceJoinToken {
+		token, err := kubeadm.NewToken()
+		if err != nil {
+			return err
+		}
+		opts.joinToken = token
+	}
 
 	// Create node containers implementing defined config Nodes
-	if err := provisionNodes(status, cfg, ctx.Name(), ctx.ClusterLabel()); err != nil {
+	provisioned, err := provisionNodes(provisionCtx, status, cfg, ctx.Name(), ctx.ClusterLabel(), opts)
+	if err != nil {
 		// In case of errors nodes are deleted (except if retain is explicitly set)
 		log.Error(err)
 		if !opts.Retain {
-			delete.Cluster(ctx)
+			delete.ClusterKeeping(ctx, opts.adopted.List()...)
 		}
 		return err
 	}
+	if opts.PauseAfterMounts {
+		names := make([]string, 0, len(provisioned))
+		for _, node := range provisioned {
+			names = append(names, node.Name())
+		}
+		log.Infof("Left the nodes waiting to boot into systemd: %s", strings.Join(names, ", "))
+		return nil
+	}
 
 	// TODO(bentheelder): make this controllable from the command line?
 	actionsToRun := []actions.Action{
-		loadbalancer.NewAction(),                  // setup external loadbalancer
-		configaction.NewAction(),                  // setup kubeadm config
-		kubeadminit.NewAction(),                   // run kubeadm init
-		kubeadmjoin.NewAction(),                   // run kubeadm join
-		waitforready.NewAction(opts.WaitForReady), // wait for cluster readiness
+		loadbalancer.NewAction(),               // setup external loadbalancer
+		configaction.NewAction(opts.joinToken), // setup kubeadm config
+		kubeadminit.NewAction(),                // run kubeadm init
+		kubeadmjoin.NewAction(opts.joinToken),  // run kubeadm join
+	}
+	if opts.WaitForAPIServer > 0 {
+		// the API server only exists once kubeadm init has run
+		actionsToRun = append(actionsToRun, &apiServerWaitAction{timeout: opts.WaitForAPIServer})
 	}
+	actionsToRun = append(actionsToRun,
+		waitforready.NewAction(opts.WaitForReady), // wait for cluster readiness
+	)
 
 	// run all actions
 	actionsContext := actions.NewActionContext(cfg, ctx, status)
+	// the actions target exactly the nodes just provisioned
+	actionsContext.SetNodes(provisioned)
 	for _, action := range actionsToRun {
 		if err := action.Execute(actionsContext); err != nil {
 			if !opts.Retain {
-				delete.Cluster(ctx)
+				delete.ClusterKeeping(ctx, opts.adopted.List()...)
 			}
 			return err
 		}
@@ -100,6 +384,113 @@ func Cluster(ctx *context.Context, cfg *config.Config, opts *Options) error {
 	return nil
 }
 
+// validateOptions checks the options that do not depend on the config, for
+// both Cluster and Workers
+func validateOptions(opts *Options) error {
+	if err := validateFixupPhases(opts.fixupPhases()); err != nil {
+		return err
+	}
+	if err := validateNameCollision(opts.NameCollision); err != nil {
+		return err
+	}
+	if err := validateInjectFailures(opts.InjectFailures); err != nil {
+		return err
+	}
+	if err := validateCPUGovernorCheck(opts.CPUGovernorCheck); err != nil {
+		return err
+	}
+	if err := validateIPFamily(opts.IPFamily); err != nil {
+		return err
+	}
+	if err := validateMacvlanNetwork(opts.Macvlan); err != nil {
+		return err
+	}
+	if opts.DedicatedNetwork && opts.Network != "" {
+		return errors.New("a dedicated network and an existing network are mutually exclusive")
+	}
+	if err := validateLogLevels(opts.LogLevels); err != nil {
+		return err
+	}
+	if opts.NodeDockerTimeout < 0 {
+		return errors.Errorf("node docker timeout must not be negative, got %v", opts.NodeDockerTimeout)
+	}
+	if opts.NodeDockerPollInterval < 0 {
+		return errors.Errorf("node docker poll interval must not be negative, got %v", opts.NodeDockerPollInterval)
+	}
+	if err := validateLoadBalancerPort(opts.LoadBalancerPort); err != nil {
+		return err
+	}
+	if opts.WaitForAPIServer < 0 {
+		return errors.Errorf("API server wait must not be negative, got %v", opts.WaitForAPIServer)
+	}
+	if opts.ProvisionTimeout < 0 {
+		return errors.Errorf("provision timeout must not be negative, got %v", opts.ProvisionTimeout)
+	}
+	if opts.CreateAttempts < 0 || opts.CreateBackoff < 0 {
+		return errors.New("create attempts and backoff must not be negative")
+	}
+	if err := validateRoleOrder(opts.RoleOrder); err != nil {
+		return err
+	}
+	if opts.MaxConcurrency < 0 {
+		return errors.Errorf("max concurrency must not be negative, got %d", opts.MaxConcurrency)
+	}
+	if opts.ImageLoadAttempts < 0 || opts.ImageLoadBackoff < 0 {
+		return errors.New("image load attempts and backoff must not be negative")
+	}
+	if opts.NamePrefix != "" {
+		if errs := validation.IsDNS1123Label(opts.NamePrefix); len(errs) > 0 {
+			return errors.Errorf("invalid node name prefix %q: %s", opts.NamePrefix, strings.Join(errs, "; "))
+		}
+	}
+	if opts.Force && (len(opts.AdoptNodes) > 0 || opts.NameCollision == NameCollisionAdopt) {
+		return errors.New("forcing a clean create cannot be combined with adopting nodes")
+	}
+	if opts.DockerAPIVersion != "" {
+		if err := docker.ValidateAPIVersion(opts.DockerAPIVersion); err != nil {
+			return err
+		}
+	} else if version := os.Getenv(docker.APIVersionEnv); version != "" {
+		if err := docker.ValidateAPIVersion(version); err != nil {
+			return errors.Wrapf(err, "invalid %s", docker.APIVersionEnv)
+		}
+	}
+	return nil
+}
+
+// prepareHost pins the docker API version and checks that the host supports
+// the options, before any node is created
+func prepareHost(opts *Options) error {
+	if opts.DockerAPIVersion != "" {
+		if err := docker.SetAPIVersion(opts.DockerAPIVersion); err != nil {
+			return err
+		}
+	}
+	if opts.HostGateway {
+		if err := checkHostGatewaySupport(); err != nil {
+			return err
+		}
+	}
+	return checkIPFamilySupport(opts.IPFamily)
+}
+
+// validateEntrypoints checks that SkipBootPhases is set if any node
+// overrides the entrypoint, as those nodes cannot boot like normal nodes
+func validateEntrypoints(cfg *config.Config, opts *Options) error {
+	if opts.SkipBootPhases {
+		return nil
+	}
+	for _, node := range cfg.Nodes {
+		if len(node.Entrypoint) > 0 {
+			return errors.Errorf(
+				"overriding the node entrypoint breaks the %v fixup phases, these must be explicitly skipped",
+				bootPhases,
+			)
+		}
+	}
+	return nil
+}
+
 func printUsage(name string) {
 	// TODO: consider shell detection.
 	if runtime.GOOS == "windows" {
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/internal/haproxy"
+	"sigs.k8s.io/kind/pkg/cluster/internal/kubeadm"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+// makeEndpointNotifier returns a function to call when each node is created,
+// which calls notify with the API server endpoint once the node serving it
+// is created. The external load balancer serves the endpoint if there is one,
+// otherwise the bootstrap control plane (the first one) does.
+func makeEndpointNotifier(desiredNodes []nodeSpec, notify func(string)) func(nodeSpec, *nodes.Node) {
+	endpointNode := ""
+	containerPort := 0
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Role == constants.ExternalLoadBalancerNodeRoleValue {
+			endpointNode = desiredNode.Name
+			containerPort = haproxy.ControlPlanePort
+			break
+		}
+		if desiredNode.Role == constants.ControlPlaneNodeRoleValue && endpointNode == "" {
+			endpointNode = desiredNode.Name
+			containerPort = kubeadm.APIServerPort
+		}
+	}
+	return func(desiredNode nodeSpec, node *nodes.Node) {
+		if desiredNode.Name != endpointNode {
+			return
+		}
+		hostPort, err := node.Ports(containerPort)
+		if err != nil {
+			log.Warnf("Failed to get the API server endpoint: %v", err)
+			return
+		}
+		// the kubeconfig addresses the API server on localhost as well
+		notify(fmt.Sprintf("localhost:%d", hostPort))
+	}
+}
+
+// apiServerEndpoint returns the host:port at which the API server of the
+// provisioned nodes is reachable from the host, see makeEndpointNotifier
+func apiServerEndpoint(allNodes []nodes.Node) (string, error) {
+	node, err := nodes.ExternalLoadBalancerNode(allNodes)
+	if err != nil {
+		return "", err
+	}
+	containerPort := haproxy.ControlPlanePort
+	if node == nil {
+		node, err = nodes.BootstrapControlPlaneNode(allNodes)
+		if err != nil {
+			return "", err
+		}
+		containerPort = kubeadm.APIServerPort
+	}
+	hostPort, err := node.Ports(containerPort)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the API server endpoint")
+	}
+	return fmt.Sprintf("localhost:%d", hostPort), nil
+}
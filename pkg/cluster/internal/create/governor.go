@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+/* CPU governor check modes, see Options.CPUGovernorCheck */
+const (
+	// CPUGovernorCheckOff does not check the host CPU governor (the default)
+	CPUGovernorCheckOff = ""
+	// CPUGovernorCheckWarn warns if the host CPUs are not using the
+	// performance governor
+	CPUGovernorCheckWarn = "Warn"
+	// CPUGovernorCheckError fails provisioning if the host CPUs are not using
+	// the performance governor
+	CPUGovernorCheckError = "Error"
+)
+
+// the cpufreq governor of each host CPU, on linux
+const cpuGovernorGlob = "/sys/devices/system/cpu/cpu*/cpufreq/scaling_governor"
+
+func validateCPUGovernorCheck(mode string) error {
+	switch mode {
+	case CPUGovernorCheckOff, CPUGovernorCheckWarn, CPUGovernorCheckError:
+		return nil
+	}
+	return errors.Errorf("unknown CPU governor check mode: %s", mode)
+}
+
+// checkCPUGovernor warns or errors depending on mode if any host CPU is not
+// using the performance governor, skewing benchmarks run against the cluster.
+// Hosts without cpufreq support are not checked.
+func checkCPUGovernor(mode string) error {
+	if mode == CPUGovernorCheckOff {
+		return nil
+	}
+	paths, _ := filepath.Glob(cpuGovernorGlob)
+	if len(paths) == 0 {
+		log.Debug("Not checking the CPU governor, it is not available on this host")
+		return nil
+	}
+	governors := sets.NewString()
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the CPU governor")
+		}
+		governors.Insert(strings.TrimSpace(string(content)))
+	}
+	governors.Delete("performance")
+	if governors.Len() == 0 {
+		return nil
+	}
+	msg := "host CPUs are not using the performance governor, found: " + strings.Join(governors.List(), ", ")
+	if mode == CPUGovernorCheckError {
+		return errors.New(msg)
+	}
+	log.Warn(msg)
+	return nil
+}
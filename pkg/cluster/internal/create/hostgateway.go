@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"sigs.k8s.io/kind/pkg/container/docker"
+)
+
+// the default alias for the host when HostGateway is enabled
+const defaultHostGatewayAlias = "host.docker.internal"
+
+// docker added the special host-gateway --add-host value in 20.10
+var minHostGatewayVersion = version.MustParseGeneric("20.10.0")
+
+func (o *Options) hostGatewayAlias() string {
+	if o.HostGatewayAlias == "" {
+		return defaultHostGatewayAlias
+	}
+	return o.HostGatewayAlias
+}
+
+// checkHostGatewaySupport returns an error if the docker daemon does not
+// support the host-gateway --add-host value
+func checkHostGatewaySupport() error {
+	serverVersion, err := docker.ServerVersion()
+	if err != nil {
+		return err
+	}
+	if serverVersion.LessThan(minHostGatewayVersion) {
+		return errors.Errorf(
+			"host gateway requires docker %s or newer, found %s",
+			minHostGatewayVersion, serverVersion,
+		)
+	}
+	return nil
+}
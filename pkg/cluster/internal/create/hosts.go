@@ -0,0 +1,46 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+// writeHostsFile atomically writes the primary IP and name of each node to
+// path in /etc/hosts format, headed by a comment naming the cluster so that
+// files for several clusters can be told apart
+func writeHostsFile(path, clusterName string, ready []nodes.Node) error {
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "# kind cluster: %s\n", clusterName)
+	for i := range ready {
+		node := &ready[i]
+		ip, err := node.IP()
+		if err != nil {
+			return errors.Wrapf(err, "failed to get IP for node %s", node.Name())
+		}
+		fmt.Fprintf(&content, "%s\t%s\n", ip, node.Name())
+	}
+	if err := writeFileAtomic(path, content.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to write hosts file")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+// imageLoadLimiter limits how many nodes load images at once
+type imageLoadLimiter struct {
+	slots  chan struct{}
+	logger log.FieldLogger
+	total  int
+
+	mu     sync.Mutex
+	loaded int
+}
+
+// newImageLoadLimiter returns a limiter allowing batchSize of the total nodes
+// loading images to load them at once, or nil if batchSize is zero (no limit)
+func newImageLoadLimiter(batchSize, total int, logger log.FieldLogger) (*imageLoadLimiter, error) {
+	if batchSize < 0 {
+		return nil, errors.Errorf("image load batch size must not be negative, got %d", batchSize)
+	}
+	if batchSize == 0 {
+		return nil, nil
+	}
+	return &imageLoadLimiter{
+		slots:  make(chan struct{}, batchSize),
+		logger: logger,
+		total:  total,
+	}, nil
+}
+
+// run calls load once fewer than batchSize nodes are loading images,
+// reporting progress each time another batchSize nodes are done, and once
+// all of them are. A nil limiter calls load immediately.
+func (l *imageLoadLimiter) run(load func() error) error {
+	if l == nil {
+		return load()
+	}
+	l.slots <- struct{}{}
+	defer func() { <-l.slots }()
+	err := load()
+	l.mu.Lock()
+	l.loaded++
+	if l.loaded%cap(l.slots) == 0 || l.loaded == l.total {
+		l.logger.Infof("Loaded images on %d of %d nodes", l.loaded, l.total)
+	}
+	l.mu.Unlock()
+	return err
+}
+
+// loadsImages returns true if the LoadImages fixup phase runs on the node
+// for desiredNode, the external load balancer has no images to load
+func (o *Options) loadsImages(desiredNode nodeSpec) bool {
+	if desiredNode.Role == constants.ExternalLoadBalancerNodeRoleValue {
+		return false
+	}
+	// the boot phases are skipped for nodes overriding the entrypoint
+	if o.SkipImageLoad || len(desiredNode.Entrypoint) > 0 {
+		return false
+	}
+	for _, phase := range o.fixupPhases() {
+		if phase == LoadImagesPhase {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultImageLoadAttempts is how many times loading the images on a node is
+// attempted by default, see Options.ImageLoadAttempts
+const DefaultImageLoadAttempts = 3
+
+// DefaultImageLoadBackoff is the default wait before the first image load
+// retry, see Options.ImageLoadBackoff
+const DefaultImageLoadBackoff = time.Second
+
+// loadImages loads the image archives stored on node, retrying the archives
+// that failed to load up to attempts times in total with a doubling backoff.
+// The attempts are logged, and the error lists the archives that never loaded.
+// Each archive is loaded with load, eg node.LoadImageArchive.
+func loadImages(node *nodes.Node, load func(archive string) error, attempts int, backoff time.Duration, logger log.FieldLogger) error {
+	if attempts == 0 {
+		attempts = DefaultImageLoadAttempts
+	}
+	if backoff == 0 {
+		backoff = DefaultImageLoadBackoff
+	}
+	pending, err := node.ImageArchives()
+	if err != nil {
+		return errors.Wrapf(err, "failed to load images on node %s", node.Name())
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	attempt := 1
+	for ; ; attempt++ {
+		failed := []string{}
+		for _, archive := range pending {
+			if err := load(archive); err != nil {
+				logger.WithError(err).Debugf("Attempt %d to load %s on node %s failed", attempt, archive, node.Name())
+				failed = append(failed, archive)
+			}
+		}
+		pending = failed
+		if len(pending) == 0 || attempt == attempts {
+			break
+		}
+		logger.Warningf(
+			"Failed to load %d images on node %s (attempt %d of %d), retrying in %v",
+			len(pending), node.Name(), attempt, attempts, backoff,
+		)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if len(pending) > 0 {
+		return errors.Errorf(
+			"failed to load images on node %s after %d attempts: %s",
+			node.Name(), attempt, strings.Join(pending, ", "),
+		)
+	}
+	logger.Infof("Loaded images on node %s in %d attempts", node.Name(), attempt)
+	return nil
+}
@@ -18,25 +18,28 @@ package create
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
+	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
 
-	"sigs.k8s.io/kind/pkg/cluster/config"
 	"sigs.k8s.io/kind/pkg/container/docker"
 	logutil "sigs.k8s.io/kind/pkg/log"
+	"sigs.k8s.io/kind/pkg/util"
 )
 
-// ensureNodeImages ensures that the node images used by the create
-// configuration are present
-func ensureNodeImages(status *logutil.Status, cfg *config.Config) {
-	// pull each required image
-	for _, image := range requiredImages(cfg).List() {
+// ensureNodeImages ensures that the node images used by the nodes to be
+// created are present, pulling each distinct image once before the nodes are
+// created concurrently
+func ensureNodeImages(status *logutil.Status, desiredNodes []nodeSpec, logger log.FieldLogger) {
+	for _, image := range nodeImages(desiredNodes).List() {
 		// prints user friendly message
 		if strings.Contains(image, "@sha256:") {
 			image = strings.Split(image, "@sha256:")[0]
 		}
 		status.Start(fmt.Sprintf("Ensuring node image (%s) 🖼", image))
+		logger.Debugf("Ensuring node image %s is present", image)
 
 		// attempt to explicitly pull the image if it doesn't exist locally
 		// we don't care if this errors, we'll still try to run which also pulls
@@ -44,11 +47,90 @@ func ensureNodeImages(status *logutil.Status, cfg *config.Config) {
 	}
 }
 
-// requiredImages returns the set of images specified by the config
-func requiredImages(cfg *config.Config) sets.String {
+// reportImageDownloads logs an estimate of how much will be downloaded to
+// pull the images of the nodes to be created that are not present locally,
+// it does not pull anything
+func reportImageDownloads(status *logutil.Status, desiredNodes []nodeSpec, logger log.FieldLogger) {
+	status.Start("Estimating node image downloads 📏")
+	defer status.End(true)
+
+	// layers shared with the images present locally are not downloaded
+	localLayers := sets.NewString()
+	if layers, err := docker.LocalLayers(); err != nil {
+		logger.WithError(err).Warning("Could not list the image layers present locally")
+	} else {
+		localLayers.Insert(layers...)
+	}
+	pullConfigs := nodePullConfigs(desiredNodes)
+	images := make([]string, 0, len(pullConfigs))
+	for image := range pullConfigs {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+
+	total := int64(0)
+	for _, image := range images {
+		// images already present locally will not be pulled at all
+		if docker.Command("inspect", "--type=image", image).Run() == nil {
+			logger.Infof("Image: %s present locally", image)
+			continue
+		}
+		// node images are always linux images
+		layers, err := docker.ManifestLayers(image, pullConfigs[image], "linux", util.GetArch())
+		if err != nil {
+			logger.WithError(err).Warningf("Could not estimate download size for image: %s", image)
+			continue
+		}
+		size := int64(0)
+		for _, layer := range layers {
+			if !localLayers.Has(layer.Digest) {
+				size += layer.Size
+			}
+		}
+		logger.Infof("Image: %s will download %s", image, formatBytes(size))
+		total += size
+	}
+	logger.Infof("Node images will download %s in total", formatBytes(total))
+}
+
+// formatBytes formats a byte count for humans, eg 1.5 GiB
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// nodeImages returns the distinct images of the nodes to be created, except
+// for images pulled with credentials from a node's PullConfig, which are
+// pulled when creating the node. Adopted nodes already exist.
+func nodeImages(desiredNodes []nodeSpec) sets.String {
 	images := sets.NewString()
-	for _, node := range cfg.Nodes {
-		images.Insert(node.Image)
+	for _, desiredNode := range desiredNodes {
+		if !desiredNode.Adopted && desiredNode.PullConfig == "" {
+			images.Insert(desiredNode.Image)
+		}
 	}
 	return images
 }
+
+// nodePullConfigs maps the distinct images of the nodes to be created to
+// the PullConfig they are pulled with, if any. Adopted nodes already exist.
+func nodePullConfigs(desiredNodes []nodeSpec) map[string]string {
+	pullConfigs := map[string]string{}
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Adopted {
+			continue
+		}
+		if pullConfig := pullConfigs[desiredNode.Image]; pullConfig == "" {
+			pullConfigs[desiredNode.Image] = desiredNode.PullConfig
+		}
+	}
+	return pullConfigs
+}
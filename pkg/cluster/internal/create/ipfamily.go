@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"sigs.k8s.io/kind/pkg/container/docker"
+)
+
+/* node network IP families, see Options.IPFamily */
+const (
+	// IPFamilyIPv4 creates the nodes on an IPv4 network (the default)
+	IPFamilyIPv4 = "ipv4"
+	// IPFamilyIPv6 creates the nodes on an IPv6 enabled network
+	IPFamilyIPv6 = "ipv6"
+	// IPFamilyDual creates the nodes on a dual stack network
+	IPFamilyDual = "dual"
+)
+
+// the IPv6 subnet of the dedicated network created for IPv6 and dual stack
+// clusters, a unique local address range
+const dedicatedNetworkIPv6Subnet = "fc00:f853:ccd:e793::/64"
+
+// docker added ip6tables support in 20.10, before that IPv6 node networks
+// are not NATed and the nodes cannot reach outside of the host over IPv6
+var minIPv6Version = version.MustParseGeneric("20.10.0")
+
+func (o *Options) ipFamily() string {
+	if o.IPFamily == "" {
+		return IPFamilyIPv4
+	}
+	return o.IPFamily
+}
+
+// ipv6 returns true if the nodes need an IPv6 enabled network
+func (o *Options) ipv6() bool {
+	return o.ipFamily() != IPFamilyIPv4
+}
+
+func validateIPFamily(family string) error {
+	switch family {
+	case "", IPFamilyIPv4, IPFamilyIPv6, IPFamilyDual:
+		return nil
+	}
+	return errors.Errorf("unknown IP family: %s", family)
+}
+
+// checkIPFamilySupport returns an error if the docker daemon does not
+// support the IP family
+func checkIPFamilySupport(family string) error {
+	if family == "" || family == IPFamilyIPv4 {
+		return nil
+	}
+	serverVersion, err := docker.ServerVersion()
+	if err != nil {
+		return err
+	}
+	if serverVersion.LessThan(minIPv6Version) {
+		return errors.Errorf(
+			"IP family %s requires docker %s or newer, found %s",
+			family, minIPv6Version, serverVersion,
+		)
+	}
+	return nil
+}
+
+// checkNetworkIPFamily returns an error if the docker network called name
+// does not support the IP family of the nodes
+func checkNetworkIPFamily(opts *Options, name string) error {
+	if !opts.ipv6() {
+		return nil
+	}
+	enabled, err := docker.NetworkIPv6Enabled(name)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.Errorf("network %s does not have IPv6 enabled, required by IP family %s", name, opts.ipFamily())
+	}
+	return nil
+}
+
+// ipFamilySysctls returns the sysctls the nodes need for the IP family, IPv6
+// is disabled in containers by default and kube-proxy needs it forwarded
+func ipFamilySysctls(family string) map[string]string {
+	if family == "" || family == IPFamilyIPv4 {
+		return nil
+	}
+	return map[string]string{
+		"net.ipv6.conf.all.disable_ipv6": "0",
+		"net.ipv6.conf.all.forwarding":   "1",
+	}
+}
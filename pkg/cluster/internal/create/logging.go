@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+/* provisioning phases with independent log levels, see Options.LogLevels */
+const (
+	// PlanLogPhase is planning the nodes to provision
+	PlanLogPhase = "plan"
+	// CreateLogPhase is creating the node containers
+	CreateLogPhase = "create"
+	// FixupLogPhase is fixing up the node containers, see fixupNode
+	FixupLogPhase = "fixup"
+	// ImageLoadLogPhase is pulling the node images and loading the images
+	// on the nodes
+	ImageLoadLogPhase = "image-load"
+)
+
+// validateLogLevels checks that levels maps known phases to logrus levels
+func validateLogLevels(levels map[string]string) error {
+	for phase, level := range levels {
+		switch phase {
+		case PlanLogPhase, CreateLogPhase, FixupLogPhase, ImageLoadLogPhase:
+		default:
+			return errors.Errorf("unknown log phase: %s", phase)
+		}
+		if _, err := log.ParseLevel(level); err != nil {
+			return errors.Wrapf(err, "invalid log level for phase %s", phase)
+		}
+	}
+	return nil
+}
+
+// logger returns the logger for phase, which logs to the standard logger's
+// output at the phase's configured level, or the standard logger if the
+// phase has no level configured
+func (o *Options) logger(phase string) log.FieldLogger {
+	level, ok := o.LogLevels[phase]
+	if !ok {
+		return log.StandardLogger()
+	}
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return log.StandardLogger()
+	}
+	std := log.StandardLogger()
+	logger := log.New()
+	logger.Out = std.Out
+	logger.Formatter = std.Formatter
+	logger.Hooks = std.Hooks
+	logger.Level = parsed
+	return logger
+}
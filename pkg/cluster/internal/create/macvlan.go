@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/docker"
+)
+
+// MacvlanNetwork configures a macvlan network to attach the nodes to, in
+// addition to the default docker network which is still used to reach the
+// nodes from the host.
+//
+// Docker allocates the node IPs statically from Subnet, it does not use DHCP,
+// so Subnet should not overlap the range served by any DHCP server on the
+// parent interface's network. Note that the host itself cannot reach the
+// nodes over the macvlan network through the parent interface.
+type MacvlanNetwork struct {
+	// Parent is the host network interface to create the network on
+	Parent string
+	// Subnet is the CIDR to allocate node IPs from
+	Subnet string
+	// Gateway is the gateway of Subnet, by default docker picks one
+	Gateway string
+}
+
+// validateMacvlanNetwork checks that the parent interface exists on the host
+// and that the subnet and gateway are valid
+func validateMacvlanNetwork(network *MacvlanNetwork) error {
+	if network == nil {
+		return nil
+	}
+	if _, err := net.InterfaceByName(network.Parent); err != nil {
+		return errors.Wrapf(err, "invalid macvlan parent interface %q", network.Parent)
+	}
+	if _, _, err := net.ParseCIDR(network.Subnet); err != nil {
+		return errors.Wrapf(err, "invalid macvlan subnet %q", network.Subnet)
+	}
+	if network.Gateway != "" && net.ParseIP(network.Gateway) == nil {
+		return errors.Errorf("invalid macvlan gateway %q", network.Gateway)
+	}
+	return nil
+}
+
+// networkLabels returns the labels for networks created for the cluster,
+// the cluster label is required to delete them with the cluster
+func (o *Options) networkLabels(clusterLabel nodes.ClusterLabel) []string {
+	labels := []string{string(clusterLabel)}
+	if o.TestRunID != "" {
+		labels = append(labels, constants.TestRunLabelKey+"="+o.TestRunID)
+	}
+	return labels
+}
+
+// macvlanNetworkName returns the name of the cluster's macvlan network
+func macvlanNetworkName(clusterName string) string {
+	return fmt.Sprintf("kind-%s-macvlan", clusterName)
+}
+
+// ensureMacvlanNetwork creates the cluster's macvlan network if it does not
+// exist yet, labeled with labels, see Options.networkLabels. created is true
+// if the network was created, in which case it should be deleted with
+// deleteUnusedNetwork if provisioning fails.
+func ensureMacvlanNetwork(network *MacvlanNetwork, clusterName string, labels ...string) (name string, created bool, err error) {
+	name = macvlanNetworkName(clusterName)
+	if docker.NetworkExists(name) {
+		return name, false, nil
+	}
+	log.Infof("Creating macvlan network %s on %s", name, network.Parent)
+	if err := docker.CreateMacvlanNetwork(name, network.Parent, network.Subnet, network.Gateway, labels...); err != nil {
+		return "", false, err
+	}
+	return name, true, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/cri"
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// verifyMounts checks that each of mounts is mounted in the running node,
+// and that it is read only where requested
+func verifyMounts(node *nodes.Node, mounts []cri.Mount) error {
+	if len(mounts) == 0 {
+		return nil
+	}
+	lines, err := exec.CombinedOutputLines(node.Command("cat", "/proc/self/mounts"))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list mounts on node %s", node.Name())
+	}
+	// mount point -> mount options, later mounts shadow earlier ones
+	mounted := make(map[string][]string)
+	for _, line := range lines {
+		// device mountpoint fstype options dump pass
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		mounted[unescapeMountPath(fields[1])] = strings.Split(fields[3], ",")
+	}
+	for _, mount := range mounts {
+		options, ok := mounted[filepath.Clean(mount.ContainerPath)]
+		if !ok {
+			return errors.Errorf(
+				"extra mount %s is not mounted on node %s",
+				mount.ContainerPath, node.Name(),
+			)
+		}
+		if mount.Readonly && !hasMountOption(options, "ro") {
+			return errors.Errorf(
+				"extra mount %s is not mounted read only on node %s",
+				mount.ContainerPath, node.Name(),
+			)
+		}
+	}
+	return nil
+}
+
+// /proc/self/mounts escapes whitespace and backslashes in paths as octal
+var mountPathReplacer = strings.NewReplacer(
+	`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`,
+)
+
+func unescapeMountPath(path string) string {
+	return mountPathReplacer.Replace(path)
+}
+
+func hasMountOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// the node's primary network interface, as created by docker
+const primaryInterface = "eth0"
+
+// waitForNodeIP waits up to timeout for the node's primary interface to have
+// a routable (global scope) IPv4 address
+func waitForNodeIP(node *nodes.Node, timeout time.Duration, logger log.FieldLogger) error {
+	until := time.Now().Add(timeout)
+	for {
+		if ip := nodeIP(node); ip != "" {
+			logger.Infof("Node %s has IP %s", node.Name(), ip)
+			return nil
+		}
+		if time.Now().After(until) {
+			return errors.Errorf(
+				"timed out after %v waiting for node %s to have an IP on %s",
+				timeout, node.Name(), primaryInterface,
+			)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// nodeIP returns the routable IPv4 address of the node's primary interface,
+// or the empty string if there is none yet
+func nodeIP(node *nodes.Node) string {
+	cmd := node.Command("ip", "-4", "-o", "addr", "show", "dev", primaryInterface, "scope", "global")
+	lines, err := exec.CombinedOutputLines(cmd)
+	if err != nil {
+		return ""
+	}
+	// lines look like:
+	// 23: eth0    inet 172.17.0.2/16 brd 172.17.255.255 scope global eth0 ...
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "inet" {
+				return strings.Split(fields[i+1], "/")[0]
+			}
+		}
+	}
+	return ""
+}
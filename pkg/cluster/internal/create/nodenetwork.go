@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/container/docker"
+)
+
+// dedicatedNetworkName returns the name of the cluster's dedicated network
+func dedicatedNetworkName(clusterName string) string {
+	return fmt.Sprintf("kind-%s", clusterName)
+}
+
+// ensureNodeNetwork returns the docker network to create the nodes on, or
+// "" for the default bridge network. The dedicated network is created if it
+// does not exist yet, labeled with labels, see Options.networkLabels, in
+// which case created is true. The default bridge network has no IPv6, so
+// IPv6 and dual stack nodes always use the dedicated network unless Network
+// is set, see Options.IPFamily
+func ensureNodeNetwork(opts *Options, clusterName string, labels ...string) (name string, created bool, err error) {
+	if opts.Network != "" {
+		if !docker.NetworkExists(opts.Network) {
+			return "", false, errors.Errorf("network %s does not exist", opts.Network)
+		}
+		return opts.Network, false, checkNetworkIPFamily(opts, opts.Network)
+	}
+	if !opts.DedicatedNetwork && !opts.ipv6() {
+		return "", false, nil
+	}
+	name = dedicatedNetworkName(clusterName)
+	if docker.NetworkExists(name) {
+		return name, false, checkNetworkIPFamily(opts, name)
+	}
+	log.Infof("Creating network %s", name)
+	if opts.ipv6() {
+		err = docker.CreateIPv6Network(name, dedicatedNetworkIPv6Subnet, labels...)
+	} else {
+		err = docker.CreateNetwork(name, labels...)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return name, true, nil
+}
+
+// deleteUnusedNetwork deletes a network created by ensureNodeNetwork or
+// ensureMacvlanNetwork after provisioning failed, unless containers are left
+// on it
+func deleteUnusedNetwork(name string) {
+	containers, err := docker.NetworkContainers(name)
+	if err != nil {
+		log.Warnf("Failed to delete network %s: %v", name, err)
+		return
+	}
+	if len(containers) > 0 {
+		log.Debugf("Not deleting network %s, it is used by %v", name, containers)
+		return
+	}
+	if err := docker.DeleteNetwork(name); err != nil {
+		log.Warnf("Failed to delete network %s: %v", name, err)
+	}
+}
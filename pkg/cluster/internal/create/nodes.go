@@ -17,21 +17,122 @@ limitations under the License.
 package create
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
 
 	"sigs.k8s.io/kind/pkg/cluster/config"
+	"sigs.k8s.io/kind/pkg/cluster/config/defaults"
 	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/internal/kubeadm"
 	"sigs.k8s.io/kind/pkg/cluster/nodes"
 	"sigs.k8s.io/kind/pkg/container/cri"
+	"sigs.k8s.io/kind/pkg/container/docker"
 	logutil "sigs.k8s.io/kind/pkg/log"
+	"sigs.k8s.io/kind/pkg/util"
 )
 
-// provisioning order for nodes by role
+// DefaultNodeDockerTimeout is how long to wait for docker to be ready on each
+// node by default, see Options.NodeDockerTimeout
+const DefaultNodeDockerTimeout = 30 * time.Second
+
+// DefaultNodeDockerPollInterval is how often to check whether docker is ready
+// on each node by default, see Options.NodeDockerPollInterval
+const DefaultNodeDockerPollInterval = 250 * time.Millisecond
+
+// nodeDockerPollInterval returns the configured poll interval or the default
+func (o *Options) nodeDockerPollInterval() time.Duration {
+	if o.NodeDockerPollInterval == 0 {
+		return DefaultNodeDockerPollInterval
+	}
+	return o.NodeDockerPollInterval
+}
+
+// DefaultCreateAttempts is how many times provisioning a node is attempted
+// by default, that is once and then 3 retries, see Options.CreateAttempts
+const DefaultCreateAttempts = 4
+
+// DefaultSignalStartRetries is how many times a node that does not start
+// booting after SignalStartPhase is signaled again
+const DefaultSignalStartRetries = 1
+
+// signalStartProbeTimeout is how long a node is given to start booting after
+// it is signaled, it is a variable so that tests may shorten it
+var signalStartProbeTimeout = 5 * time.Second
+
+// signalStartRetries returns the configured signal retries or the default,
+// negative values disable the retries
+func (o *Options) signalStartRetries() int {
+	if o.SignalStartRetries == 0 {
+		return DefaultSignalStartRetries
+	}
+	if o.SignalStartRetries < 0 {
+		return 0
+	}
+	return o.SignalStartRetries
+}
+
+// DefaultCreateBackoff is the default wait before the first node provisioning
+// retry, see Options.CreateBackoff
+const DefaultCreateBackoff = time.Second
+
+// DefaultProvisionTimeout is how long to wait for all of the node containers
+// to be provisioned by default, see Options.ProvisionTimeout
+const DefaultProvisionTimeout = 30 * time.Minute
+
+// provisionTimeout returns the configured provision timeout or the default
+func (o *Options) provisionTimeout() time.Duration {
+	if o.ProvisionTimeout == 0 {
+		return DefaultProvisionTimeout
+	}
+	return o.ProvisionTimeout
+}
+
+// DefaultMaxConcurrency is how many node containers are created at once by
+// default, see Options.MaxConcurrency
+const DefaultMaxConcurrency = 4
+
+// listContainers, listClusterNodes, ensureImages, createContainer,
+// fixupContainer and fixMounts list the existing containers and the nodes of
+// a cluster, pull the node images, create and fix up the node containers and
+// fix their mounts, these are variables so that tests may fake them
+var (
+	listContainers   = containerNames
+	listClusterNodes = clusterNodes
+	ensureImages     = ensureNodeImages
+	createContainer  = (*nodeSpec).Create
+	fixupContainer   = fixupNode
+	fixMounts        = (*nodes.Node).FixMounts
+)
+
+// the known node roles
+var knownRoles = sets.NewString(
+	constants.ExternalLoadBalancerNodeRoleValue,
+	constants.ExternalEtcdNodeRoleValue,
+	constants.ControlPlaneNodeRoleValue,
+	constants.WorkerNodeRoleValue,
+)
+
+// provisioning order for nodes by role, it is never modified and only read
+// through DefaultRoleOrder, see Options.RoleOrder
 var defaultRoleOrder = []string{
 	constants.ExternalLoadBalancerNodeRoleValue,
 	constants.ExternalEtcdNodeRoleValue,
@@ -39,14 +140,125 @@ var defaultRoleOrder = []string{
 	constants.WorkerNodeRoleValue,
 }
 
-// sorts nodes for provisioning
-func sortNodes(nodes []config.Node, roleOrder []string) {
+// DefaultRoleOrder returns a copy of the order in which nodes are
+// provisioned by role for clusters without Options.RoleOrder
+func DefaultRoleOrder() []string {
+	return append([]string{}, defaultRoleOrder...)
+}
+
+// validateRoleOrder checks that roleOrder only contains known roles, each at
+// most once. Unknown roles are an error rather than being provisioned last.
+func validateRoleOrder(roleOrder []string) error {
+	seen := sets.NewString()
+	for _, role := range roleOrder {
+		if !knownRoles.Has(role) {
+			return errors.Errorf("unknown node role in role order: %q", role)
+		}
+		if seen.Has(role) {
+			return errors.Errorf("node role %q is in the role order more than once", role)
+		}
+		seen.Insert(role)
+	}
+	return nil
+}
+
+// validateNodes checks that cfg describes nodes that make up a working
+// cluster, so that provisioning fails before any container is created
+func validateNodes(cfg *config.Config) error {
+	if len(cfg.Nodes) == 0 {
+		// see implicitNodes
+		return nil
+	}
+	numByRole := map[string]int32{}
+	for i, node := range cfg.Nodes {
+		role := string(node.Role)
+		if !knownRoles.Has(role) {
+			return errors.Errorf("node %d has unknown node role: %q", i, role)
+		}
+		replicas := int32(1)
+		if node.Replicas != nil {
+			replicas = *node.Replicas
+		}
+		if replicas < 0 {
+			return errors.Errorf("node %d has negative replicas: %d", i, replicas)
+		}
+		numByRole[role] += replicas
+	}
+	numControlPlane := numByRole[constants.ControlPlaneNodeRoleValue]
+	if numControlPlane < 1 {
+		return errors.Errorf("at least one %s node is required", constants.ControlPlaneNodeRoleValue)
+	}
+	return nil
+}
+
+// dropUnneededLoadBalancer returns nodes without the external load balancer
+// if there is a single control plane node, as there is nothing to balance,
+// unless keep is set
+func dropUnneededLoadBalancer(nodes []config.Node, keep bool) []config.Node {
+	if keep {
+		return nodes
+	}
+	numControlPlane := 0
+	for _, node := range nodes {
+		if node.Role == config.ControlPlaneRole {
+			numControlPlane++
+		}
+	}
+	if numControlPlane != 1 {
+		return nodes
+	}
+	out := []config.Node{}
+	for _, node := range nodes {
+		if node.Role == config.ExternalLoadBalancerRole {
+			log.Warnf(
+				"Not creating the %s node, it is not needed with a single %s node",
+				constants.ExternalLoadBalancerNodeRoleValue, constants.ControlPlaneNodeRoleValue,
+			)
+			continue
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// namePrefix returns the configured node name prefix or clusterName
+func (o *Options) namePrefix(clusterName string) string {
+	if o.NamePrefix == "" {
+		return clusterName
+	}
+	return o.NamePrefix
+}
+
+// roleOrder returns the configured role order or the default, see
+// DefaultRoleOrder
+func (o *Options) roleOrder() []string {
+	if o.RoleOrder == nil {
+		return DefaultRoleOrder()
+	}
+	return o.RoleOrder
+}
+
+// sorts nodes for provisioning by role, and nodes with the same role by
+// name so that the same nodes are always provisioned in the same order
+func sortNodes(nodes []nodeSpec, roleOrder []string) {
 	roleToOrder := makeRoleToOrder(roleOrder)
 	sort.SliceStable(nodes, func(i, j int) bool {
-		return roleToOrder(string(nodes[i].Role)) < roleToOrder(string(nodes[j].Role))
+		if nodes[i].Role != nodes[j].Role {
+			return roleToOrder(nodes[i].Role) < roleToOrder(nodes[j].Role)
+		}
+		return nodeNameLess(nodes[i].Name, nodes[j].Name)
 	})
 }
 
+// nodeNameLess orders shorter names first, so that the names numbered by
+// makeNodeNamer sort numerically, e.g. kind-worker2 before kind-worker10
+func nodeNameLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
 // helper to convert an ordered slice of roles to a mapping of provisioning
 // role to provisioning order
 func makeRoleToOrder(roleOrder []string) func(string) int {
@@ -63,8 +275,46 @@ func makeRoleToOrder(roleOrder []string) func(string) int {
 	}
 }
 
+// implicitNodes returns the nodes of a config without nodes, a single
+// control plane node with the default image, see nodeImage
+func implicitNodes() []config.Node {
+	return []config.Node{{Role: config.ControlPlaneRole}}
+}
+
+// nodeImage returns the image of node, or else the default image of its role
+// in roleImages, or else the default node image
+func nodeImage(node config.Node, roleImages map[string]string) string {
+	if node.Image != "" {
+		return node.Image
+	}
+	// nodes without a role are control plane nodes, see config defaulting
+	role := node.Role
+	if role == "" {
+		role = config.ControlPlaneRole
+	}
+	if image := roleImages[string(role)]; image != "" {
+		return image
+	}
+	return defaults.Image
+}
+
+// validateRoleImages checks that the role default images are for known roles
+func validateRoleImages(roleImages map[string]string) error {
+	for role, image := range roleImages {
+		if !knownRoles.Has(role) {
+			return errors.Errorf("unknown node role for a default image: %q", role)
+		}
+		if image == "" {
+			return errors.Errorf("default image for node role %q must not be empty", role)
+		}
+	}
+	return nil
+}
+
+// convertReplicas expands each node into one node per replica, expanding
+// the replica index in the ExtraMounts host paths, see expandMountHostPath
 // TODO(bentheelder): eliminate this when we have v1alpha3
-func convertReplicas(nodes []config.Node) []config.Node {
+func convertReplicas(nodes []config.Node) ([]config.Node, error) {
 	out := []config.Node{}
 	for _, node := range nodes {
 		replicas := int32(1)
@@ -74,166 +324,1170 @@ func convertReplicas(nodes []config.Node) []config.Node {
 		for i := int32(0); i < replicas; i++ {
 			outNode := node.DeepCopy()
 			outNode.Replicas = nil
+			for j := range outNode.ExtraMounts {
+				hostPath, err := expandMountHostPath(outNode.ExtraMounts[j].HostPath, int(i))
+				if err != nil {
+					return nil, err
+				}
+				outNode.ExtraMounts[j].HostPath = hostPath
+			}
 			out = append(out, *outNode)
 		}
 	}
-	return out
+	return out, nil
+}
+
+// expandMountHostPath expands hostPath as a text/template with the
+// zero-based replica index as .Index, eg /data/{{.Index}}, so that each
+// replica can mount a distinct host path. Paths without template actions
+// are returned unchanged.
+func expandMountHostPath(hostPath string, index int) (string, error) {
+	if !strings.Contains(hostPath, "{{") {
+		return hostPath, nil
+	}
+	t, err := template.New("hostPath").Option("missingkey=error").Parse(hostPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid mount host path template %q", hostPath)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, struct{ Index int }{Index: index}); err != nil {
+		return "", errors.Wrapf(err, "failed to expand mount host path template %q", hostPath)
+	}
+	return buf.String(), nil
 }
 
 // provisionNodes takes care of creating all the containers
-// that will host `kind` nodes
+// that will host `kind` nodes, it returns the nodes that are ready
 func provisionNodes(
-	status *logutil.Status, cfg *config.Config, clusterName, clusterLabel string,
-) error {
+	ctx context.Context, status *logutil.Status, cfg *config.Config, clusterName string, clusterLabel nodes.ClusterLabel, opts *Options,
+) ([]nodes.Node, error) {
 	defer status.End(false)
 
-	_, err := createNodeContainers(status, cfg, clusterName, clusterLabel)
+	if err := validateNodes(cfg); err != nil {
+		return nil, err
+	}
+
+	// every node provisioned by this call is labeled with the same generation
+	generation, err := newGeneration()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	opts.generation = generation
+	log.Debugf("Provisioning generation %s", generation)
+
+	if err := checkCPUGovernor(opts.CPUGovernorCheck); err != nil {
+		return nil, err
+	}
+
+	if opts.Force && !opts.DryRun {
+		if err := deleteExistingNodes(clusterLabel); err != nil {
+			return nil, err
+		}
+	}
+
+	// the networks created for the cluster, deleted if provisioning fails
+	createdNetworks := []string{}
+	deleteCreatedNetworks := func() {
+		for _, network := range createdNetworks {
+			deleteUnusedNetwork(network)
+		}
+	}
+
+	if opts.Macvlan != nil && !opts.DryRun {
+		network, created, err := ensureMacvlanNetwork(opts.Macvlan, clusterName, opts.networkLabels(clusterLabel)...)
+		if err != nil {
+			return nil, err
+		}
+		opts.networks = append(opts.networks, network)
+		if created {
+			createdNetworks = append(createdNetworks, network)
+		}
+	}
+
+	if !opts.DryRun {
+		network, created, err := ensureNodeNetwork(opts, clusterName, opts.networkLabels(clusterLabel)...)
+		if err != nil {
+			deleteCreatedNetworks()
+			return nil, err
+		}
+		opts.network = network
+		if created {
+			createdNetworks = append(createdNetworks, network)
+		}
+	}
+
+	result, err := createNodeContainers(ctx, status, cfg, clusterName, clusterLabel, opts)
+	if opts.DryRun {
+		return nil, err
+	}
+	if err != nil {
+		deleteCreatedNetworks()
+	}
+	if opts.ResultsFile != "" {
+		if writeErr := writeResultsFile(opts.ResultsFile, clusterName, result, err); writeErr != nil {
+			log.Errorf("Failed to write provisioning results: %v", writeErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.HostsFile != "" {
+		if err := writeHostsFile(opts.HostsFile, clusterName, result.Ready); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Skipped) > 0 {
+		log.Warnf(
+			"Provisioned %d nodes, skipped %d nodes: %s",
+			len(result.Ready), len(result.Skipped), strings.Join(result.Skipped, ", "),
+		)
 	}
 
 	status.End(true)
+	return result.Ready, nil
+}
+
+// mutateNodes calls mutate with each of desiredNodes, see Options.MutateNode
+func mutateNodes(desiredNodes []nodeSpec, mutate func(*PlannedNode) error) error {
+	if mutate == nil {
+		return nil
+	}
+	for i := range desiredNodes {
+		name, role := desiredNodes[i].Name, desiredNodes[i].Role
+		if err := mutate((*PlannedNode)(&desiredNodes[i])); err != nil {
+			return errors.Wrapf(err, "node %s was rejected", name)
+		}
+		if desiredNodes[i].Name != name || desiredNodes[i].Role != role {
+			return errors.Errorf("the name and role of node %s may not be changed", name)
+		}
+	}
+	return nil
+}
+
+// maxNodeIcons is the most node icons shown in the status, see nodeIcons
+const maxNodeIcons = 10
+
+// nodeIcons returns an icon per node for the status, or a single icon with
+// the count for more than maxNodeIcons nodes so that the status fits the
+// terminal
+func nodeIcons(count int) string {
+	if count > maxNodeIcons {
+		return fmt.Sprintf("📦×%d", count)
+	}
+	return strings.Repeat("📦", count)
+}
+
+// newGeneration returns a random ID for a provisioning attempt
+func newGeneration() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate the provisioning generation")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// deleteExistingNodes deletes the node containers left over from previous
+// attempts to create the cluster identified by clusterLabel
+func deleteExistingNodes(clusterLabel nodes.ClusterLabel) error {
+	existing, err := nodes.List(clusterLabel.Filter())
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	for _, node := range existing {
+		log.Infof("Deleting existing node container %s", node.Name())
+	}
+	if err := nodes.Delete(existing...); err != nil {
+		return errors.Wrap(err, "failed to delete existing node containers")
+	}
 	return nil
 }
 
+// validateConfigDir checks that the host directory mounted as the node's
+// config dir, if any, exists and is not empty
+func validateConfigDir(desiredNode nodeSpec) error {
+	for _, mount := range desiredNode.ExtraMounts {
+		if mount.ContainerPath != constants.NodeConfigDirPath {
+			continue
+		}
+		entries, err := ioutil.ReadDir(mount.HostPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", mount.HostPath)
+		}
+		if len(entries) == 0 {
+			return errors.Errorf("%s is empty", mount.HostPath)
+		}
+	}
+	return nil
+}
+
+// validateSeccompProfile checks that the seccomp profile file, if any,
+// exists and is JSON
+func validateSeccompProfile(path string) error {
+	if path == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+	var profile map[string]interface{}
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return nil
+}
+
+// mergeResources returns base with the fields set in override replaced
+func mergeResources(base config.NodeResources, override *config.NodeResources) config.NodeResources {
+	if override == nil {
+		return base
+	}
+	if override.CPUs != "" {
+		base.CPUs = override.CPUs
+	}
+	if override.Memory != "" {
+		base.Memory = override.Memory
+	}
+	if override.MemorySwap != "" {
+		base.MemorySwap = override.MemorySwap
+	}
+	if override.PidsLimit != 0 {
+		base.PidsLimit = override.PidsLimit
+	}
+	return base
+}
+
+// dockerResources converts the resource quantities to the docker run
+// --cpus, --memory and --memory-swap formats
+func dockerResources(resources config.NodeResources) (cpus, memory, memorySwap string, err error) {
+	if err := resources.Validate(); err != nil {
+		return "", "", "", err
+	}
+	if resources.CPUs != "" {
+		quantity := resource.MustParse(resources.CPUs)
+		cpus = strconv.FormatFloat(float64(quantity.MilliValue())/1000, 'f', -1, 64)
+	}
+	if resources.Memory != "" {
+		quantity := resource.MustParse(resources.Memory)
+		memory = strconv.FormatInt(quantity.Value(), 10)
+	}
+	if resources.MemorySwap != "" {
+		quantity := resource.MustParse(resources.MemorySwap)
+		memorySwap = strconv.FormatInt(quantity.Value(), 10)
+	}
+	return cpus, memory, memorySwap, nil
+}
+
+// validateInitScript checks that the init script, if any, is an executable
+// file
+func validateInitScript(path string) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat %s", path)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return errors.Errorf("%s is not an executable file", path)
+	}
+	return nil
+}
+
+// provisionResult reports the outcome of createNodeContainers
+type provisionResult struct {
+	// Planned are all of the nodes that were to be provisioned
+	Planned []nodeSpec
+	// Ready are the nodes that were provisioned successfully
+	Ready []nodes.Node
+	// Skipped are the names of the nodes that failed or were abandoned
+	// once the quorum was met, these nodes are removed
+	Skipped []string
+}
+
+// nodeResult is the outcome of provisioning a single node, node may be
+// non-nil even if err is set when the container was created
+type nodeResult struct {
+	spec nodeSpec
+	node *nodes.Node
+	err  error
+}
+
 func createNodeContainers(
-	status *logutil.Status, cfg *config.Config, clusterName, clusterLabel string,
-) ([]nodes.Node, error) {
+	ctx context.Context, status *logutil.Status, cfg *config.Config, clusterName string, clusterLabel nodes.ClusterLabel, opts *Options,
+) (*provisionResult, error) {
 	defer status.End(false)
 
 	// create all of the node containers, concurrently
-	desiredNodes := nodesToCreate(cfg, clusterName)
-	status.Start("Preparing nodes " + strings.Repeat("📦", len(desiredNodes)))
-	nodeChan := make(chan *nodes.Node, len(desiredNodes))
-	errChan := make(chan error)
-	defer close(nodeChan)
-	defer close(errChan)
+	maxNodes, err := nodeBudget(opts.MaxNodes)
+	if err != nil {
+		return nil, err
+	}
+	var desiredNodes []nodeSpec
+	if opts.plan != nil {
+		if err := checkNodeBudget(len(opts.plan), maxNodes); err != nil {
+			return nil, err
+		}
+		for _, plannedNode := range opts.plan {
+			desiredNodes = append(desiredNodes, nodeSpec(plannedNode))
+		}
+	} else {
+		desiredNodes, err = nodesToCreate(cfg, opts.namePrefix(clusterName), opts.roleOrder(), opts.RoleImages, opts.KeepLoadBalancer, maxNodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := validateNodeNames(desiredNodes); err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateNodeNames(desiredNodes); err != nil {
+		return nil, err
+	}
+	if err := validateHostnames(desiredNodes); err != nil {
+		return nil, err
+	}
+	if err := checkLoadBalancerPort(desiredNodes, opts.LoadBalancerPort); err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		// the nodes are printed as planned, without checking the existing
+		// containers or anything else docker
+		out := opts.out
+		if out == nil {
+			out = os.Stdout
+		}
+		return &provisionResult{Planned: desiredNodes}, printPlan(out, desiredNodes)
+	}
+	if err := assignAdoptedNodes(desiredNodes, opts.AdoptNodes); err != nil {
+		return nil, err
+	}
+	planLogger := opts.logger(PlanLogPhase)
+	if err := resolveNameCollisions(desiredNodes, opts.NameCollision, planLogger); err != nil {
+		return nil, err
+	}
+	// adopting and renaming nodes may make their names collide again, and
+	// the suffixed names may be too long
+	if err := checkDuplicateNodeNames(desiredNodes); err != nil {
+		return nil, err
+	}
+	if err := validateNodeNames(desiredNodes); err != nil {
+		return nil, err
+	}
+	opts.adopted = adoptedNodeNames(desiredNodes)
+	envLabels := labelsFromEnv(opts.EnvLabels, planLogger)
+	if opts.TestRunID != "" {
+		envLabels[constants.TestRunLabelKey] = opts.TestRunID
+	}
+	if opts.generation != "" {
+		envLabels[constants.GenerationLabelKey] = opts.generation
+	}
+	for i := range desiredNodes {
+		desiredNodes[i].ContainerLabels = mergeLabels(envLabels, desiredNodes[i].ContainerLabels)
+		desiredNodes[i].Network = opts.network
+		desiredNodes[i].Networks = opts.networks
+		desiredNodes[i].Sysctls = ipFamilySysctls(opts.IPFamily)
+		if desiredNodes[i].Role == constants.ExternalLoadBalancerNodeRoleValue {
+			desiredNodes[i].APIServerHostPort = opts.LoadBalancerPort
+		}
+		if opts.HostGateway {
+			desiredNodes[i].ExtraHosts = append(desiredNodes[i].ExtraHosts, opts.hostGatewayAlias()+":host-gateway")
+		}
+	}
+	if err := mutateNodes(desiredNodes, opts.MutateNode); err != nil {
+		return nil, err
+	}
+	if err := checkAPIServerHostPorts(desiredNodes); err != nil {
+		return nil, err
+	}
 	for _, desiredNode := range desiredNodes {
-		desiredNode := desiredNode // capture loop variable
-		go func() {
-			// create the node into a container (docker run, but it is paused, see createNode)
-			node, err := desiredNode.Create(clusterLabel)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			err = fixupNode(node)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			nodeChan <- node
-		}()
-	}
-
-	// collect nodes
-	allNodes := []nodes.Node{}
-	for {
-		select {
-		case node := <-nodeChan:
+		if err := validateConfigDir(desiredNode); err != nil {
+			return nil, errors.Wrapf(err, "invalid config dir for node %s", desiredNode.Name)
+		}
+		if err := validateSeccompProfile(desiredNode.SeccompProfile); err != nil {
+			return nil, errors.Wrapf(err, "invalid seccomp profile for node %s", desiredNode.Name)
+		}
+		if err := validateInitScript(desiredNode.InitScript); err != nil {
+			return nil, errors.Wrapf(err, "invalid init script for node %s", desiredNode.Name)
+		}
+		if desiredNode.PullConfig == "" {
+			continue
+		}
+		if err := docker.ValidatePullConfig(desiredNode.PullConfig); err != nil {
+			return nil, errors.Wrapf(err, "invalid pull config for node %s", desiredNode.Name)
+		}
+	}
+	if !annotationsSupported(desiredNodes, planLogger) {
+		for i := range desiredNodes {
+			desiredNodes[i].Annotations = nil
+		}
+	}
+	imageLoadNodes := 0
+	for _, desiredNode := range desiredNodes {
+		if opts.loadsImages(desiredNode) {
+			imageLoadNodes++
+		}
+	}
+	imageLoads, err := newImageLoadLimiter(opts.ImageLoadBatchSize, imageLoadNodes, opts.logger(ImageLoadLogPhase))
+	if err != nil {
+		return nil, err
+	}
+	opts.imageLoads = imageLoads
+	maxConcurrency := opts.MaxConcurrency
+	if maxConcurrency == 0 {
+		maxConcurrency = DefaultMaxConcurrency
+	}
+	opts.createSlots = newCreateSlots(maxConcurrency)
+	// attempt to explicitly pull the node images if they don't exist locally,
+	// once per image rather than once per node as each node is created.
+	// we don't care if this errors, we'll still try to run which also pulls
+	if opts.EstimateDownloads {
+		reportImageDownloads(status, desiredNodes, opts.logger(ImageLoadLogPhase))
+	}
+	ensureImages(status, desiredNodes, opts.logger(ImageLoadLogPhase))
+	// NOTE: the result is returned along with any later error
+	result := &provisionResult{Planned: desiredNodes}
+	// the nodes are ready in completion order, which varies between runs
+	defer func() {
+		sortReadyNodes(result.Ready, desiredNodes)
+	}()
+	minReady, err := quorumSize(desiredNodes, opts.MinReadyNodes, opts.MaxWorkerFailures)
+	if err != nil {
+		return result, err
+	}
+	preparing := "Preparing nodes " + nodeIcons(len(desiredNodes))
+	status.Start(preparing)
+	// NOTE: results is buffered and never closed so that nodes still being
+	// provisioned when we return early can always report their result
+	results := make(chan nodeResult, len(desiredNodes))
+	abandoned := make(chan struct{})
+	created := func(desiredNode nodeSpec, node *nodes.Node) {}
+	if opts.OnAPIServerEndpoint != nil {
+		created = makeEndpointNotifier(desiredNodes, opts.OnAPIServerEndpoint)
+	}
+	// a node that never reports its result must not hang provisioning
+	timeout := time.NewTimer(opts.provisionTimeout())
+	defer timeout.Stop()
+	// failures are the nodes that failed in the current stage, and failed
+	// the containers to delete along with the ready ones on failure
+	failures := []nodeResult{}
+	failed := []nodes.Node{}
+	stages := provisioningStages(desiredNodes, opts.BetweenRolesCommand)
+	for i, stage := range stages {
+		if err := ctx.Err(); err != nil {
+			cleanupFailedProvision(result, results, abandoned, nil, failed, opts.Retain)
+			return result, err
+		}
+		if i > 0 {
+			if err := runBetweenRolesCommand(opts.BetweenRolesCommand, stages[i-1][0].Role); err != nil {
+				cleanupFailedProvision(result, results, abandoned, nil, failed, opts.Retain)
+				return result, err
+			}
+		}
+		opts.createSlots.expect(stage)
+		for _, desiredNode := range stage {
+			desiredNode := desiredNode // capture loop variable
+			go func() {
+				// a node that fails before creating its container must not
+				// hold back the nodes waiting behind it for a creation slot
+				defer opts.createSlots.forget(desiredNode.Name)
+				// a panic fails the node like any other error, the container
+				// may have been created before it so it is deleted as well
+				defer func() {
+					if p := recover(); p != nil {
+						results <- nodeResult{
+							spec: desiredNode,
+							node: nodes.FromName(desiredNode.Name),
+							err:  errors.Errorf("panic provisioning node %s: %v\n%s", desiredNode.Name, p, debug.Stack()),
+						}
+					}
+				}()
+				node, err := provisionNode(ctx, desiredNode, clusterLabel, opts, abandoned, created)
+				results <- nodeResult{spec: desiredNode, node: node, err: err}
+			}()
+		}
+
+		// collect nodes
+		pending := sets.NewString()
+		for _, desiredNode := range stage {
+			pending.Insert(desiredNode.Name)
+		}
+		for pending.Len() > 0 {
+			var r nodeResult
+			select {
+			case r = <-results:
+				pending.Delete(r.spec.Name)
+			case <-ctx.Done():
+			case <-timeout.C:
+				// the outstanding nodes are not waited for, as they may never
+				// settle, their containers are deleted if and once created
+				outstanding := pending.List()
+				cleanupFailedProvision(result, results, abandoned, nil, failed, opts.Retain)
+				if !opts.Retain {
+					removeStragglers(results, outstanding, opts.adopted)
+				}
+				return result, errors.Errorf(
+					"timed out after %v provisioning nodes, outstanding nodes: %s",
+					opts.provisionTimeout(), strings.Join(outstanding, ", "),
+				)
+			}
+			if err := ctx.Err(); err != nil {
+				// stop creating nodes and delete the ones already created
+				if r.node != nil {
+					failed = append(failed, *r.node)
+				}
+				cleanupFailedProvision(result, results, abandoned, pending, failed, opts.Retain)
+				return result, err
+			}
+			if r.err != nil {
+				// only workers may be skipped, and only if a quorum or worker
+				// failure tolerance is configured
+				if minReady == len(desiredNodes) || r.spec.Role != constants.WorkerNodeRoleValue {
+					// the other nodes of the stage are still waited for, to
+					// report all of the failures at once
+					failures = append(failures, r)
+					if r.node != nil {
+						failed = append(failed, *r.node)
+					}
+					continue
+				}
+				opts.logger(CreateLogPhase).Warnf("Skipping node %s: %v", r.spec.Name, r.err)
+				result.Skipped = append(result.Skipped, r.spec.Name)
+				// adopted nodes existed before provisioning and are kept,
+				// see cleanupFailedProvision
+				if r.node != nil && !r.spec.Adopted {
+					removeNodes(*r.node)
+				}
+				if len(desiredNodes)-len(result.Skipped) < minReady {
+					cleanupFailedProvision(result, results, abandoned, pending, failed, opts.Retain)
+					return result, errors.Errorf(
+						"cannot provision the minimum of %d ready nodes, skipped nodes: %s",
+						minReady, strings.Join(result.Skipped, ", "),
+					)
+				}
+				continue
+			}
 			// TODO(bentheelder): nodes should maybe not be pointers /shrug
-			allNodes = append(allNodes, *node)
-			if len(allNodes) == len(desiredNodes) {
+			result.Ready = append(result.Ready, *r.node)
+			status.Update(fmt.Sprintf("%s (%d/%d ready)", preparing, len(result.Ready), len(desiredNodes)))
+			if opts.AbandonStragglers && len(failures) == 0 && quorumMet(desiredNodes, result.Ready, minReady) {
+				// skip the remaining nodes, including those in later stages
+				abandonStragglers(results, abandoned, pending.List(), opts.adopted)
+				result.Skipped = append(result.Skipped, pending.List()...)
+				for _, later := range stages[i+1:] {
+					for _, desiredNode := range later {
+						result.Skipped = append(result.Skipped, desiredNode.Name)
+					}
+				}
 				status.End(true)
-				return allNodes, nil
+				return result, nil
 			}
-		case err := <-errChan:
-			return nil, err
+		}
+		if len(failures) > 0 {
+			cleanupFailedProvision(result, results, abandoned, nil, failed, opts.Retain)
+			return result, provisionError(failures)
 		}
 	}
+	status.End(true)
+	return result, nil
 }
 
-func fixupNode(node *nodes.Node) error {
-	// we need to change a few mounts once we have the container
-	// we'd do this ahead of time if we could, but --privileged implies things
-	// that don't seem to be configurable, and we need that flag
-	if err := node.FixMounts(); err != nil {
-		// TODO(bentheelder): logging here
-		return err
+// sortReadyNodes sorts the ready nodes in provisioning order, the order of
+// desiredNodes, see sortNodes
+func sortReadyNodes(ready []nodes.Node, desiredNodes []nodeSpec) {
+	position := make(map[string]int, len(desiredNodes))
+	for i, desiredNode := range desiredNodes {
+		position[desiredNode.Name] = i
 	}
+	sort.SliceStable(ready, func(i, j int) bool {
+		return position[ready[i].Name()] < position[ready[j].Name()]
+	})
+}
+
+// provisionError returns the error of the single failed node as is, or an
+// error listing the error of each failed node by node name
+func provisionError(failures []nodeResult) error {
+	if len(failures) == 1 {
+		return failures[0].err
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].spec.Name < failures[j].spec.Name
+	})
+	errs := []error{errors.Errorf("%d nodes failed to provision", len(failures))}
+	for _, failure := range failures {
+		errs = append(errs, errors.Wrapf(failure.err, "node %s", failure.spec.Name))
+	}
+	return util.NewErrors(errs)
+}
 
-	if nodes.NeedProxy() {
-		if err := node.SetProxy(); err != nil {
-			// TODO: logging here
-			return errors.Wrapf(err, "failed to set proxy for node %s", node.Name())
+// provisionNode provisions desiredNode with provisionNodeOnce, retrying
+// failures up to the configured number of attempts with a doubling backoff.
+// The container from a failed attempt is deleted before retrying so that the
+// new container does not collide with its name. Adopted nodes are not
+// retried, as their containers cannot be recreated.
+func provisionNode(
+	ctx context.Context, desiredNode nodeSpec, clusterLabel nodes.ClusterLabel, opts *Options,
+	abandoned <-chan struct{}, created func(nodeSpec, *nodes.Node),
+) (*nodes.Node, error) {
+	attempts, backoff := opts.CreateAttempts, opts.CreateBackoff
+	if attempts == 0 {
+		attempts = DefaultCreateAttempts
+	}
+	if backoff == 0 {
+		backoff = DefaultCreateBackoff
+	}
+	if desiredNode.Adopted {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		node, err := provisionNodeOnce(ctx, desiredNode, clusterLabel, opts, abandoned, created)
+		if err == nil || attempt == attempts {
+			return node, err
+		}
+		opts.logger(CreateLogPhase).Warnf(
+			"Failed to provision node %s (attempt %d of %d), retrying in %v: %v",
+			desiredNode.Name, attempt, attempts, backoff, err,
+		)
+		if node != nil {
+			removeNodes(*node)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-abandoned:
+			return nil, errors.Errorf("node %s was abandoned", desiredNode.Name)
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
+		backoff *= 2
 	}
+}
 
-	// signal the node container entrypoint to continue booting into systemd
-	if err := node.SignalStart(); err != nil {
-		// TODO(bentheelder): logging here
-		return err
+// provisionNodeOnce creates or adopts the node for desiredNode and fixes it
+// up, if abandoned is closed once the node is created the node is removed.
+// No new container is created once ctx is done.
+// created is called as soon as the node container exists.
+func provisionNodeOnce(
+	ctx context.Context, desiredNode nodeSpec, clusterLabel nodes.ClusterLabel, opts *Options,
+	abandoned <-chan struct{}, created func(nodeSpec, *nodes.Node),
+) (*nodes.Node, error) {
+	var node *nodes.Node
+	var err error
+	logger := opts.logger(CreateLogPhase)
+	if desiredNode.Adopted {
+		// the container already exists, validate it and only fix it up
+		logger.Debugf("Adopting node %s", desiredNode.Name)
+		node, err = desiredNode.Adopt(clusterLabel)
+	} else {
+		logger.Debugf("Creating node %s with image %s", desiredNode.Name, desiredNode.Image)
+		// create the node into a container (docker run, but it is paused, see createNode)
+		// once fewer than MaxConcurrency nodes are being created
+		// and no node with a higher creation priority is waiting
+		if err := opts.createSlots.acquire(ctx, abandoned, desiredNode.Name); err != nil {
+			return nil, err
+		}
+		// the context may have been cancelled while waiting for the slot
+		if err := ctx.Err(); err != nil {
+			opts.createSlots.release()
+			return nil, err
+		}
+		opts.startPhase(desiredNode.Name, CreatePhase)
+		node, err = createContainer(&desiredNode, clusterLabel)
+		opts.createSlots.release()
+	}
+	if err != nil {
+		// the container may exist even if creating it failed
+		return node, err
+	}
+	created(desiredNode, node)
+	select {
+	case <-abandoned:
+		if !desiredNode.Adopted {
+			removeNodes(*node)
+		}
+		return nil, errors.Errorf("node %s was abandoned", desiredNode.Name)
+	default:
+	}
+	if err := opts.injectedFailure(node.Name(), CreatePhase); err != nil {
+		return node, err
 	}
+	phases := opts.fixupPhases()
+	if len(desiredNode.Entrypoint) > 0 {
+		// the boot phases depend on the default entrypoint, see SkipBootPhases
+		phases = withoutPhases(phases, bootPhases)
+	}
+	if !opts.loadsImages(desiredNode) {
+		phases = withoutPhases(phases, []string{LoadImagesPhase})
+	}
+	if opts.SkipMountFixup {
+		opts.logger(FixupLogPhase).Debugf("Skipping the mount fixup on node %s", desiredNode.Name)
+		phases = withoutPhases(phases, []string{FixMountsPhase})
+	}
+	if opts.PauseAfterMounts {
+		opts.logger(FixupLogPhase).Debugf("Leaving node %s waiting to boot", desiredNode.Name)
+		phases = withoutPhases(phases, bootPhases)
+	}
+	if err := fixupContainer(node, desiredNode, phases, opts); err != nil {
+		return node, err
+	}
+	if opts.VerifyMounts {
+		if err := verifyMounts(node, desiredNode.ExtraMounts); err != nil {
+			return node, err
+		}
+	}
+	// the token is generated before provisioning, so it can be distributed
+	// ahead of the control plane bootstrap, which creates it with kubeadm init
+	if opts.PreplaceJoinToken && desiredNode.Role == constants.WorkerNodeRoleValue {
+		if err := node.WriteFile(kubeadm.JoinTokenPath, opts.joinToken); err != nil {
+			return node, errors.Wrap(err, "failed to write join token")
+		}
+	}
+	return node, nil
+}
+
+// fixupNode runs each of the fixup phases against node, in order.
+// NOTE: fixup only executes tools inside the node container and copies files
+// into it from the host, it does not use any helper images.
+func fixupNode(node *nodes.Node, desiredNode nodeSpec, phases []string, opts *Options) error {
+	logger := opts.logger(FixupLogPhase)
+	for _, phase := range phases {
+		logger.Debugf("Running fixup phase %s on node %s", phase, node.Name())
+		opts.startPhase(node.Name(), phase)
+		if err := opts.injectedFailure(node.Name(), phase); err != nil {
+			return err
+		}
+		if err := fixupNodePhase(node, desiredNode, phase, opts); err != nil {
+			return err
+		}
+	}
+	if opts.WaitForNetwork > 0 {
+		return waitForNodeIP(node, opts.WaitForNetwork, opts.logger(FixupLogPhase))
+	}
+	return nil
+}
+
+// nodeLogsTailLines is how many lines of the node container logs are
+// included in the error when the node does not boot, see nodeLogsTail
+const nodeLogsTailLines = 50
 
-	// wait for docker to be ready
-	if !node.WaitForDocker(time.Now().Add(time.Second * 30)) {
-		// TODO(bentheelder): logging here
-		return errors.Errorf("timed out waiting for docker to be ready on node %s", node.Name())
+// nodeLogsTail returns the last lines of the node container logs, which are
+// mostly systemd's, to diagnose why a node did not boot, formatted to be
+// appended to an error message
+func nodeLogsTail(node *nodes.Node) string {
+	lines, err := docker.LogsTail(node.Name(), nodeLogsTailLines)
+	if err != nil {
+		return fmt.Sprintf(" (failed to get the node logs: %v)", err)
+	}
+	if len(lines) == 0 {
+		return ", the node has no logs"
 	}
+	return fmt.Sprintf(
+		", last %d lines of the node logs:\n%s", len(lines), strings.Join(lines, "\n"),
+	)
+}
 
-	// load the docker image artifacts into the docker daemon
-	node.LoadImages()
+func fixupNodePhase(node *nodes.Node, desiredNode nodeSpec, phase string, opts *Options) error {
+	switch phase {
+	case FixMountsPhase:
+		// we need to change a few mounts once we have the container
+		// we'd do this ahead of time if we could, but --privileged implies things
+		// that don't seem to be configurable, and we need that flag
+		if err := fixMounts(node); err != nil {
+			opts.logger(FixupLogPhase).WithError(err).Warningf("Failed to fix mounts on node %s", node.Name())
+			return errors.Wrapf(err, "failed to fix mounts on node %s", node.Name())
+		}
 
+	case SetProxyPhase:
+		// the node's own proxy settings replace the host's
+		if desiredNode.ProxyEnv != nil {
+			if err := node.SetProxyEnv(desiredNode.ProxyEnv); err != nil {
+				opts.logger(FixupLogPhase).WithError(err).Warningf("Failed to set proxy for node %s", node.Name())
+				return errors.Wrapf(err, "failed to set proxy for node %s", node.Name())
+			}
+			break
+		}
+		needProxy, err := nodes.NeedProxy()
+		if err != nil {
+			if !opts.IgnoreProxyDetectionErrors {
+				return errors.Wrapf(err, "failed to detect proxy for node %s", node.Name())
+			}
+			opts.logger(FixupLogPhase).WithError(err).Warningf("Failed to detect proxy for node %s, not setting proxy", node.Name())
+			needProxy = false
+		}
+		if needProxy {
+			if err := node.SetProxy(); err != nil {
+				opts.logger(FixupLogPhase).WithError(err).Warningf("Failed to set proxy for node %s", node.Name())
+				return errors.Wrapf(err, "failed to set proxy for node %s", node.Name())
+			}
+		}
+
+	case SignalStartPhase:
+		// signal the node container entrypoint to continue booting into
+		// systemd, signaling it again if it missed the signal
+		retries := opts.signalStartRetries()
+		for attempt := 0; ; attempt++ {
+			if err := node.SignalStart(); err != nil {
+				opts.logger(FixupLogPhase).WithError(err).Warningf("Failed to signal node %s to start", node.Name())
+				return errors.Wrapf(err, "failed to signal node %s to start", node.Name())
+			}
+			if retries == 0 {
+				break
+			}
+			if _, booting := node.WaitForInit(time.Now().Add(signalStartProbeTimeout), opts.nodeDockerPollInterval()); booting {
+				break
+			}
+			if attempt == retries {
+				// the stuck boot is reported by WaitForDockerPhase
+				opts.logger(FixupLogPhase).Warningf("Node %s did not start booting after %d signals", node.Name(), attempt+1)
+				break
+			}
+			opts.logger(FixupLogPhase).Warningf("Node %s did not start booting, signaling it again", node.Name())
+		}
+
+	case WaitForDockerPhase:
+		// wait for docker to be ready, the timeout applies to each node
+		timeout := opts.NodeDockerTimeout
+		if timeout == 0 {
+			timeout = DefaultNodeDockerTimeout
+		}
+		// containerd nodes have no docker, wait for containerd instead
+		if desiredNode.Runtime == constants.ContainerdNodeRuntimeValue {
+			elapsed, ready := node.WaitForContainerd(time.Now().Add(timeout), opts.nodeDockerPollInterval())
+			if !ready {
+				opts.logger(FixupLogPhase).Warningf("Containerd was not ready on node %s after %v", node.Name(), timeout)
+				return errors.Errorf(
+					"timed out waiting for containerd to be ready on node %s%s", node.Name(), nodeLogsTail(node),
+				)
+			}
+			opts.logger(FixupLogPhase).Debugf("Containerd was ready on node %s after %v", node.Name(), elapsed)
+			break
+		}
+		elapsed, ready := node.WaitForDocker(time.Now().Add(timeout), opts.nodeDockerPollInterval())
+		if !ready {
+			opts.logger(FixupLogPhase).Warningf("Docker was not ready on node %s after %v", node.Name(), timeout)
+			return errors.Errorf(
+				"timed out waiting for docker to be ready on node %s%s", node.Name(), nodeLogsTail(node),
+			)
+		}
+		opts.logger(FixupLogPhase).Debugf("Docker was ready on node %s after %v", node.Name(), elapsed)
+
+	case LoadImagesPhase:
+		// load the docker image artifacts into the docker daemon, or import
+		// them into containerd for containerd nodes
+		return opts.imageLoads.run(func() error {
+			opts.logger(ImageLoadLogPhase).Debugf("Loading images on node %s", node.Name())
+			if desiredNode.Runtime == constants.ContainerdNodeRuntimeValue {
+				return loadImages(node, node.ImportImageArchive, opts.ImageLoadAttempts, opts.ImageLoadBackoff, opts.logger(ImageLoadLogPhase))
+			}
+			if err := loadImages(node, node.LoadImageArchive, opts.ImageLoadAttempts, opts.ImageLoadBackoff, opts.logger(ImageLoadLogPhase)); err != nil {
+				return err
+			}
+			node.RetagImages()
+			return nil
+		})
+
+	case PostCreateExecPhase:
+		for _, command := range desiredNode.PostCreateExec {
+			opts.logger(FixupLogPhase).Debugf("Running %v on node %s", command, node.Name())
+			if err := node.Command(command[0], command[1:]...).Run(); err != nil {
+				return errors.Wrapf(err, "post create command %v failed on node %s", command, node.Name())
+			}
+		}
+
+	default:
+		return errors.Errorf("unknown fixup phase: %s", phase)
+	}
 	return nil
 }
 
 // nodeSpec describes a node to create purely from the container aspect
 // this does not inlude eg starting kubernetes (see actions for that)
 type nodeSpec struct {
-	Name        string
-	Role        string
-	Image       string
-	ExtraMounts []cri.Mount
+	Name        string      `json:"name"`
+	Role        string      `json:"role"`
+	Image       string      `json:"image"`
+	ExtraMounts []cri.Mount `json:"extraMounts,omitempty"`
+	// MaskedPaths and ReadonlyPaths are applied to the node container
+	MaskedPaths   []string `json:"maskedPaths,omitempty"`
+	ReadonlyPaths []string `json:"readonlyPaths,omitempty"`
+	DomainName    string   `json:"domainName,omitempty"`
+	// ContainerLabels are additional labels for the node container
+	ContainerLabels map[string]string `json:"containerLabels,omitempty"`
+	// ExtraHosts are additional host:ip entries for the node's /etc/hosts
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+	// Annotations are OCI annotations for the node container
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Entrypoint overrides the node container's entrypoint and its arguments
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	// CapAdd and CapDrop are Linux capabilities to add and drop
+	CapAdd  []string `json:"capAdd,omitempty"`
+	CapDrop []string `json:"capDrop,omitempty"`
+	// PullConfig is the path to a docker config.json to pull Image with
+	PullConfig string `json:"pullConfig,omitempty"`
+	// StopTimeout is how long the node is given to stop gracefully, from the
+	// role defaults
+	StopTimeout *time.Duration `json:"stopTimeout,omitempty"`
+	// SeccompProfile is the path to a seccomp profile for the node
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+	// Network is the docker network to create the node on, if not the
+	// default bridge network
+	Network string `json:"network,omitempty"`
+	// Networks are additional docker networks to connect the node to
+	Networks []string `json:"networks,omitempty"`
+	// Sysctls are the namespaced kernel parameters of the node, see
+	// Options.IPFamily
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+	// CreationPriority orders the creation of the node among the nodes
+	// waiting for a creation slot, see createSlots
+	CreationPriority int32 `json:"creationPriority,omitempty"`
+	// InitScript is the path to a script to run in the node on boot
+	InitScript string `json:"initScript,omitempty"`
+	// CPUs and Memory limit the node container, in docker's format
+	CPUs   string `json:"cpus,omitempty"`
+	Memory string `json:"memory,omitempty"`
+	// MemorySwap limits the node's memory and swap, in docker's format
+	MemorySwap string `json:"memorySwap,omitempty"`
+	// PidsLimit limits the node's processes, zero is not limited
+	PidsLimit int64 `json:"pidsLimit,omitempty"`
+	// SystemdEnv is the environment for systemd and its units in the node
+	SystemdEnv map[string]string `json:"systemdEnv,omitempty"`
+	// ExtraPortMappings are the node ports published on the host
+	ExtraPortMappings []cri.PortMapping `json:"extraPortMappings,omitempty"`
+	// ProxyEnv are the node's proxy environment variables, nil uses the
+	// host's and empty configures no proxy
+	ProxyEnv map[string]string `json:"proxyEnv"`
+	// ExtraEnv are additional environment variables for the node container
+	ExtraEnv map[string]string `json:"extraEnv,omitempty"`
+	// GPUs are the GPUs requested for the node container, if any
+	GPUs string `json:"gpus,omitempty"`
+	// PostCreateExec are the commands run in the node, see PostCreateExecPhase
+	PostCreateExec [][]string `json:"postCreateExec,omitempty"`
+	// APIServerHostPort is the host port publishing the API server or the
+	// load balancer, zero picks a random free port
+	APIServerHostPort int `json:"apiServerHostPort,omitempty"`
+	// Labels are the Kubernetes node labels for the node's kubelet to
+	// register, unlike ContainerLabels they are not set on the container
+	Labels map[string]string `json:"labels,omitempty"`
+	// KubeletExtraArgs are extra flags for the node's kubelet, applied when
+	// Kubernetes is configured on the node
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+	// Runtime is the container runtime in the node, empty means docker
+	Runtime string `json:"runtime,omitempty"`
+	// Adopted is true if Name refers to a pre-existing container that should
+	// be adopted rather than created, see assignAdoptedNodes. Adopted nodes
+	// cannot be planned, so it is not part of plan files.
+	Adopted bool `json:"-"`
+	// Hostname is the node container hostname, empty uses Name
+	Hostname string `json:"hostname,omitempty"`
 }
 
-func nodesToCreate(cfg *config.Config, clusterName string) []nodeSpec {
+// nodesToCreate returns the nodes to provision for cfg sorted by roleOrder,
+// or an error if there are more than maxNodes, where zero means there is no
+// limit. The nodes are named before they are sorted, see makeNodeNamer.
+func nodesToCreate(
+	cfg *config.Config, namePrefix string, roleOrder []string, roleImages map[string]string,
+	keepLoadBalancer bool, maxNodes int,
+) ([]nodeSpec, error) {
 	desiredNodes := []nodeSpec{}
 
-	// nodes are named based on the cluster name and their role, with a counter
-	nameNode := makeNodeNamer(clusterName)
+	// nodes are named based on the name prefix and their role, with a counter
+	// in the order they are declared in the config
+	nameNode := makeNodeNamer(namePrefix)
+
+	// a config without nodes implicitly has a single control plane node, as
+	// when the config is defaulted
+	explicitNodes := cfg.Nodes
+	if len(explicitNodes) == 0 {
+		explicitNodes = implicitNodes()
+	}
 
 	// convert replicas to normal nodes
 	// TODO(bentheelder): eliminate this when we have v1alpha3 ?
-	configNodes := convertReplicas(cfg.Nodes)
+	configNodes, err := convertReplicas(explicitNodes)
+	if err != nil {
+		return nil, err
+	}
+	configNodes = dropUnneededLoadBalancer(configNodes, keepLoadBalancer)
+	if err := checkNodeBudget(len(configNodes), maxNodes); err != nil {
+		return nil, err
+	}
 
-	// TODO(bentheelder): allow overriding defaultRoleOrder
-	sortNodes(configNodes, defaultRoleOrder)
+	// the number of each node among the nodes of its role, for hostnames
+	roleIndex := map[string]int{}
 
 	for _, configNode := range configNodes {
 		role := string(configNode.Role)
+		name := nameNode(role)
+		roleIndex[role]++
+		hostname, err := expandHostname(configNode.Hostname, name, role, roleIndex[role])
+		if err != nil {
+			return nil, err
+		}
+		// role default mounts come before the node's own mounts
+		extraMounts := []cri.Mount{}
+		var stopTimeout *time.Duration
+		resources := config.NodeResources{}
+		for _, roleDefaults := range cfg.RoleDefaults {
+			if roleDefaults.Role == configNode.Role {
+				extraMounts = append(extraMounts, roleDefaults.ExtraMounts...)
+				if roleDefaults.StopTimeout != nil {
+					stopTimeout = &roleDefaults.StopTimeout.Duration
+				}
+				resources = mergeResources(resources, roleDefaults.Resources)
+			}
+		}
+		// the node's own resources override the role defaults
+		resources = mergeResources(resources, configNode.Resources)
+		cpus, memory, memorySwap, err := dockerResources(resources)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid resources for %s node", role)
+		}
+		extraMounts = append(extraMounts, configNode.ExtraMounts...)
+		if configNode.ConfigDir != "" {
+			extraMounts = append(extraMounts, cri.Mount{
+				HostPath:      configNode.ConfigDir,
+				ContainerPath: constants.NodeConfigDirPath,
+				Readonly:      true,
+			})
+		}
+		// copied as the host gateway entry is appended per node
+		extraHosts := append([]string(nil), configNode.ExtraHosts...)
 		desiredNodes = append(desiredNodes, nodeSpec{
-			Name:        nameNode(role),
-			Image:       configNode.Image,
-			Role:        role,
-			ExtraMounts: configNode.ExtraMounts,
+			Name:              name,
+			Hostname:          hostname,
+			CreationPriority:  creationPriority(&configNode, role),
+			Image:             nodeImage(configNode, roleImages),
+			Role:              role,
+			ExtraMounts:       extraMounts,
+			MaskedPaths:       configNode.MaskedPaths,
+			ReadonlyPaths:     configNode.ReadonlyPaths,
+			DomainName:        configNode.DomainName,
+			Annotations:       configNode.Annotations,
+			Entrypoint:        configNode.Entrypoint,
+			CapAdd:            configNode.CapAdd,
+			CapDrop:           configNode.CapDrop,
+			PullConfig:        configNode.PullConfig,
+			StopTimeout:       stopTimeout,
+			SeccompProfile:    configNode.SeccompProfile,
+			InitScript:        configNode.InitScript,
+			CPUs:              cpus,
+			Memory:            memory,
+			MemorySwap:        memorySwap,
+			PidsLimit:         resources.PidsLimit,
+			SystemdEnv:        configNode.SystemdEnv,
+			ExtraPortMappings: configNode.ExtraPortMappings,
+			ProxyEnv:          proxyEnv(configNode.Proxy),
+			ExtraEnv:          configNode.ExtraEnv,
+			GPUs:              configNode.GPUs,
+			PostCreateExec:    configNode.PostCreateExec,
+			Labels:            configNode.Labels,
+			KubeletExtraArgs:  configNode.KubeletExtraArgs,
+			ContainerLabels:   configNode.ContainerLabels,
+			ExtraHosts:        extraHosts,
+			Runtime:           configNode.Runtime,
 		})
 	}
 
-	// TODO(bentheelder): handle implicit nodes as well
-
-	return desiredNodes
+	sortNodes(desiredNodes, roleOrder)
+	return desiredNodes, nil
 }
 
-func (d *nodeSpec) Create(clusterLabel string) (node *nodes.Node, err error) {
+func (d *nodeSpec) Create(clusterLabel nodes.ClusterLabel) (node *nodes.Node, err error) {
 	// create the node into a container (docker run, but it is paused, see createNode)
 	// TODO(bentheelder): decouple from config objects further
+	opts := d.createOpts()
+	// ensureNodeImages skips images with pull credentials, pull them here
+	if d.PullConfig != "" {
+		if _, err := docker.PullWithConfigIfNotPresent(d.Image, d.PullConfig, 4); err != nil {
+			return nil, err
+		}
+	}
 	switch d.Role {
 	case constants.ExternalLoadBalancerNodeRoleValue:
-		node, err = nodes.CreateExternalLoadBalancerNode(d.Name, d.Image, clusterLabel)
+		node, err = nodes.CreateExternalLoadBalancerNode(d.Name, d.Image, clusterLabel, opts...)
 	case constants.ControlPlaneNodeRoleValue:
-		node, err = nodes.CreateControlPlaneNode(d.Name, d.Image, clusterLabel, d.ExtraMounts)
+		node, err = nodes.CreateControlPlaneNode(d.Name, d.Image, clusterLabel, d.ExtraMounts, opts...)
 	case constants.WorkerNodeRoleValue:
-		node, err = nodes.CreateWorkerNode(d.Name, d.Image, clusterLabel, d.ExtraMounts)
+		node, err = nodes.CreateWorkerNode(d.Name, d.Image, clusterLabel, d.ExtraMounts, opts...)
+	case constants.ExternalEtcdNodeRoleValue:
+		node, err = nodes.CreateExternalEtcdNode(d.Name, d.Image, clusterLabel, opts...)
 	default:
 		return nil, errors.Errorf("unknown node role: %s", d.Role)
 	}
 	return node, err
 }
 
+// createOpts returns the nodes.CreateOpt for the spec's container settings
+func (d *nodeSpec) createOpts() []nodes.CreateOpt {
+	return []nodes.CreateOpt{
+		nodes.WithMaskedPaths(d.MaskedPaths),
+		nodes.WithReadonlyPaths(d.ReadonlyPaths),
+		nodes.WithHostname(d.Hostname),
+		nodes.WithDomainName(d.DomainName),
+		nodes.WithLabels(d.ContainerLabels),
+		nodes.WithExtraHosts(d.ExtraHosts),
+		nodes.WithAnnotations(d.Annotations),
+		nodes.WithEntrypoint(d.Entrypoint),
+		nodes.WithCapabilities(d.CapAdd, d.CapDrop),
+		nodes.WithStopTimeout(d.StopTimeout),
+		nodes.WithSeccompProfile(d.SeccompProfile),
+		nodes.WithNetwork(d.Network),
+		nodes.WithNetworks(d.Networks),
+		nodes.WithInitScript(d.InitScript),
+		nodes.WithResources(d.CPUs, d.Memory),
+		nodes.WithMemorySwap(d.MemorySwap),
+		nodes.WithPidsLimit(d.PidsLimit),
+		nodes.WithSystemdEnv(d.SystemdEnv),
+		nodes.WithPortMappings(d.ExtraPortMappings),
+		nodes.WithProxyEnv(d.ProxyEnv),
+		nodes.WithExtraEnv(d.ExtraEnv),
+		nodes.WithGPUs(d.GPUs),
+		nodes.WithSysctls(d.Sysctls),
+		nodes.WithAPIServerHostPort(d.APIServerHostPort),
+	}
+}
+
+// proxyEnv returns the proxy environment variables for a node's proxy
+// settings, nil proxy settings return nil so the host's are used
+func proxyEnv(proxy *config.NodeProxy) map[string]string {
+	if proxy == nil {
+		return nil
+	}
+	env := map[string]string{}
+	if proxy.Disabled {
+		return env
+	}
+	for name, value := range map[string]string{
+		"HTTP_PROXY":  proxy.HTTPProxy,
+		"HTTPS_PROXY": proxy.HTTPSProxy,
+		"NO_PROXY":    proxy.NoProxy,
+	} {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	return env
+}
+
 // makeNodeNamer returns a func(role string)(nodeName string)
-// used to name nodes based on their role and the clusterName
-func makeNodeNamer(clusterName string) func(string) string {
+// used to name nodes based on their role and the namePrefix, which is the
+// cluster name unless overridden by Options.NamePrefix.
+// The first node of each role is named <namePrefix>-<role>, and the
+// following ones <namePrefix>-<role>2, <namePrefix>-<role>3 etc. in the
+// order they are named. nodesToCreate names the nodes in the order they are
+// declared in the config, with replicas expanded in place, so the names
+// only depend on the declaration order of the nodes of the same role and not
+// on the provisioning order.
+// The numbering continues after existingNames, the names of existing nodes.
+func makeNodeNamer(namePrefix string, existingNames ...string) func(string) string {
 	counter := make(map[string]int)
+	for _, name := range existingNames {
+		role, count, ok := parseNodeName(namePrefix, name)
+		if ok && count > counter[role] {
+			counter[role] = count
+		}
+	}
 	return func(role string) string {
 		count := 1
 		suffix := ""
@@ -242,6 +1496,144 @@ func makeNodeNamer(clusterName string) func(string) string {
 			suffix = fmt.Sprintf("%d", count)
 		}
 		counter[role] = count
-		return fmt.Sprintf("%s-%s%s", clusterName, role, suffix)
+		return fmt.Sprintf("%s-%s%s", namePrefix, role, suffix)
+	}
+}
+
+// parseNodeName returns the role and number of a node named by makeNodeNamer
+// for namePrefix, and false if name is not such a node name
+func parseNodeName(namePrefix, name string) (role string, count int, ok bool) {
+	prefix := namePrefix + "-"
+	if !strings.HasPrefix(name, prefix) {
+		return "", 0, false
+	}
+	rest := strings.TrimPrefix(name, prefix)
+	role = strings.TrimRight(rest, "0123456789")
+	if !knownRoles.Has(role) {
+		return "", 0, false
+	}
+	count = 1
+	if suffix := strings.TrimPrefix(rest, role); suffix != "" {
+		n, err := strconv.Atoi(suffix)
+		// the first node of a role has no number, the second is 2
+		if err != nil || n < 2 {
+			return "", 0, false
+		}
+		count = n
+	}
+	return role, count, true
+}
+
+// validateNodeNames checks that the node names are valid DNS labels, which
+// also limits them to 63 characters, as the names are used as hostnames
+func validateNodeNames(desiredNodes []nodeSpec) error {
+	for _, desiredNode := range desiredNodes {
+		if errs := validation.IsDNS1123Label(desiredNode.Name); len(errs) > 0 {
+			return errors.Errorf(
+				"invalid node name %q, use a shorter cluster name or name prefix: %s",
+				desiredNode.Name, strings.Join(errs, "; "),
+			)
+		}
+	}
+	return nil
+}
+
+// expandHostname expands the node hostname template, see config.Node, an
+// empty template returns the empty string so that the node name is used
+func expandHostname(hostname, name, role string, index int) (string, error) {
+	if hostname == "" {
+		return "", nil
+	}
+	t, err := template.New("hostname").Option("missingkey=error").Parse(hostname)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid hostname template %q", hostname)
+	}
+	var buf bytes.Buffer
+	data := struct {
+		Name  string
+		Role  string
+		Index int
+	}{Name: name, Role: role, Index: index}
+	if err := t.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "failed to expand hostname template %q", hostname)
+	}
+	return buf.String(), nil
+}
+
+// validateHostnames checks that the custom node hostnames are valid DNS
+// labels, like the node names, and that no two nodes have the same hostname
+func validateHostnames(desiredNodes []nodeSpec) error {
+	hostnames := map[string]string{}
+	for _, desiredNode := range desiredNodes {
+		hostname := desiredNode.Hostname
+		if hostname == "" {
+			hostname = desiredNode.Name
+		}
+		if errs := validation.IsDNS1123Label(hostname); len(errs) > 0 {
+			return errors.Errorf(
+				"invalid hostname %q for node %s: %s",
+				hostname, desiredNode.Name, strings.Join(errs, "; "),
+			)
+		}
+		if other, ok := hostnames[hostname]; ok {
+			return errors.Errorf("nodes %s and %s have the same hostname %q", other, desiredNode.Name, hostname)
+		}
+		hostnames[hostname] = desiredNode.Name
+	}
+	return nil
+}
+
+// mergeLabels returns the labels in base with those in override added, the
+// maps are not modified
+func mergeLabels(base, override map[string]string) map[string]string {
+	labels := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		labels[key] = value
+	}
+	for key, value := range override {
+		labels[key] = value
+	}
+	return labels
+}
+
+// labelsFromEnv returns container labels for each of the named environment
+// variables that is set, using the variable name as the label key
+func labelsFromEnv(names []string, logger log.FieldLogger) map[string]string {
+	labels := make(map[string]string, len(names))
+	for _, name := range names {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			logger.Debugf("Not labeling nodes with %s, it is not set", name)
+			continue
+		}
+		labels[name] = value
+	}
+	return labels
+}
+
+// docker added the --annotation run flag in 24.0
+var minAnnotationsVersion = version.MustParseGeneric("24.0.0")
+
+// annotationsSupported returns false if any of desiredNodes has annotations
+// that docker cannot set, in which case they should be skipped
+func annotationsSupported(desiredNodes []nodeSpec, logger log.FieldLogger) bool {
+	hasAnnotations := false
+	for _, desiredNode := range desiredNodes {
+		if len(desiredNode.Annotations) > 0 {
+			hasAnnotations = true
+		}
+	}
+	if !hasAnnotations {
+		return true
+	}
+	serverVersion, err := docker.ServerVersion()
+	if err != nil {
+		logger.Warnf("Skipping node annotations, could not determine the docker version: %v", err)
+		return false
+	}
+	if serverVersion.LessThan(minAnnotationsVersion) {
+		logger.Warnf("Skipping node annotations, these require docker %s or newer, found %s", minAnnotationsVersion, serverVersion)
+		return false
 	}
+	return true
 }
@@ -0,0 +1,3739 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/kind/pkg/cluster/config"
+	"sigs.k8s.io/kind/pkg/cluster/config/defaults"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	clustercontext "sigs.k8s.io/kind/pkg/cluster/internal/context"
+	"sigs.k8s.io/kind/pkg/cluster/internal/haproxy"
+	"sigs.k8s.io/kind/pkg/cluster/internal/kubeadm"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/cri"
+	"sigs.k8s.io/kind/pkg/exec"
+	logutil "sigs.k8s.io/kind/pkg/log"
+)
+
+// newTestConfig returns a config with a control plane and workers
+func newTestConfig(workers int32) *config.Config {
+	return &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &workers},
+		},
+	}
+}
+
+// fakeContainers replaces the docker containers for the duration of a test,
+// there are no existing containers, the node images are present and create
+// is called instead of creating each node container
+func fakeContainers(t *testing.T, create func(desiredNode *nodeSpec) error) {
+	realList, realEnsure, realCreate, realFixup := listContainers, ensureImages, createContainer, fixupContainer
+	realListCluster := listClusterNodes
+	t.Cleanup(func() {
+		listContainers, ensureImages, createContainer, fixupContainer = realList, realEnsure, realCreate, realFixup
+		listClusterNodes = realListCluster
+	})
+	listContainers = func() ([]string, error) {
+		return nil, nil
+	}
+	ensureImages = func(*logutil.Status, []nodeSpec, log.FieldLogger) {}
+	createContainer = func(desiredNode *nodeSpec, clusterLabel nodes.ClusterLabel) (*nodes.Node, error) {
+		if err := create(desiredNode); err != nil {
+			return nil, err
+		}
+		return nodes.FromName(desiredNode.Name), nil
+	}
+	fixupContainer = func(node *nodes.Node, desiredNode nodeSpec, phases []string, opts *Options) error {
+		return nil
+	}
+}
+
+func TestCreateNodeContainersMaxConcurrency(t *testing.T) {
+	cases := []struct {
+		TestName       string
+		Workers        int32
+		MaxConcurrency int
+		ExpectMax      int
+	}{
+		{
+			TestName:       "Default concurrency",
+			Workers:        9,
+			MaxConcurrency: 0,
+			ExpectMax:      DefaultMaxConcurrency,
+		},
+		{
+			TestName:       "Limited concurrency",
+			Workers:        9,
+			MaxConcurrency: 3,
+			ExpectMax:      3,
+		},
+		{
+			TestName:       "Serial creation",
+			Workers:        4,
+			MaxConcurrency: 1,
+			ExpectMax:      1,
+		},
+		{
+			TestName:       "Limit above the node count",
+			Workers:        2,
+			MaxConcurrency: 10,
+			ExpectMax:      3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, maxInFlight := 0, 0
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+				// give the other nodes a chance to start creating
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return nil
+			})
+
+			opts := &Options{MaxConcurrency: tc.MaxConcurrency}
+			status := logutil.NewStatus(ioutil.Discard)
+			result, err := createNodeContainers(context.Background(), status, newTestConfig(tc.Workers), "kind", "test-cluster", opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Ready) != int(tc.Workers)+1 {
+				t.Errorf("expected %d ready nodes, got %d", tc.Workers+1, len(result.Ready))
+			}
+			if maxInFlight > tc.ExpectMax {
+				t.Errorf("expected at most %d nodes created at once, got %d", tc.ExpectMax, maxInFlight)
+			}
+			if maxInFlight != tc.ExpectMax {
+				t.Errorf("expected %d nodes to be created at once, got %d", tc.ExpectMax, maxInFlight)
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersCreationPriority(t *testing.T) {
+	two, high := int32(2), int32(200)
+	cases := []struct {
+		TestName    string
+		Nodes       []config.Node
+		ExpectOrder []string
+	}{
+		{
+			TestName: "Role priorities",
+			Nodes: []config.Node{
+				{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two},
+				{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+				{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+			},
+			ExpectOrder: []string{"kind-external-load-balancer", "kind-control-plane", "kind-worker", "kind-worker2"},
+		},
+		{
+			TestName: "Explicit priority",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+				{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two},
+				{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two, CreationPriority: &high},
+			},
+			// provisioning order is kept within a priority
+			ExpectOrder: []string{"kind-worker3", "kind-worker4", "kind-control-plane", "kind-worker", "kind-worker2"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			var mu sync.Mutex
+			order := []string{}
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, desiredNode.Name)
+				return nil
+			})
+			// a single slot, so that every node waits for it
+			opts := &Options{MaxConcurrency: 1, KeepLoadBalancer: true}
+			status := logutil.NewStatus(ioutil.Discard)
+			if _, err := createNodeContainers(context.Background(), status, &config.Config{Nodes: tc.Nodes}, "kind", "test-cluster", opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(order, tc.ExpectOrder) {
+				t.Errorf("expected the nodes to be created in order %v, got %v", tc.ExpectOrder, order)
+			}
+		})
+	}
+}
+
+func TestCreateSlots(t *testing.T) {
+	slots := newCreateSlots(1)
+	slots.expect([]nodeSpec{
+		{Name: "low", CreationPriority: 0},
+		{Name: "adopted", CreationPriority: 500, Adopted: true},
+		{Name: "high", CreationPriority: 100},
+	})
+	// the low priority node waits while the high priority one is expected
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := slots.acquire(ctx, nil, "low"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the low priority node to wait, got %v", err)
+	}
+	if err := slots.acquire(context.Background(), nil, "high"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the slot is taken until it is released
+	acquired := make(chan error)
+	go func() {
+		acquired <- slots.acquire(context.Background(), nil, "low")
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("expected the low priority node to wait for the slot, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	slots.release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	slots.release()
+
+	// a node that gives up no longer holds back the others
+	slots.expect([]nodeSpec{{Name: "gone", CreationPriority: 100}, {Name: "next"}})
+	slots.forget("gone")
+	if err := slots.acquire(context.Background(), nil, "next"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the default priorities follow the role
+	for role, expected := range map[string]int32{
+		constants.ExternalLoadBalancerNodeRoleValue: 300,
+		constants.ControlPlaneNodeRoleValue:         100,
+		constants.WorkerNodeRoleValue:               0,
+	} {
+		if priority := creationPriority(&config.Node{}, role); priority != expected {
+			t.Errorf("expected %s nodes to have priority %d, got %d", role, expected, priority)
+		}
+	}
+}
+
+// fakeExisting is a node container that existed before provisioning, as
+// inspected by nodeSpec.Adopt
+type fakeExisting struct {
+	image, role, cluster string
+}
+
+// existingOutput returns the docker inspect output of the existing node
+// containers, by container name, for fakeCmder.output
+func existingOutput(existing map[string]fakeExisting) func(command []string) []string {
+	return func(command []string) []string {
+		if len(command) < 5 || command[1] != "inspect" {
+			return nil
+		}
+		container, ok := existing[command[len(command)-1]]
+		if !ok {
+			return nil
+		}
+		switch format := command[3]; {
+		case strings.Contains(format, ".Config.Image"):
+			return []string{container.image}
+		case strings.Contains(format, constants.NodeRoleKey):
+			return []string{container.role}
+		case strings.Contains(format, constants.ClusterLabelKey):
+			return []string{container.cluster}
+		}
+		return nil
+	}
+}
+
+// fakeCmder records the commands it creates, which all succeed without
+// running anything, docker run prints a container ID
+type fakeCmder struct {
+	mu       sync.Mutex
+	commands [][]string
+	// missingImages are the images not present locally
+	missingImages sets.String
+	// copied maps the node:path destinations of docker cp to the content
+	copied map[string]string
+	// failArgs are the args of commands that fail, see hasArgs
+	failArgs [][]string
+	// logs are the lines output by docker logs
+	logs []string
+	// output returns the lines output by command instead of the defaults,
+	// if set and it returns non-nil lines
+	output func(command []string) []string
+}
+
+var _ exec.Cmder = &fakeCmder{}
+
+func (f *fakeCmder) Command(name string, args ...string) exec.Cmd {
+	command := append([]string{name}, args...)
+	f.mu.Lock()
+	f.commands = append(f.commands, command)
+	f.mu.Unlock()
+	cmd := &fakeCmd{command: command}
+	if len(args) > 0 && args[0] == "logs" {
+		cmd.output = f.logs
+	}
+	if f.output != nil {
+		if output := f.output(command); output != nil {
+			cmd.output = output
+		}
+	}
+	for _, fail := range f.failArgs {
+		if hasArgs(command, fail...) {
+			cmd.fail = true
+		}
+	}
+	if len(args) == 3 && args[0] == "inspect" && args[1] == "--type=image" {
+		cmd.fail = f.missingImages.Has(args[2])
+	}
+	if len(args) == 3 && args[0] == "cp" {
+		// the source may be a temporary file, read it before it is removed
+		if content, err := ioutil.ReadFile(args[1]); err == nil {
+			f.mu.Lock()
+			if f.copied == nil {
+				f.copied = map[string]string{}
+			}
+			f.copied[args[2]] = string(content)
+			f.mu.Unlock()
+		}
+	}
+	return cmd
+}
+
+// pulls returns the images pulled with docker pull
+func (f *fakeCmder) pulls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	images := []string{}
+	for _, command := range f.commands {
+		if len(command) > 2 && command[0] == "docker" && command[1] == "pull" {
+			images = append(images, command[len(command)-1])
+		}
+	}
+	return images
+}
+
+// deleted returns the names of the containers deleted with docker rm
+func (f *fakeCmder) deleted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for _, command := range f.commands {
+		if len(command) > 1 && command[0] == "docker" && command[1] == "rm" {
+			for _, arg := range command[2:] {
+				if !strings.HasPrefix(arg, "-") {
+					names = append(names, arg)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// dockerRuns returns the args of each docker run command
+func (f *fakeCmder) dockerRuns() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	runs := [][]string{}
+	for _, command := range f.commands {
+		if len(command) > 1 && command[0] == "docker" && command[1] == "run" {
+			runs = append(runs, command[2:])
+		}
+	}
+	return runs
+}
+
+type fakeCmd struct {
+	command []string
+	stdout  io.Writer
+	fail    bool
+	// output are lines written to stdout
+	output []string
+}
+
+var _ exec.Cmd = &fakeCmd{}
+
+func (c *fakeCmd) Run() error {
+	if c.fail {
+		return errors.Errorf("command failed: %v", c.command)
+	}
+	if c.stdout != nil && len(c.command) > 1 && c.command[0] == "docker" && c.command[1] == "run" {
+		fmt.Fprintln(c.stdout, "0123456789abcdef")
+	}
+	// the node services are always ready, and every node stores one image
+	if c.stdout != nil && hasArgs(c.command, "systemctl", "is-active") {
+		fmt.Fprintln(c.stdout, "active")
+	}
+	// the nodes boot when signaled, see output
+	if c.stdout != nil && c.output == nil && hasArgs(c.command, "cat", "/proc/1/comm") {
+		fmt.Fprintln(c.stdout, "systemd")
+	}
+	if c.stdout != nil && hasArgs(c.command, "list", "/kind/images") {
+		fmt.Fprintln(c.stdout, "/kind/images/pause.tar")
+	}
+	for _, line := range c.output {
+		if c.stdout != nil {
+			fmt.Fprintln(c.stdout, line)
+		}
+	}
+	return nil
+}
+
+func (c *fakeCmd) SetEnv(...string) exec.Cmd      { return c }
+func (c *fakeCmd) SetStdin(io.Reader) exec.Cmd    { return c }
+func (c *fakeCmd) SetStdout(w io.Writer) exec.Cmd { c.stdout = w; return c }
+func (c *fakeCmd) SetStderr(io.Writer) exec.Cmd   { return c }
+
+// fakeDocker replaces the commands run by the node containers for the
+// duration of a test, fixing up the node containers is skipped
+func fakeDocker(t *testing.T) *fakeCmder {
+	realCmder, realFixup := exec.DefaultCmder, fixupContainer
+	t.Cleanup(func() {
+		exec.DefaultCmder, fixupContainer = realCmder, realFixup
+	})
+	cmder := &fakeCmder{}
+	exec.DefaultCmder = cmder
+	fixupContainer = func(node *nodes.Node, desiredNode nodeSpec, phases []string, opts *Options) error {
+		return nil
+	}
+	return cmder
+}
+
+// hasArgs returns true if args contains want in order, with nothing between
+func hasArgs(args []string, want ...string) bool {
+	return strings.Contains(
+		"\x00"+strings.Join(args, "\x00")+"\x00",
+		"\x00"+strings.Join(want, "\x00")+"\x00",
+	)
+}
+
+func TestCreateNodeContainersPrepullImages(t *testing.T) {
+	cases := []struct {
+		TestName      string
+		MissingImages []string
+		ExpectPulls   []string
+	}{
+		{
+			TestName:      "Shared image is pulled once",
+			MissingImages: []string{"myImage:latest"},
+			ExpectPulls:   []string{"myImage:latest"},
+		},
+		{
+			TestName:    "Present image is not pulled",
+			ExpectPulls: []string{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			cmder.missingImages = sets.NewString(tc.MissingImages...)
+			// both nodes use myImage:latest
+			cfg := newTestConfig(1)
+
+			status := logutil.NewStatus(ioutil.Discard)
+			if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pulls := cmder.pulls(); !reflect.DeepEqual(pulls, tc.ExpectPulls) {
+				t.Errorf("expected pulls %v, got %v", tc.ExpectPulls, pulls)
+			}
+		})
+	}
+}
+
+func TestReportImageDownloads(t *testing.T) {
+	pullConfig := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(pullConfig, []byte(`{"auths": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmder := fakeDocker(t)
+	cmder.missingImages = sets.NewString("myImage:latest", "private:latest")
+	manifest := `{"Descriptor": {}, "SchemaV2Manifest": {` +
+		`"config": {"digest": "sha256:config", "size": 1024}, ` +
+		`"layers": [{"digest": "sha256:local", "size": 4096}, {"digest": "sha256:missing", "size": 2048}]}}`
+	cmder.output = func(command []string) []string {
+		switch {
+		case hasArgs(command, "image", "ls"):
+			return []string{"sha256:present"}
+		case hasArgs(command, "image", "inspect"):
+			return []string{"sha256:local", ""}
+		case hasArgs(command, "manifest", "inspect"):
+			return []string{manifest}
+		}
+		return nil
+	}
+	desiredNodes := []nodeSpec{
+		{Name: "kind-control-plane", Image: "myImage:latest"},
+		{Name: "kind-worker", Image: "private:latest", PullConfig: pullConfig},
+		{Name: "kind-worker2", Image: "present:latest"},
+		{Name: "kind-worker3", Image: "adopted:latest", Adopted: true},
+	}
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+	reportImageDownloads(logutil.NewStatus(ioutil.Discard), desiredNodes, logger)
+
+	// the layer present locally is not downloaded
+	for _, expected := range []string{
+		"Image: myImage:latest will download 3.0 KiB",
+		"Image: private:latest will download 3.0 KiB",
+		"Image: present:latest present locally",
+		"Node images will download 6.0 KiB in total",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q to be logged, got: %s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "adopted:latest") {
+		t.Errorf("expected the image of the adopted node to be skipped, got: %s", out.String())
+	}
+	for _, command := range cmder.commands {
+		if !hasArgs(command, "manifest", "inspect") {
+			continue
+		}
+		withConfig := hasArgs(command, "docker", "--config")
+		if private := command[len(command)-1] == "private:latest"; private != withConfig {
+			t.Errorf("expected only the image with a pull config to be inspected with --config, got %v", command)
+		}
+	}
+}
+
+func TestNodeProxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://host-proxy:3128")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("NO_PROXY", "")
+	const dropIn = "/etc/systemd/system/docker.service.d/http-proxy.conf"
+	cases := []struct {
+		TestName      string
+		Proxy         *config.NodeProxy
+		ExpectEnv     []string
+		ExpectDropIn  string
+		ExpectNoWrite bool
+	}{
+		{
+			TestName:     "Host proxy",
+			Proxy:        nil,
+			ExpectEnv:    []string{"HTTP_PROXY=http://host-proxy:3128"},
+			ExpectDropIn: "[Service]\nEnvironment=\"HTTP_PROXY=http://host-proxy:3128\" ",
+		},
+		{
+			TestName:     "Node proxy overrides the host proxy",
+			Proxy:        &config.NodeProxy{HTTPProxy: "http://node-proxy:3128", NoProxy: "localhost"},
+			ExpectEnv:    []string{"HTTP_PROXY=http://node-proxy:3128", "NO_PROXY=localhost"},
+			ExpectDropIn: "[Service]\nEnvironment=\"HTTP_PROXY=http://node-proxy:3128\" \"NO_PROXY=localhost\" ",
+		},
+		{
+			TestName:      "Disabled proxy",
+			Proxy:         &config.NodeProxy{Disabled: true},
+			ExpectEnv:     []string{},
+			ExpectNoWrite: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			cfg := &config.Config{
+				Nodes: []config.Node{
+					{Role: config.ControlPlaneRole, Image: "myImage:latest", Proxy: tc.Proxy},
+				},
+			}
+			status := logutil.NewStatus(ioutil.Discard)
+			result, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the proxy is passed to the node container
+			runs := cmder.dockerRuns()
+			if len(runs) != 1 {
+				t.Fatalf("expected 1 docker run, got %d", len(runs))
+			}
+			env := []string{}
+			for i, arg := range runs[0] {
+				if arg == "-e" && i+1 < len(runs[0]) && strings.Contains(runs[0][i+1], "PROXY=") {
+					env = append(env, runs[0][i+1])
+				}
+			}
+			if !reflect.DeepEqual(env, tc.ExpectEnv) {
+				t.Errorf("expected proxy env %v, got %v", tc.ExpectEnv, env)
+			}
+
+			// and configured for docker in the node
+			node := result.Ready[0]
+			if err := fixupNode(&node, result.Planned[0], []string{SetProxyPhase}, &Options{}); err != nil {
+				t.Fatalf("unexpected error fixing up the node: %v", err)
+			}
+			dropInContent, wrote := cmder.copied[node.Name()+":"+dropIn]
+			if tc.ExpectNoWrite {
+				if wrote {
+					t.Errorf("expected no proxy drop-in, got: %q", dropInContent)
+				}
+				return
+			}
+			if dropInContent != tc.ExpectDropIn {
+				t.Errorf("expected proxy drop-in %q, got %q", tc.ExpectDropIn, dropInContent)
+			}
+		})
+	}
+}
+
+func TestNodeExtraEnv(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://host-proxy:3128")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("NO_PROXY", "")
+	cmder := fakeDocker(t)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{
+				Role:       config.ControlPlaneRole,
+				Image:      "myImage:latest",
+				SystemdEnv: map[string]string{"SYSTEMD_LOG_LEVEL": "debug"},
+				ExtraEnv:   map[string]string{"FEATURE_B": "false", "FEATURE_A": "true"},
+			},
+		},
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the extra env is passed along with the proxy and systemd env
+	runs := cmder.dockerRuns()
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 docker run, got %d", len(runs))
+	}
+	env := []string{}
+	for i, arg := range runs[0] {
+		if arg == "-e" && i+1 < len(runs[0]) {
+			env = append(env, runs[0][i+1])
+		}
+	}
+	expected := []string{
+		"HTTP_PROXY=http://host-proxy:3128",
+		"SYSTEMD_LOG_LEVEL=debug",
+		"FEATURE_A=true",
+		"FEATURE_B=false",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected env %v, got %v", expected, env)
+	}
+}
+
+func TestNodeGPUs(t *testing.T) {
+	cmder := fakeDocker(t)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "myImage:latest", GPUs: "device=0"},
+		},
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// only the node requesting GPUs gets them
+	runs := cmder.dockerRuns()
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 docker runs, got %d", len(runs))
+	}
+	for _, args := range runs {
+		expectGPUs := hasArgs(args, "--name", "kind-worker")
+		if hasArgs(args, "--gpus", "device=0") != expectGPUs {
+			t.Errorf("expected --gpus to be passed only to kind-worker, got %v", args)
+		}
+		if !expectGPUs && hasArgs(args, "--gpus") {
+			t.Errorf("expected no --gpus flag, got %v", args)
+		}
+	}
+}
+
+func TestNodeExtraMountOptions(t *testing.T) {
+	cmder := fakeDocker(t)
+	workers := int32(2)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{
+				Role:     config.WorkerRole,
+				Image:    "myImage:latest",
+				Replicas: &workers,
+				ExtraMounts: []cri.Mount{
+					{HostPath: "/shared", ContainerPath: "/shared", Readonly: true, Propagation: cri.MountPropagationBidirectional},
+					{HostPath: "/data/{{.Index}}", ContainerPath: "/data", Propagation: cri.MountPropagationHostToContainer},
+					{HostPath: "/private", ContainerPath: "/private", Readonly: true},
+				},
+			},
+		},
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the read only and propagation options of each mount reach docker
+	expected := map[string][]string{
+		"kind-control-plane": {},
+		"kind-worker":        {"--volume=/shared:/shared:ro,rshared", "--volume=/data/0:/data:rslave", "--volume=/private:/private:ro"},
+		"kind-worker2":       {"--volume=/shared:/shared:ro,rshared", "--volume=/data/1:/data:rslave", "--volume=/private:/private:ro"},
+	}
+	volumes := map[string][]string{}
+	for _, args := range cmder.dockerRuns() {
+		name := ""
+		nodeVolumes := []string{}
+		for i, arg := range args {
+			if arg == "--name" && i+1 < len(args) {
+				name = args[i+1]
+			}
+			if strings.HasPrefix(arg, "--volume=/shared") || strings.HasPrefix(arg, "--volume=/data") || strings.HasPrefix(arg, "--volume=/private") {
+				nodeVolumes = append(nodeVolumes, arg)
+			}
+		}
+		volumes[name] = nodeVolumes
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("expected volumes %v, got %v", expected, volumes)
+	}
+}
+
+func TestCreateNodeContainersOnNodePhase(t *testing.T) {
+	fakeDocker(t)
+	// run the real fixup phases against the fake docker
+	fixupContainer = fixupNode
+
+	var mu sync.Mutex
+	events := []string{}
+	opts := &Options{
+		OnNodePhase: func(nodeName, phase string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, nodeName+" "+phase)
+		},
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, newTestConfig(0), "kind", "test-cluster", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"kind-control-plane " + CreatePhase,
+		"kind-control-plane " + FixMountsPhase,
+		"kind-control-plane " + SetProxyPhase,
+		"kind-control-plane " + SignalStartPhase,
+		"kind-control-plane " + WaitForDockerPhase,
+		"kind-control-plane " + LoadImagesPhase,
+		"kind-control-plane " + PostCreateExecPhase,
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %v, got %v", expected, events)
+	}
+}
+
+func TestCreateNodeContainersExternalEtcd(t *testing.T) {
+	cmder := fakeDocker(t)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.ExternalEtcdRole, Image: "myImage:latest"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error validating the config: %v", err)
+	}
+
+	status := logutil.NewStatus(ioutil.Discard)
+	result, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Ready) != 2 {
+		t.Fatalf("expected 2 ready nodes, got %d", len(result.Ready))
+	}
+
+	etcdLabel := fmt.Sprintf("%s=%s", constants.NodeRoleKey, constants.ExternalEtcdNodeRoleValue)
+	etcdRuns := 0
+	for _, args := range cmder.dockerRuns() {
+		if !hasArgs(args, "--label", etcdLabel) {
+			continue
+		}
+		etcdRuns++
+		if !hasArgs(args, "--name", "kind-external-etcd") {
+			t.Errorf("expected the external etcd node to be named kind-external-etcd, got args: %v", args)
+		}
+	}
+	if etcdRuns != 1 {
+		t.Errorf("expected 1 container with label %s, got %d", etcdLabel, etcdRuns)
+	}
+}
+
+func TestCreateNodeContainersCleanupOnFailure(t *testing.T) {
+	cmder := fakeDocker(t)
+	var mu sync.Mutex
+	created := []string{}
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// fail creating the 3rd node
+		if len(created) == 2 {
+			created = append(created, "")
+			return errors.Errorf("injected failure creating node %s", desiredNode.Name)
+		}
+		created = append(created, desiredNode.Name)
+		return nil
+	})
+
+	// create one node at a time without retrying, so that the failure is on
+	// the 3rd node
+	opts := &Options{MaxConcurrency: 1, CreateAttempts: 1}
+	status := logutil.NewStatus(ioutil.Discard)
+	result, err := createNodeContainers(context.Background(), status, newTestConfig(4), "kind", "test-cluster", opts)
+	if err == nil {
+		t.Fatalf("expected an error creating the 3rd node")
+	}
+	if len(result.Ready) != 0 {
+		t.Errorf("expected no ready nodes after cleaning up, got %d", len(result.Ready))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(created) < 3 {
+		t.Fatalf("expected at least 3 nodes to be created, created: %v", created)
+	}
+	// the first two nodes and any created after the failure are deleted
+	deleted := sets.NewString(cmder.deleted()...)
+	for _, name := range created {
+		if name != "" && !deleted.Has(name) {
+			t.Errorf("expected node %s to be deleted, deleted: %v", name, deleted.List())
+		}
+	}
+}
+
+func TestCreateNodeContainersMaxWorkerFailures(t *testing.T) {
+	cases := []struct {
+		TestName      string
+		Fail          []string
+		ExpectError   bool
+		ExpectReady   []string
+		ExpectSkipped []string
+	}{
+		{
+			TestName:      "Tolerated worker failure",
+			Fail:          []string{"kind-worker2"},
+			ExpectReady:   []string{"kind-control-plane", "kind-worker", "kind-worker3"},
+			ExpectSkipped: []string{"kind-worker2"},
+		},
+		{
+			TestName:    "Too many worker failures",
+			Fail:        []string{"kind-worker", "kind-worker3"},
+			ExpectError: true,
+		},
+		{
+			TestName:    "Fatal control plane failure",
+			Fail:        []string{"kind-control-plane"},
+			ExpectError: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			fakeDocker(t)
+			fail := sets.NewString(tc.Fail...)
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				if fail.Has(desiredNode.Name) {
+					return errors.Errorf("injected failure creating node %s", desiredNode.Name)
+				}
+				return nil
+			})
+			opts := &Options{MaxWorkerFailures: 1, CreateAttempts: 1}
+			status := logutil.NewStatus(ioutil.Discard)
+			result, err := createNodeContainers(context.Background(), status, newTestConfig(3), "kind", "test-cluster", opts)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if len(result.Ready) != 0 {
+					t.Errorf("expected no ready nodes after cleaning up, got %d", len(result.Ready))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ready := []string{}
+			for _, node := range result.Ready {
+				ready = append(ready, node.Name())
+			}
+			if !reflect.DeepEqual(ready, tc.ExpectReady) {
+				t.Errorf("expected ready nodes %v, got %v", tc.ExpectReady, ready)
+			}
+			if !reflect.DeepEqual(result.Skipped, tc.ExpectSkipped) {
+				t.Errorf("expected skipped nodes %v, got %v", tc.ExpectSkipped, result.Skipped)
+			}
+		})
+	}
+
+	// the tolerance must not be negative
+	if _, err := quorumSize(nil, 0, -1); err == nil {
+		t.Error("expected an error for a negative tolerance")
+	}
+}
+
+func TestCreateNodeContainersSkipsAdoptedWorker(t *testing.T) {
+	cmder := fakeDocker(t)
+	cmder.output = existingOutput(map[string]fakeExisting{
+		"existing-worker": {image: "myImage:latest", role: "worker", cluster: "kind"},
+	})
+	fakeContainers(t, func(desiredNode *nodeSpec) error { return nil })
+	// the adopted worker fails to be fixed up
+	fixupContainer = func(node *nodes.Node, desiredNode nodeSpec, phases []string, opts *Options) error {
+		if desiredNode.Name == "existing-worker" {
+			return errors.New("injected fixup failure")
+		}
+		return nil
+	}
+	opts := &Options{
+		MaxWorkerFailures: 1,
+		AdoptNodes:        map[string][]string{constants.WorkerNodeRoleValue: {"existing-worker"}},
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	result, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", nodes.NewClusterLabel("kind"), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Skipped, []string{"existing-worker"}) {
+		t.Errorf("expected the adopted worker to be skipped, got %v", result.Skipped)
+	}
+	for _, name := range cmder.deleted() {
+		if name == "existing-worker" {
+			t.Errorf("expected the adopted worker not to be deleted, deleted: %v", cmder.deleted())
+		}
+	}
+}
+
+func TestAssignAdoptedNodes(t *testing.T) {
+	cases := []struct {
+		TestName      string
+		Adopt         map[string][]string
+		ExpectNames   []string
+		ExpectAdopted []string
+		ExpectError   string
+	}{
+		{
+			TestName:      "Nothing to adopt",
+			ExpectNames:   []string{"kind-control-plane", "kind-worker", "kind-worker2"},
+			ExpectAdopted: []string{},
+		},
+		{
+			TestName:      "Adopt in provisioning order",
+			Adopt:         map[string][]string{constants.WorkerNodeRoleValue: {"existing-a", "existing-b"}},
+			ExpectNames:   []string{"kind-control-plane", "existing-a", "existing-b"},
+			ExpectAdopted: []string{"existing-a", "existing-b"},
+		},
+		{
+			TestName: "Adopt some nodes of several roles",
+			Adopt: map[string][]string{
+				constants.ControlPlaneNodeRoleValue: {"existing-control-plane"},
+				constants.WorkerNodeRoleValue:       {"existing-worker"},
+			},
+			ExpectNames:   []string{"existing-control-plane", "existing-worker", "kind-worker2"},
+			ExpectAdopted: []string{"existing-control-plane", "existing-worker"},
+		},
+		{
+			TestName:    "More containers than nodes",
+			Adopt:       map[string][]string{constants.WorkerNodeRoleValue: {"existing-a", "existing-b", "existing-c"}},
+			ExpectError: "cannot adopt node containers [existing-c]: not enough worker nodes in the config",
+		},
+		{
+			TestName:    "No nodes of the role",
+			Adopt:       map[string][]string{constants.ExternalEtcdNodeRoleValue: {"existing-etcd"}},
+			ExpectError: "cannot adopt node containers [existing-etcd]: not enough external-etcd nodes in the config",
+		},
+		{
+			TestName:    "Unknown role",
+			Adopt:       map[string][]string{"master": {"existing-master"}},
+			ExpectError: `cannot adopt node containers [existing-master]: unknown role "master"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			desiredNodes := []nodeSpec{
+				{Name: "kind-control-plane", Role: constants.ControlPlaneNodeRoleValue},
+				{Name: "kind-worker", Role: constants.WorkerNodeRoleValue},
+				{Name: "kind-worker2", Role: constants.WorkerNodeRoleValue},
+			}
+			err := assignAdoptedNodes(desiredNodes, tc.Adopt)
+			if tc.ExpectError != "" {
+				if err == nil || err.Error() != tc.ExpectError {
+					t.Errorf("expected error %q, got: %v", tc.ExpectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			names := []string{}
+			adopted := []string{}
+			for _, desiredNode := range desiredNodes {
+				names = append(names, desiredNode.Name)
+				if desiredNode.Adopted {
+					adopted = append(adopted, desiredNode.Name)
+				}
+			}
+			if !reflect.DeepEqual(names, tc.ExpectNames) {
+				t.Errorf("expected names %v, got %v", tc.ExpectNames, names)
+			}
+			if !reflect.DeepEqual(adopted, tc.ExpectAdopted) {
+				t.Errorf("expected adopted nodes %v, got %v", tc.ExpectAdopted, adopted)
+			}
+		})
+	}
+}
+
+func TestNodeSpecAdopt(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		Existing    map[string]fakeExisting
+		ExpectError string
+	}{
+		{
+			TestName: "Matching container",
+			Existing: map[string]fakeExisting{
+				"existing-worker": {image: "myImage:latest", role: "worker", cluster: "kind"},
+			},
+		},
+		{
+			TestName: "Image mismatch",
+			Existing: map[string]fakeExisting{
+				"existing-worker": {image: "otherImage:latest", role: "worker", cluster: "kind"},
+			},
+			ExpectError: `adopted node container existing-worker has image "otherImage:latest", expected "myImage:latest"`,
+		},
+		{
+			TestName: "Role mismatch",
+			Existing: map[string]fakeExisting{
+				"existing-worker": {image: "myImage:latest", role: "control-plane", cluster: "kind"},
+			},
+			ExpectError: `adopted node container existing-worker has role "control-plane", expected "worker"`,
+		},
+		{
+			TestName: "Cluster label mismatch",
+			Existing: map[string]fakeExisting{
+				"existing-worker": {image: "myImage:latest", role: "worker", cluster: "other"},
+			},
+			ExpectError: fmt.Sprintf(
+				"adopted node container existing-worker has label %q, expected %q",
+				nodes.NewClusterLabel("other"), nodes.NewClusterLabel("kind"),
+			),
+		},
+		{
+			TestName:    "Missing container",
+			Existing:    map[string]fakeExisting{},
+			ExpectError: `adopted node container existing-worker has image "", expected "myImage:latest"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			cmder.output = existingOutput(tc.Existing)
+			desiredNode := nodeSpec{Name: "existing-worker", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"}
+			node, err := desiredNode.Adopt(nodes.NewClusterLabel("kind"))
+			if tc.ExpectError != "" {
+				if err == nil || err.Error() != tc.ExpectError {
+					t.Errorf("expected error %q, got: %v", tc.ExpectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if node.Name() != "existing-worker" {
+				t.Errorf("expected the existing-worker node, got %s", node.Name())
+			}
+			if runs := cmder.dockerRuns(); len(runs) != 0 {
+				t.Errorf("expected no containers to be created, got %v", runs)
+			}
+		})
+	}
+}
+
+func TestRemoveStragglersKeepsAdoptedNodes(t *testing.T) {
+	cmder := fakeDocker(t)
+	results := make(chan nodeResult)
+	stragglers := []string{"existing-worker", "kind-worker2"}
+	removeStragglers(results, stragglers, sets.NewString("existing-worker"))
+	// the stragglers finish being provisioned after they were abandoned
+	results <- nodeResult{spec: nodeSpec{Name: "existing-worker", Adopted: true}, node: nodes.FromName("existing-worker")}
+	results <- nodeResult{spec: nodeSpec{Name: "kind-worker2"}, node: nodes.FromName("kind-worker2")}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cmder.deleted()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	expected := []string{"kind-worker2", "kind-worker2"}
+	if deleted := cmder.deleted(); !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected deleted nodes %v, got %v", expected, deleted)
+	}
+}
+
+func TestCreateNodeContainersCancel(t *testing.T) {
+	cmder := fakeDocker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	created := []string{}
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// cancel while creating the 3rd node
+		if len(created) == 2 {
+			cancel()
+		}
+		created = append(created, desiredNode.Name)
+		return nil
+	})
+
+	opts := &Options{MaxConcurrency: 1}
+	status := logutil.NewStatus(ioutil.Discard)
+	result, err := createNodeContainers(ctx, status, newTestConfig(4), "kind", "test-cluster", opts)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+	if len(result.Ready) != 0 {
+		t.Errorf("expected no ready nodes after cleaning up, got %d", len(result.Ready))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(created) != 3 {
+		t.Errorf("expected no nodes to be created after cancelling, created: %v", created)
+	}
+	deleted := sets.NewString(cmder.deleted()...)
+	for _, name := range created {
+		if !deleted.Has(name) {
+			t.Errorf("expected node %s to be deleted, deleted: %v", name, deleted.List())
+		}
+	}
+}
+
+func TestCreateNodeContainersRetry(t *testing.T) {
+	cases := []struct {
+		TestName       string
+		Failures       int
+		CreateAttempts int
+		ExpectError    bool
+	}{
+		{
+			TestName:       "No failures",
+			Failures:       0,
+			CreateAttempts: 0,
+			ExpectError:    false,
+		},
+		{
+			TestName:       "Two transient failures",
+			Failures:       2,
+			CreateAttempts: 0,
+			ExpectError:    false,
+		},
+		{
+			TestName:       "More failures than attempts",
+			Failures:       2,
+			CreateAttempts: 2,
+			ExpectError:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			attempts := 0
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				attempts++
+				if attempts <= tc.Failures {
+					return errors.Errorf("connection reset creating node %s", desiredNode.Name)
+				}
+				return nil
+			})
+
+			opts := &Options{CreateAttempts: tc.CreateAttempts, CreateBackoff: time.Millisecond}
+			status := logutil.NewStatus(ioutil.Discard)
+			result, err := createNodeContainers(context.Background(), status, newTestConfig(0), "kind", "test-cluster", opts)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatalf("expected an error after %d attempts", attempts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Ready) != 1 || result.Ready[0].Name() != "kind-control-plane" {
+				t.Errorf("expected node kind-control-plane to be returned, got %v", result.Ready)
+			}
+			if attempts != tc.Failures+1 {
+				t.Errorf("expected %d attempts, got %d", tc.Failures+1, attempts)
+			}
+			if deleted := cmder.deleted(); len(deleted) != 0 {
+				t.Errorf("expected no containers to be deleted, deleted: %v", deleted)
+			}
+		})
+	}
+}
+
+func TestValidateRoleOrder(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		RoleOrder   []string
+		ExpectError bool
+	}{
+		{
+			TestName:    "Default order",
+			RoleOrder:   nil,
+			ExpectError: false,
+		},
+		{
+			TestName:    "Workers first",
+			RoleOrder:   []string{"worker", "external-load-balancer", "control-plane"},
+			ExpectError: false,
+		},
+		{
+			TestName:    "Unknown role",
+			RoleOrder:   []string{"worker", "bogus"},
+			ExpectError: true,
+		},
+		{
+			TestName:    "Duplicate role",
+			RoleOrder:   []string{"worker", "worker"},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			err := validateRoleOrder(tc.RoleOrder)
+			if err == nil && tc.ExpectError {
+				t.Errorf("expected an error for role order %v", tc.RoleOrder)
+			}
+			if err != nil && !tc.ExpectError {
+				t.Errorf("unexpected error for role order %v: %v", tc.RoleOrder, err)
+			}
+		})
+	}
+}
+
+func TestValidateNodes(t *testing.T) {
+	one, two, negative := int32(1), int32(2), int32(-1)
+	cases := []struct {
+		TestName    string
+		Nodes       []config.Node
+		ExpectError bool
+	}{
+		{
+			TestName: "Single control plane",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole},
+				{Role: config.WorkerRole, Replicas: &two},
+			},
+			ExpectError: false,
+		},
+		{
+			TestName: "Load balanced control planes",
+			Nodes: []config.Node{
+				{Role: config.ExternalLoadBalancerRole},
+				{Role: config.ControlPlaneRole, Replicas: &two},
+			},
+			ExpectError: false,
+		},
+		{
+			TestName:    "No nodes",
+			Nodes:       nil,
+			ExpectError: false,
+		},
+		{
+			TestName: "No control plane",
+			Nodes: []config.Node{
+				{Role: config.WorkerRole},
+			},
+			ExpectError: true,
+		},
+		{
+			TestName: "Zero control plane replicas",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole, Replicas: new(int32)},
+				{Role: config.WorkerRole},
+			},
+			ExpectError: true,
+		},
+		{
+			TestName: "Negative replicas",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole},
+				{Role: config.WorkerRole, Replicas: &negative},
+			},
+			ExpectError: true,
+		},
+		{
+			TestName: "Unknown role",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole},
+				{Role: "bogus"},
+			},
+			ExpectError: true,
+		},
+		{
+			// the load balancer is dropped, see dropUnneededLoadBalancer
+			TestName: "Load balancer with a single control plane",
+			Nodes: []config.Node{
+				{Role: config.ExternalLoadBalancerRole},
+				{Role: config.ControlPlaneRole, Replicas: &one},
+			},
+			ExpectError: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			err := validateNodes(&config.Config{Nodes: tc.Nodes})
+			if err != nil && !tc.ExpectError {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err == nil && tc.ExpectError {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestNodesToCreateRoleOrder(t *testing.T) {
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "myImage:latest"},
+		},
+	}
+	cases := []struct {
+		TestName    string
+		RoleOrder   []string
+		ExpectRoles []string
+	}{
+		{
+			TestName:    "Default order",
+			RoleOrder:   DefaultRoleOrder(),
+			ExpectRoles: []string{"external-load-balancer", "control-plane", "control-plane", "worker"},
+		},
+		{
+			TestName:    "Workers before the load balancer",
+			RoleOrder:   []string{"worker", "external-load-balancer", "control-plane"},
+			ExpectRoles: []string{"worker", "external-load-balancer", "control-plane", "control-plane"},
+		},
+		{
+			TestName:    "Roles not in the order are provisioned last",
+			RoleOrder:   []string{"control-plane"},
+			ExpectRoles: []string{"control-plane", "control-plane", "external-load-balancer", "worker"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			desiredNodes, err := nodesToCreate(cfg, "kind", tc.RoleOrder, nil, false, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			roles := []string{}
+			for _, desiredNode := range desiredNodes {
+				roles = append(roles, desiredNode.Role)
+			}
+			if strings.Join(roles, ",") != strings.Join(tc.ExpectRoles, ",") {
+				t.Errorf("expected roles in order %v, got %v", tc.ExpectRoles, roles)
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersResources(t *testing.T) {
+	cmder := fakeDocker(t)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{
+				Role:      config.ControlPlaneRole,
+				Image:     "myImage:latest",
+				Resources: &config.NodeResources{CPUs: "1.5", Memory: "2Gi", MemorySwap: "3Gi", PidsLimit: 4096},
+			},
+			{Role: config.WorkerRole, Image: "myImage:latest"},
+		},
+	}
+
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runs := cmder.dockerRuns()
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 docker run commands, got %d", len(runs))
+	}
+	for _, args := range runs {
+		switch {
+		case hasArgs(args, "--name", "kind-control-plane"):
+			if !hasArgs(args, "--cpus", "1.5") || !hasArgs(args, "--memory", "2147483648") {
+				t.Errorf("expected the control plane to be limited to 1.5 CPUs and 2Gi, got args: %v", args)
+			}
+			if !hasArgs(args, "--memory-swap", "3221225472") || !hasArgs(args, "--pids-limit", "4096") {
+				t.Errorf("expected the control plane to be limited to 3Gi with swap and 4096 processes, got args: %v", args)
+			}
+		case hasArgs(args, "--name", "kind-worker"):
+			for _, arg := range args {
+				if arg == "--cpus" || arg == "--memory" || arg == "--memory-swap" || arg == "--pids-limit" {
+					t.Errorf("expected the worker to be unlimited, got args: %v", args)
+				}
+			}
+		default:
+			t.Errorf("unexpected docker run args: %v", args)
+		}
+	}
+}
+
+func TestCreateNodeContainersExtraPortMappings(t *testing.T) {
+	cmder := fakeDocker(t)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{
+				Role:  config.ControlPlaneRole,
+				Image: "myImage:latest",
+				ExtraPortMappings: []cri.PortMapping{
+					{ContainerPort: 80, HostPort: 8080, HostIP: "127.0.0.1"},
+					{ContainerPort: 53, HostPort: 5353, Protocol: cri.PortMappingProtocolUDP},
+					{ContainerPort: 443},
+					{ContainerPort: 30000, HostIP: "::1"},
+				},
+			},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error validating the config: %v", err)
+	}
+
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runs := cmder.dockerRuns()
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 docker run command, got %d", len(runs))
+	}
+	for _, publish := range []string{
+		"--publish=127.0.0.1:8080:80/tcp",
+		"--publish=5353:53/udp",
+		"--publish=443/tcp",
+		"--publish=[::1]::30000/tcp",
+	} {
+		if !hasArgs(runs[0], publish) {
+			t.Errorf("expected docker run args to contain %s, got args: %v", publish, runs[0])
+		}
+	}
+}
+
+func TestNodesToCreateNames(t *testing.T) {
+	two, three := int32(2), int32(3)
+	cases := []struct {
+		TestName    string
+		Nodes       []config.Node
+		RoleOrder   []string
+		ExpectNames []string
+	}{
+		{
+			TestName: "Single node",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			},
+			RoleOrder:   DefaultRoleOrder(),
+			ExpectNames: []string{"kind-control-plane"},
+		},
+		{
+			TestName: "Replicas",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole, Image: "myImage:latest", Replicas: &three},
+				{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+				{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two},
+			},
+			RoleOrder: DefaultRoleOrder(),
+			ExpectNames: []string{
+				"kind-external-load-balancer",
+				"kind-control-plane", "kind-control-plane2", "kind-control-plane3",
+				"kind-worker", "kind-worker2",
+			},
+		},
+		{
+			TestName: "Mixed roles",
+			Nodes: []config.Node{
+				{Role: config.WorkerRole, Image: "worker1:latest"},
+				{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+				{Role: config.WorkerRole, Image: "worker2:latest", Replicas: &two},
+				{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+				{Role: config.WorkerRole, Image: "worker4:latest"},
+				{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+			},
+			RoleOrder: DefaultRoleOrder(),
+			ExpectNames: []string{
+				"kind-external-load-balancer",
+				"kind-control-plane", "kind-control-plane2",
+				"kind-worker", "kind-worker2", "kind-worker3", "kind-worker4",
+			},
+		},
+		{
+			TestName: "Names do not depend on the role order",
+			Nodes: []config.Node{
+				{Role: config.ControlPlaneRole, Image: "myImage:latest", Replicas: &two},
+				{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two},
+			},
+			RoleOrder: []string{"worker", "control-plane"},
+			ExpectNames: []string{
+				"kind-worker", "kind-worker2",
+				"kind-control-plane", "kind-control-plane2",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			desiredNodes, err := nodesToCreate(&config.Config{Nodes: tc.Nodes}, "kind", tc.RoleOrder, nil, false, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			names := []string{}
+			for _, desiredNode := range desiredNodes {
+				names = append(names, desiredNode.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tc.ExpectNames, ",") {
+				t.Errorf("expected names %v, got %v", tc.ExpectNames, names)
+			}
+		})
+	}
+}
+
+func TestNodesToCreateNamesFollowDeclarationOrder(t *testing.T) {
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.WorkerRole, Image: "first:latest"},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "second:latest"},
+		},
+	}
+	desiredNodes, err := nodesToCreate(cfg, "kind", DefaultRoleOrder(), nil, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	images := map[string]string{}
+	for _, desiredNode := range desiredNodes {
+		images[desiredNode.Name] = desiredNode.Image
+	}
+	if images["kind-worker"] != "first:latest" || images["kind-worker2"] != "second:latest" {
+		t.Errorf("expected the workers to be named in declaration order, got %v", images)
+	}
+}
+
+func TestNodesToCreateLabels(t *testing.T) {
+	two := int32(2)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{
+				Role:     config.WorkerRole,
+				Image:    "myImage:latest",
+				Replicas: &two,
+				Labels:   map[string]string{"example.com/pool": "gpu"},
+			},
+		},
+	}
+	desiredNodes, err := nodesToCreate(cfg, "kind", DefaultRoleOrder(), nil, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	labels := map[string]map[string]string{}
+	for _, desiredNode := range desiredNodes {
+		labels[desiredNode.Name] = desiredNode.Labels
+	}
+	expected := map[string]map[string]string{
+		"kind-control-plane": nil,
+		"kind-worker":        {"example.com/pool": "gpu"},
+		"kind-worker2":       {"example.com/pool": "gpu"},
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected node labels %v, got %v", expected, labels)
+	}
+}
+
+func TestConvertReplicasMountHostPath(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		HostPath    string
+		ExpectPaths []string
+	}{
+		{
+			TestName:    "Templated host path",
+			HostPath:    "/data/{{.Index}}",
+			ExpectPaths: []string{"/data/0", "/data/1", "/data/2"},
+		},
+		{
+			TestName:    "Plain host path",
+			HostPath:    "/data",
+			ExpectPaths: []string{"/data", "/data", "/data"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			three := int32(3)
+			node := config.Node{
+				Role:        config.WorkerRole,
+				Image:       "myImage:latest",
+				Replicas:    &three,
+				ExtraMounts: []cri.Mount{{HostPath: tc.HostPath, ContainerPath: "/data"}},
+			}
+			replicas, err := convertReplicas([]config.Node{node})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			paths := []string{}
+			for _, replica := range replicas {
+				for _, mount := range replica.ExtraMounts {
+					paths = append(paths, mount.HostPath)
+				}
+			}
+			if !reflect.DeepEqual(paths, tc.ExpectPaths) {
+				t.Errorf("expected host paths %v, got %v", tc.ExpectPaths, paths)
+			}
+			// the original node is not modified
+			if node.ExtraMounts[0].HostPath != tc.HostPath {
+				t.Errorf("expected the config node host path to stay %q, got %q", tc.HostPath, node.ExtraMounts[0].HostPath)
+			}
+		})
+	}
+}
+
+func TestProvisionNodesReturnsNodes(t *testing.T) {
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		return nil
+	})
+
+	status := logutil.NewStatus(ioutil.Discard)
+	provisioned, err := provisionNodes(context.Background(), status, newTestConfig(2), "kind", "test-cluster", &Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, node := range provisioned {
+		names = append(names, node.Name())
+	}
+	sort.Strings(names)
+	expected := []string{"kind-control-plane", "kind-worker", "kind-worker2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected provisioned nodes %v, got %v", expected, names)
+	}
+}
+
+func TestProvisionNodesDryRun(t *testing.T) {
+	cmder := fakeDocker(t)
+	three, two := int32(3), int32(2)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.WorkerRole, Image: "worker:latest", Replicas: &two},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest", Replicas: &three},
+			{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+		},
+	}
+	var out bytes.Buffer
+	opts := &Options{DryRun: true, Force: true, out: &out}
+	status := logutil.NewStatus(ioutil.Discard)
+	provisioned, err := provisionNodes(context.Background(), status, cfg, "kind", "test-cluster", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provisioned) != 0 {
+		t.Errorf("expected no nodes to be provisioned, got %d", len(provisioned))
+	}
+	if len(cmder.commands) != 0 {
+		t.Errorf("expected no docker commands, got %v", cmder.commands)
+	}
+
+	// the plan lists the replicas in provisioning order
+	names := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		names = append(names, strings.Fields(line)[0])
+	}
+	expected := []string{
+		"kind-external-load-balancer",
+		"kind-control-plane", "kind-control-plane2", "kind-control-plane3",
+		"kind-worker", "kind-worker2",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected planned nodes %v, got %v\n%s", expected, names, out.String())
+	}
+}
+
+func TestFixupNodeErrorsNameTheNode(t *testing.T) {
+	cases := []struct {
+		TestName string
+		Phase    string
+		FailArgs []string
+	}{
+		{
+			TestName: "Fix mounts",
+			Phase:    FixMountsPhase,
+			FailArgs: []string{"mount", "-o", "remount,ro", "/sys"},
+		},
+		{
+			TestName: "Signal start",
+			Phase:    SignalStartPhase,
+			FailArgs: []string{"docker", "kill"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			cmder.failArgs = [][]string{tc.FailArgs}
+			node := nodes.FromName("kind-worker3")
+			err := fixupNode(node, nodeSpec{Name: node.Name()}, []string{tc.Phase}, &Options{})
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.Contains(err.Error(), "kind-worker3") {
+				t.Errorf("expected the error to name the node, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestFixupNodeRuntime(t *testing.T) {
+	cases := []struct {
+		TestName     string
+		Runtime      string
+		ExpectArgs   [][]string
+		UnexpectArgs [][]string
+	}{
+		{
+			TestName: "Default runtime",
+			Runtime:  "",
+			ExpectArgs: [][]string{
+				{"systemctl", "is-active", "docker"},
+				{"docker", "load", "-i", "/kind/images/pause.tar"},
+			},
+			UnexpectArgs: [][]string{{"ctr"}},
+		},
+		{
+			TestName: "Docker runtime",
+			Runtime:  constants.DockerNodeRuntimeValue,
+			ExpectArgs: [][]string{
+				{"systemctl", "is-active", "docker"},
+				{"docker", "load", "-i", "/kind/images/pause.tar"},
+			},
+			UnexpectArgs: [][]string{{"ctr"}},
+		},
+		{
+			TestName: "Containerd runtime",
+			Runtime:  constants.ContainerdNodeRuntimeValue,
+			ExpectArgs: [][]string{
+				{"systemctl", "is-active", "containerd"},
+				{"ctr", "--namespace=k8s.io", "images", "import", "/kind/images/pause.tar"},
+			},
+			UnexpectArgs: [][]string{
+				{"systemctl", "is-active", "docker"},
+				{"docker", "load"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			node := nodes.FromName("kind-worker")
+			desiredNode := nodeSpec{Name: node.Name(), Runtime: tc.Runtime}
+			phases := []string{WaitForDockerPhase, LoadImagesPhase}
+			if err := fixupNode(node, desiredNode, phases, &Options{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ran := func(args []string) bool {
+				for _, command := range cmder.commands {
+					if hasArgs(command, args...) {
+						return true
+					}
+				}
+				return false
+			}
+			for _, args := range tc.ExpectArgs {
+				if !ran(args) {
+					t.Errorf("expected a command with args %v, ran: %v", args, cmder.commands)
+				}
+			}
+			for _, args := range tc.UnexpectArgs {
+				if ran(args) {
+					t.Errorf("expected no command with args %v, ran: %v", args, cmder.commands)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersSkipImageLoad(t *testing.T) {
+	cases := []struct {
+		TestName      string
+		SkipImageLoad bool
+		ExpectLoads   int
+	}{
+		{
+			TestName:      "Images are loaded on every node",
+			SkipImageLoad: false,
+			ExpectLoads:   3,
+		},
+		{
+			// skipping saves one docker load per node and archive
+			TestName:      "Skip image load",
+			SkipImageLoad: true,
+			ExpectLoads:   0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			// run the real fixup phases against the fake docker
+			fixupContainer = fixupNode
+
+			opts := &Options{SkipImageLoad: tc.SkipImageLoad}
+			status := logutil.NewStatus(ioutil.Discard)
+			if _, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			loads := 0
+			for _, command := range cmder.commands {
+				if hasArgs(command, "docker", "load") {
+					loads++
+				}
+			}
+			if loads != tc.ExpectLoads {
+				t.Errorf("expected %d image loads, got %d", tc.ExpectLoads, loads)
+			}
+		})
+	}
+}
+
+func TestImageLoadLimiterReportsBatches(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+	imageLoads, err := newImageLoadLimiter(2, 5, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := imageLoads.run(func() error { return nil }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	reports := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if i := strings.Index(line, "Loaded images on "); i >= 0 {
+			reports = append(reports, strings.TrimSuffix(line[i:], `"`))
+		}
+	}
+	expected := []string{
+		"Loaded images on 2 of 5 nodes",
+		"Loaded images on 4 of 5 nodes",
+		"Loaded images on 5 of 5 nodes",
+	}
+	if !reflect.DeepEqual(reports, expected) {
+		t.Errorf("expected reports %v, got %v", expected, reports)
+	}
+}
+
+func TestOptionsLoadsImages(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		Opts        Options
+		Node        nodeSpec
+		ExpectLoads bool
+	}{
+		{
+			TestName:    "Worker",
+			Node:        nodeSpec{Role: constants.WorkerNodeRoleValue},
+			ExpectLoads: true,
+		},
+		{
+			TestName: "External load balancer",
+			Node:     nodeSpec{Role: constants.ExternalLoadBalancerNodeRoleValue},
+		},
+		{
+			TestName: "Overridden entrypoint",
+			Node:     nodeSpec{Role: constants.WorkerNodeRoleValue, Entrypoint: []string{"/bin/sh"}},
+		},
+		{
+			TestName: "Skip image load",
+			Opts:     Options{SkipImageLoad: true},
+			Node:     nodeSpec{Role: constants.WorkerNodeRoleValue},
+		},
+		{
+			TestName: "No LoadImages fixup phase",
+			Opts:     Options{FixupPhases: []string{FixMountsPhase}},
+			Node:     nodeSpec{Role: constants.WorkerNodeRoleValue},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			if loads := tc.Opts.loadsImages(tc.Node); loads != tc.ExpectLoads {
+				t.Errorf("expected loads images: %v, got %v", tc.ExpectLoads, loads)
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersSkipMountFixup(t *testing.T) {
+	cases := []struct {
+		TestName       string
+		SkipMountFixup bool
+		ExpectFixes    int
+	}{
+		{
+			TestName:       "Mounts are fixed on every node",
+			SkipMountFixup: false,
+			ExpectFixes:    3,
+		},
+		{
+			TestName:       "Skip mount fixup",
+			SkipMountFixup: true,
+			ExpectFixes:    0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			// run the real fixup phases against the fake docker
+			fixupContainer = fixupNode
+			realFixMounts := fixMounts
+			t.Cleanup(func() { fixMounts = realFixMounts })
+			var mu sync.Mutex
+			fixes := 0
+			fixMounts = func(node *nodes.Node) error {
+				mu.Lock()
+				defer mu.Unlock()
+				fixes++
+				return nil
+			}
+
+			opts := &Options{SkipMountFixup: tc.SkipMountFixup}
+			status := logutil.NewStatus(ioutil.Discard)
+			if _, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fixes != tc.ExpectFixes {
+				t.Errorf("expected %d mount fixes, got %d", tc.ExpectFixes, fixes)
+			}
+			// the following phases run either way
+			signals := 0
+			for _, command := range cmder.commands {
+				if hasArgs(command, "docker", "kill", "-s", "SIGUSR1") {
+					signals++
+				}
+			}
+			if signals != 3 {
+				t.Errorf("expected 3 nodes signaled to start, got %d", signals)
+			}
+		})
+	}
+}
+
+func TestNodesToCreateImplicitNodes(t *testing.T) {
+	desiredNodes, err := nodesToCreate(&config.Config{}, "kind", DefaultRoleOrder(), nil, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(desiredNodes) != 1 {
+		t.Fatalf("expected exactly 1 node, got %d", len(desiredNodes))
+	}
+	node := desiredNodes[0]
+	if node.Name != "kind-control-plane" || node.Role != constants.ControlPlaneNodeRoleValue || node.Image != defaults.Image {
+		t.Errorf("expected a default control plane node, got %s with role %s and image %s", node.Name, node.Role, node.Image)
+	}
+}
+
+func TestNodesToCreateRoleImages(t *testing.T) {
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "node:explicit"},
+			{Role: config.ControlPlaneRole},
+			{Role: config.WorkerRole},
+			{Role: config.WorkerRole, Image: "worker:explicit"},
+		},
+	}
+	roleImages := map[string]string{constants.WorkerNodeRoleValue: "worker:role"}
+	desiredNodes, err := nodesToCreate(cfg, "kind", DefaultRoleOrder(), roleImages, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the node's image wins over its role's image, which wins over the default
+	expected := map[string]string{
+		"kind-control-plane":  "node:explicit",
+		"kind-control-plane2": defaults.Image,
+		"kind-worker":         "worker:role",
+		"kind-worker2":        "worker:explicit",
+	}
+	images := map[string]string{}
+	for _, desiredNode := range desiredNodes {
+		images[desiredNode.Name] = desiredNode.Image
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected images %v, got %v", expected, images)
+	}
+
+	// the implicit control plane node uses its role's image too
+	roleImages[constants.ControlPlaneNodeRoleValue] = "control-plane:role"
+	desiredNodes, err = nodesToCreate(&config.Config{}, "kind", DefaultRoleOrder(), roleImages, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if desiredNodes[0].Image != "control-plane:role" {
+		t.Errorf("expected the implicit node image control-plane:role, got %s", desiredNodes[0].Image)
+	}
+
+	if err := validateRoleImages(map[string]string{"gpu-worker": "node:gpu"}); err == nil {
+		t.Errorf("expected an error for an unknown role")
+	}
+}
+
+func TestProvisionNodesGeneration(t *testing.T) {
+	cmder := fakeDocker(t)
+	status := logutil.NewStatus(ioutil.Discard)
+
+	// provision the same cluster twice, as when retrying a failed create
+	generations := []string{}
+	for i := 0; i < 2; i++ {
+		opts := &Options{}
+		if _, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		generations = append(generations, opts.generation)
+	}
+	if generations[0] == "" || generations[0] == generations[1] {
+		t.Fatalf("expected distinct generations, got %v", generations)
+	}
+
+	// the nodes of each invocation can be selected by their generation label
+	for _, generation := range generations {
+		label := constants.GenerationLabelKey + "=" + generation
+		selected := 0
+		for _, args := range cmder.dockerRuns() {
+			if hasArgs(args, "--label", label) {
+				selected++
+			}
+		}
+		if selected != 2 {
+			t.Errorf("expected 2 nodes with label %s, got %d", label, selected)
+		}
+	}
+}
+
+func TestAddWorkerNodes(t *testing.T) {
+	var mu sync.Mutex
+	created := []string{}
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, desiredNode.Name)
+		return nil
+	})
+	// the cluster already has two workers, next to another cluster's nodes
+	listContainers = func() ([]string, error) {
+		return []string{"kind-control-plane", "kind-worker", "kind-worker2", "other-worker5"}, nil
+	}
+	clusterNodeNames := []string{"kind-control-plane", "kind-worker", "kind-worker2"}
+	listClusterNodes = func(clusterLabel nodes.ClusterLabel) ([]nodes.Node, error) {
+		if clusterLabel != "test-cluster" {
+			t.Errorf("expected the nodes of cluster test-cluster, got %s", clusterLabel)
+		}
+		result := []nodes.Node{}
+		for _, name := range clusterNodeNames {
+			result = append(result, *nodes.FromName(name))
+		}
+		return result, nil
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+
+	ready, err := addWorkerNodes(context.Background(), status, "kind", "test-cluster", "myImage:latest", 2, &Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(created)
+	expected := []string{"kind-worker3", "kind-worker4"}
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("expected to create %v, got %v", expected, created)
+	}
+	if len(ready) != len(expected) {
+		t.Errorf("expected %d ready nodes, got %d", len(expected), len(ready))
+	}
+
+	if _, err := addWorkerNodes(context.Background(), status, "kind", "test-cluster", "myImage:latest", 0, &Options{}); err == nil {
+		t.Errorf("expected an error adding no workers")
+	}
+
+	clusterNodeNames = nil
+	if _, err := addWorkerNodes(context.Background(), status, "kind", "test-cluster", "myImage:latest", 1, &Options{}); err == nil {
+		t.Errorf("expected an error adding workers to a cluster without nodes")
+	}
+}
+
+func TestClusterJoinToken(t *testing.T) {
+	cmder := fakeDocker(t)
+	cmder.output = func(command []string) []string {
+		switch {
+		case hasArgs(command, "inspect", "-f", fmt.Sprintf("{{index .Config.Labels %q}}", constants.NodeRoleKey)):
+			if command[len(command)-1] == "kind-control-plane" {
+				return []string{constants.ControlPlaneNodeRoleValue}
+			}
+			return []string{constants.WorkerNodeRoleValue}
+		case hasArgs(command, "cat", kubeadm.ConfigPath):
+			return []string{"bootstrapTokens:", `- token: "abcdef.0123456789abcdef"`}
+		}
+		return nil
+	}
+	existing := []nodes.Node{*nodes.FromName("kind-worker"), *nodes.FromName("kind-control-plane")}
+	token, err := clusterJoinToken(existing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "abcdef.0123456789abcdef" {
+		t.Errorf("expected the token of the kubeadm config, got %q", token)
+	}
+	var read bool
+	for _, command := range cmder.commands {
+		if hasArgs(command, "kind-control-plane", "cat", kubeadm.ConfigPath) {
+			read = true
+		}
+	}
+	if !read {
+		t.Errorf("expected the kubeadm config to be read on the bootstrap control plane, got %v", cmder.commands)
+	}
+}
+
+func TestCreateNodeContainersSuffixedNameTooLong(t *testing.T) {
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		t.Errorf("expected no node to be created, got %s", desiredNode.Name)
+		return nil
+	})
+	// the control plane name is exactly 63 characters before it is suffixed
+	clusterName := strings.Repeat("a", 63-len("-control-plane"))
+	listContainers = func() ([]string, error) {
+		return []string{clusterName + "-control-plane"}, nil
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	opts := &Options{NameCollision: NameCollisionSuffix}
+	_, err := createNodeContainers(context.Background(), status, newTestConfig(0), clusterName, "test-cluster", opts)
+	if err == nil {
+		t.Fatal("expected an error for a suffixed name longer than 63 characters")
+	}
+}
+
+func TestCreateNodeContainersNamePrefix(t *testing.T) {
+	longName := strings.Repeat("a", 60)
+	cases := []struct {
+		TestName    string
+		ClusterName string
+		NamePrefix  string
+		ExpectNames []string
+		ExpectError bool
+	}{
+		{
+			TestName:    "Cluster name",
+			ClusterName: "kind",
+			ExpectNames: []string{"kind-control-plane", "kind-worker"},
+		},
+		{
+			TestName:    "Name prefix overrides a long cluster name",
+			ClusterName: longName,
+			NamePrefix:  "short",
+			ExpectNames: []string{"short-control-plane", "short-worker"},
+		},
+		{
+			TestName:    "Names longer than 63 characters",
+			ClusterName: longName,
+			ExpectError: true,
+		},
+		{
+			TestName:    "Names that are not DNS labels",
+			ClusterName: "kind",
+			NamePrefix:  "Not_A_Label",
+			ExpectError: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			var mu sync.Mutex
+			created := []string{}
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				mu.Lock()
+				defer mu.Unlock()
+				created = append(created, desiredNode.Name)
+				return nil
+			})
+			status := logutil.NewStatus(ioutil.Discard)
+			opts := &Options{NamePrefix: tc.NamePrefix}
+
+			_, err := createNodeContainers(context.Background(), status, newTestConfig(1), tc.ClusterName, "test-cluster", opts)
+			if tc.ExpectError {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if len(created) != 0 {
+					t.Errorf("expected no nodes to be created, got %v", created)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sort.Strings(created)
+			if !reflect.DeepEqual(created, tc.ExpectNames) {
+				t.Errorf("expected nodes %v, got %v", tc.ExpectNames, created)
+			}
+		})
+	}
+}
+
+func TestSortNodes(t *testing.T) {
+	// same role nodes in arbitrary orders, as they may come from a plan
+	orders := [][]nodeSpec{
+		{
+			{Name: "kind-worker10", Role: constants.WorkerNodeRoleValue},
+			{Name: "kind-control-plane", Role: constants.ControlPlaneNodeRoleValue},
+			{Name: "kind-worker2", Role: constants.WorkerNodeRoleValue},
+			{Name: "kind-worker", Role: constants.WorkerNodeRoleValue},
+			{Name: "kind-control-plane2", Role: constants.ControlPlaneNodeRoleValue},
+		},
+		{
+			{Name: "kind-worker", Role: constants.WorkerNodeRoleValue},
+			{Name: "kind-control-plane2", Role: constants.ControlPlaneNodeRoleValue},
+			{Name: "kind-worker2", Role: constants.WorkerNodeRoleValue},
+			{Name: "kind-control-plane", Role: constants.ControlPlaneNodeRoleValue},
+			{Name: "kind-worker10", Role: constants.WorkerNodeRoleValue},
+		},
+	}
+	expected := []string{
+		"kind-control-plane", "kind-control-plane2", "kind-worker", "kind-worker2", "kind-worker10",
+	}
+	for _, nodes := range orders {
+		sortNodes(nodes, DefaultRoleOrder())
+		names := []string{}
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected order %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestCreateNodeContainersTimeout(t *testing.T) {
+	cmder := fakeDocker(t)
+	// the creator of one node never completes, the goroutine is left blocked
+	hang := make(chan struct{})
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		if desiredNode.Name == "kind-worker2" {
+			<-hang
+		}
+		return nil
+	})
+	status := logutil.NewStatus(ioutil.Discard)
+	opts := &Options{ProvisionTimeout: 50 * time.Millisecond}
+
+	result, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", opts)
+	if err == nil {
+		t.Fatalf("expected a timeout error")
+	}
+	if !strings.Contains(err.Error(), "outstanding nodes: kind-worker2") {
+		t.Errorf("expected the error to name the outstanding node, got: %v", err)
+	}
+	if len(result.Ready) != 0 {
+		t.Errorf("expected no ready nodes, got %d", len(result.Ready))
+	}
+	// the provisioned nodes and the outstanding one are deleted
+	deleted := sets.NewString(cmder.deleted()...)
+	expected := sets.NewString("kind-control-plane", "kind-worker", "kind-worker2")
+	if !deleted.Equal(expected) {
+		t.Errorf("expected deleted nodes %v, got %v", expected.List(), deleted.List())
+	}
+}
+
+func TestCreateNodeContainersAggregatesErrors(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		FailNodes   []string
+		ExpectError string
+	}{
+		{
+			TestName:    "Single failure",
+			FailNodes:   []string{"kind-worker2"},
+			ExpectError: "boom creating kind-worker2",
+		},
+		{
+			TestName:  "Multiple failures",
+			FailNodes: []string{"kind-worker2", "kind-worker"},
+			ExpectError: "2 nodes failed to provision\n" +
+				"node kind-worker: boom creating kind-worker\n" +
+				"node kind-worker2: boom creating kind-worker2\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			failNodes := sets.NewString(tc.FailNodes...)
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				if failNodes.Has(desiredNode.Name) {
+					return errors.Errorf("boom creating %s", desiredNode.Name)
+				}
+				return nil
+			})
+			status := logutil.NewStatus(ioutil.Discard)
+			opts := &Options{CreateAttempts: 1}
+
+			result, err := createNodeContainers(context.Background(), status, newTestConfig(3), "kind", "test-cluster", opts)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if err.Error() != tc.ExpectError {
+				t.Errorf("expected error %q, got %q", tc.ExpectError, err.Error())
+			}
+			if len(result.Ready) != 0 {
+				t.Errorf("expected no ready nodes, got %d", len(result.Ready))
+			}
+			// every node that was created is deleted
+			deleted := sets.NewString(cmder.deleted()...)
+			expected := sets.NewString("kind-control-plane", "kind-worker", "kind-worker2", "kind-worker3").Difference(failNodes)
+			if !deleted.Equal(expected) {
+				t.Errorf("expected deleted nodes %v, got %v", expected.List(), deleted.List())
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersRecoversPanics(t *testing.T) {
+	cmder := fakeDocker(t)
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		if desiredNode.Name == "kind-worker" {
+			var node *nodes.Node
+			node.Name() // nil pointer dereference
+		}
+		return nil
+	})
+	status := logutil.NewStatus(ioutil.Discard)
+
+	_, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", &Options{CreateAttempts: 1})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !strings.HasPrefix(err.Error(), "panic provisioning node kind-worker: ") {
+		t.Errorf("expected the error to name the panicking node, got: %v", err)
+	}
+	// the panicking node is cleaned up along with the others
+	deleted := sets.NewString(cmder.deleted()...)
+	expected := sets.NewString("kind-control-plane", "kind-worker", "kind-worker2")
+	if !deleted.Equal(expected) {
+		t.Errorf("expected deleted nodes %v, got %v", expected.List(), deleted.List())
+	}
+}
+
+func TestCreateNodeContainersReportsProgress(t *testing.T) {
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		return nil
+	})
+	// without a terminal each status update is printed on its own line
+	var out bytes.Buffer
+	status := logutil.NewStatus(&out)
+
+	if _, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updates := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, " • ") && strings.Contains(line, "ready)") {
+			updates = append(updates, line[strings.LastIndex(line, "(")+1:strings.LastIndex(line, ")")])
+		}
+	}
+	expected := []string{"1/3 ready", "2/3 ready", "3/3 ready"}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected status updates %v, got %v in:\n%s", expected, updates, out.String())
+	}
+}
+
+func TestCreateNodeContainersNameConflicts(t *testing.T) {
+	cases := []struct {
+		TestName      string
+		Plan          []PlannedNode
+		Existing      []string
+		AdoptNodes    map[string][]string
+		NameCollision string
+		ExpectError   string
+	}{
+		{
+			TestName: "Duplicate node names",
+			Plan: []PlannedNode{
+				{Name: "kind-control-plane", Role: constants.ControlPlaneNodeRoleValue, Image: "myImage:latest"},
+				{Name: "kind-worker", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"},
+				{Name: "kind-worker", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"},
+			},
+			ExpectError: "node names are used by more than one node: kind-worker (2 nodes)",
+		},
+		{
+			TestName: "Existing containers",
+			Plan: []PlannedNode{
+				{Name: "kind-control-plane", Role: constants.ControlPlaneNodeRoleValue, Image: "myImage:latest"},
+				{Name: "kind-worker", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"},
+				{Name: "kind-worker2", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"},
+			},
+			Existing:    []string{"kind-worker2", "kind-control-plane", "other"},
+			ExpectError: "containers with the node names already exist: kind-control-plane, kind-worker2",
+		},
+		{
+			TestName: "Adopted node name taken by another node",
+			Plan: []PlannedNode{
+				{Name: "kind-control-plane", Role: constants.ControlPlaneNodeRoleValue, Image: "myImage:latest"},
+				{Name: "kind-worker", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"},
+				{Name: "kind-worker2", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest"},
+			},
+			Existing:      []string{"kind-worker2"},
+			AdoptNodes:    map[string][]string{constants.WorkerNodeRoleValue: {"kind-worker2"}},
+			NameCollision: NameCollisionAdopt,
+			ExpectError:   "node names are used by more than one node: kind-worker2 (2 nodes)",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			created := 0
+			fakeContainers(t, func(desiredNode *nodeSpec) error {
+				created++
+				return nil
+			})
+			listContainers = func() ([]string, error) {
+				return tc.Existing, nil
+			}
+			status := logutil.NewStatus(ioutil.Discard)
+			opts := &Options{plan: tc.Plan, AdoptNodes: tc.AdoptNodes, NameCollision: tc.NameCollision}
+
+			_, err := createNodeContainers(context.Background(), status, &config.Config{}, "kind", "test-cluster", opts)
+			if err == nil || err.Error() != tc.ExpectError {
+				t.Errorf("expected error %q, got: %v", tc.ExpectError, err)
+			}
+			if created != 0 {
+				t.Errorf("expected no nodes to be created, got %d", created)
+			}
+		})
+	}
+}
+
+func TestResolveNameCollisions(t *testing.T) {
+	cases := []struct {
+		TestName      string
+		Strategy      string
+		Existing      []string
+		Adopted       []string
+		ExpectNames   []string
+		ExpectAdopted []string
+		ExpectError   string
+	}{
+		{
+			TestName:      "No collisions",
+			Strategy:      NameCollisionFail,
+			Existing:      []string{"other"},
+			ExpectNames:   []string{"kind-control-plane", "kind-worker", "kind-worker-1"},
+			ExpectAdopted: []string{},
+		},
+		{
+			TestName:    "Fail",
+			Strategy:    NameCollisionFail,
+			Existing:    []string{"kind-worker-1", "kind-control-plane"},
+			ExpectError: "containers with the node names already exist: kind-control-plane, kind-worker-1",
+		},
+		{
+			TestName:    "Fail by default",
+			Strategy:    "",
+			Existing:    []string{"kind-worker"},
+			ExpectError: "containers with the node names already exist: kind-worker",
+		},
+		{
+			TestName:      "Adopted nodes do not collide",
+			Strategy:      NameCollisionFail,
+			Existing:      []string{"kind-worker"},
+			Adopted:       []string{"kind-worker"},
+			ExpectNames:   []string{"kind-control-plane", "kind-worker", "kind-worker-1"},
+			ExpectAdopted: []string{"kind-worker"},
+		},
+		{
+			TestName:      "Adopt",
+			Strategy:      NameCollisionAdopt,
+			Existing:      []string{"kind-worker", "other"},
+			ExpectNames:   []string{"kind-control-plane", "kind-worker", "kind-worker-1"},
+			ExpectAdopted: []string{"kind-worker"},
+		},
+		{
+			TestName:      "Suffix",
+			Strategy:      NameCollisionSuffix,
+			Existing:      []string{"kind-control-plane"},
+			ExpectNames:   []string{"kind-control-plane-1", "kind-worker", "kind-worker-1"},
+			ExpectAdopted: []string{},
+		},
+		{
+			// kind-worker-1 is planned, so kind-worker is renamed past it
+			TestName:      "Suffix colliding with a planned node",
+			Strategy:      NameCollisionSuffix,
+			Existing:      []string{"kind-worker"},
+			ExpectNames:   []string{"kind-control-plane", "kind-worker-2", "kind-worker-1"},
+			ExpectAdopted: []string{},
+		},
+		{
+			TestName:      "Suffix colliding with existing and renamed nodes",
+			Strategy:      NameCollisionSuffix,
+			Existing:      []string{"kind-worker", "kind-worker-1", "kind-worker-2"},
+			ExpectNames:   []string{"kind-control-plane", "kind-worker-3", "kind-worker-1-1"},
+			ExpectAdopted: []string{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			fakeContainers(t, func(desiredNode *nodeSpec) error { return nil })
+			listContainers = func() ([]string, error) {
+				return tc.Existing, nil
+			}
+			adopted := sets.NewString(tc.Adopted...)
+			desiredNodes := []nodeSpec{}
+			for _, name := range []string{"kind-control-plane", "kind-worker", "kind-worker-1"} {
+				desiredNodes = append(desiredNodes, nodeSpec{Name: name, Adopted: adopted.Has(name)})
+			}
+			logger := log.New()
+			logger.Out = ioutil.Discard
+			err := resolveNameCollisions(desiredNodes, tc.Strategy, logger)
+			if tc.ExpectError != "" {
+				if err == nil || err.Error() != tc.ExpectError {
+					t.Errorf("expected error %q, got: %v", tc.ExpectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			names := []string{}
+			adoptedNames := []string{}
+			for _, desiredNode := range desiredNodes {
+				names = append(names, desiredNode.Name)
+				if desiredNode.Adopted {
+					adoptedNames = append(adoptedNames, desiredNode.Name)
+				}
+			}
+			if !reflect.DeepEqual(names, tc.ExpectNames) {
+				t.Errorf("expected names %v, got %v", tc.ExpectNames, names)
+			}
+			if !reflect.DeepEqual(adoptedNames, tc.ExpectAdopted) {
+				t.Errorf("expected adopted nodes %v, got %v", tc.ExpectAdopted, adoptedNames)
+			}
+			if err := checkDuplicateNodeNames(desiredNodes); err != nil {
+				t.Errorf("expected unique names, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestFixupNodePostCreateExec(t *testing.T) {
+	commands := [][]string{
+		{"update-ca-certificates"},
+		{"sysctl", "-w", "fs.inotify.max_user_watches=524288"},
+		{"systemctl", "restart", "docker"},
+	}
+	cases := []struct {
+		TestName       string
+		FailArgs       []string
+		ExpectCommands int
+		ExpectError    string
+	}{
+		{
+			TestName:       "Commands run in order",
+			ExpectCommands: 3,
+		},
+		{
+			TestName:       "A failing command fails the node",
+			FailArgs:       []string{"sysctl", "-w"},
+			ExpectCommands: 2,
+			ExpectError:    "post create command [sysctl -w fs.inotify.max_user_watches=524288] failed on node kind-worker",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			if tc.FailArgs != nil {
+				cmder.failArgs = [][]string{tc.FailArgs}
+			}
+			node := nodes.FromName("kind-worker")
+			desiredNode := nodeSpec{Name: node.Name(), PostCreateExec: commands}
+
+			err := fixupNode(node, desiredNode, []string{PostCreateExecPhase}, &Options{})
+			if tc.ExpectError == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.ExpectError != "" && (err == nil || !strings.HasPrefix(err.Error(), tc.ExpectError)) {
+				t.Fatalf("expected error %q, got: %v", tc.ExpectError, err)
+			}
+			// each command runs in the node, stopping at the first failure
+			ran := []string{}
+			for _, command := range cmder.commands {
+				if hasArgs(command, "docker", "exec") {
+					ran = append(ran, strings.Join(command, " "))
+				}
+			}
+			if len(ran) != tc.ExpectCommands {
+				t.Fatalf("expected %d commands, got %v", tc.ExpectCommands, ran)
+			}
+			for i, command := range ran {
+				if !strings.HasSuffix(command, " kind-worker "+strings.Join(commands[i], " ")) {
+					t.Errorf("expected command %d to run %v in kind-worker, got %q", i, commands[i], command)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersLoadBalancerPort(t *testing.T) {
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+		},
+	}
+	// a free host port for the load balancer
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to get a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// the port is still in use
+	cmder := fakeDocker(t)
+	status := logutil.NewStatus(ioutil.Discard)
+	_, err = createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{LoadBalancerPort: port})
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("host port %d of node kind-external-load-balancer is not available", port)) {
+		t.Errorf("expected a host port conflict error, got: %v", err)
+	}
+	if runs := cmder.dockerRuns(); len(runs) != 0 {
+		t.Errorf("expected no nodes to be created, got %d", len(runs))
+	}
+
+	// the configured port reaches the load balancer only
+	listener.Close()
+	cmder = fakeDocker(t)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{LoadBalancerPort: port}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	published := fmt.Sprintf("%d:%d", port, haproxy.ControlPlanePort)
+	for _, args := range cmder.dockerRuns() {
+		isLoadBalancer := hasArgs(args, "--name", "kind-external-load-balancer")
+		if hasArgs(args, "-p", published) != isLoadBalancer {
+			t.Errorf("expected only the load balancer to publish %s, got %v", published, args)
+		}
+	}
+}
+
+func TestNodesToCreateDropsLoadBalancer(t *testing.T) {
+	one, two := int32(1), int32(2)
+	cases := []struct {
+		TestName         string
+		ControlPlane     int32
+		Keep             bool
+		LoadBalancerPort int
+		ExpectLB         bool
+		ExpectNodes      int
+		ExpectPortError  bool
+	}{
+		{TestName: "single control plane", ControlPlane: one, ExpectLB: false, ExpectNodes: 2},
+		{TestName: "single control plane, kept", ControlPlane: one, Keep: true, ExpectLB: true, ExpectNodes: 3},
+		{TestName: "multiple control planes", ControlPlane: two, ExpectLB: true, ExpectNodes: 4},
+		{
+			TestName: "single control plane with a load balancer port", ControlPlane: one, LoadBalancerPort: 6443,
+			ExpectLB: false, ExpectNodes: 2, ExpectPortError: true,
+		},
+		{
+			TestName: "single control plane with a load balancer port, kept", ControlPlane: one, Keep: true,
+			LoadBalancerPort: 6443, ExpectLB: true, ExpectNodes: 3,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc // capture tc
+		t.Run(tc.TestName, func(t *testing.T) {
+			replicas := tc.ControlPlane
+			cfg := &config.Config{
+				Nodes: []config.Node{
+					{Role: config.ExternalLoadBalancerRole},
+					{Role: config.ControlPlaneRole, Replicas: &replicas},
+					{Role: config.WorkerRole},
+				},
+			}
+			desiredNodes, err := nodesToCreate(cfg, "kind", DefaultRoleOrder(), nil, tc.Keep, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			hasLB := false
+			for _, desiredNode := range desiredNodes {
+				if desiredNode.Role == constants.ExternalLoadBalancerNodeRoleValue {
+					hasLB = true
+				}
+			}
+			if hasLB != tc.ExpectLB {
+				t.Errorf("expected load balancer: %v, got nodes %v", tc.ExpectLB, desiredNodes)
+			}
+			if len(desiredNodes) != tc.ExpectNodes {
+				t.Errorf("expected %d nodes, got %d", tc.ExpectNodes, len(desiredNodes))
+			}
+			// the port of a dropped load balancer is not silently ignored
+			if err := checkLoadBalancerPort(desiredNodes, tc.LoadBalancerPort); (err != nil) != tc.ExpectPortError {
+				t.Errorf("expected load balancer port error: %v, got: %v", tc.ExpectPortError, err)
+			}
+		})
+	}
+}
+
+func TestProvisionNodesNetwork(t *testing.T) {
+	// the dedicated network does not exist yet, so it is created
+	cmder := fakeDocker(t)
+	cmder.failArgs = [][]string{{"network", "inspect", "kind-kind"}}
+	status := logutil.NewStatus(ioutil.Discard)
+	opts := &Options{DedicatedNetwork: true}
+	if _, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := false
+	for _, command := range cmder.commands {
+		if hasArgs(command, "network", "create") {
+			created = hasArgs(command, "--label", "test-cluster") && command[len(command)-1] == "kind-kind"
+		}
+	}
+	if !created {
+		t.Errorf("expected the labeled network kind-kind to be created, got %v", cmder.commands)
+	}
+	runs := cmder.dockerRuns()
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 nodes to be created, got %d", len(runs))
+	}
+	for _, args := range runs {
+		if !hasArgs(args, "--network", "kind-kind") {
+			t.Errorf("expected the node to be created on network kind-kind, got %v", args)
+		}
+	}
+
+	// an existing network is used as is
+	cmder = fakeDocker(t)
+	opts = &Options{Network: "existing"}
+	if _, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, command := range cmder.commands {
+		if hasArgs(command, "network", "create") {
+			t.Errorf("expected no network to be created, got %v", command)
+		}
+	}
+	for _, args := range cmder.dockerRuns() {
+		if !hasArgs(args, "--network", "existing") {
+			t.Errorf("expected the node to be created on network existing, got %v", args)
+		}
+	}
+
+	// but it must exist
+	cmder = fakeDocker(t)
+	cmder.failArgs = [][]string{{"network", "inspect", "missing"}}
+	opts = &Options{Network: "missing"}
+	_, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts)
+	if err == nil || !strings.Contains(err.Error(), "network missing does not exist") {
+		t.Errorf("expected a missing network error, got: %v", err)
+	}
+	if runs := cmder.dockerRuns(); len(runs) != 0 {
+		t.Errorf("expected no nodes to be created, got %d", len(runs))
+	}
+}
+
+func TestProvisionNodesDeletesCreatedNetworks(t *testing.T) {
+	// neither network exists yet, so both are created
+	cmder := fakeDocker(t)
+	cmder.failArgs = [][]string{
+		{"network", "inspect", "kind-kind"},
+		{"network", "inspect", "kind-kind-macvlan"},
+	}
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		return errors.Errorf("injected failure creating node %s", desiredNode.Name)
+	})
+	status := logutil.NewStatus(ioutil.Discard)
+	opts := &Options{
+		DedicatedNetwork: true,
+		Macvlan:          &MacvlanNetwork{Parent: "eth0", Subnet: "192.168.1.0/24"},
+		CreateAttempts:   1,
+	}
+	if _, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts); err == nil {
+		t.Fatal("expected an error")
+	}
+	deleted := []string{}
+	for _, command := range cmder.commands {
+		if hasArgs(command, "docker", "network", "rm") {
+			deleted = append(deleted, command[len(command)-1])
+		}
+	}
+	expected := []string{"kind-kind-macvlan", "kind-kind"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected the created networks %v to be deleted, got %v", expected, deleted)
+	}
+}
+
+func TestProvisionNodesIPFamily(t *testing.T) {
+	status := logutil.NewStatus(ioutil.Discard)
+	cases := []struct {
+		family      string
+		wantNetwork bool
+		wantSysctls bool
+	}{
+		{family: "", wantNetwork: false, wantSysctls: false},
+		{family: IPFamilyIPv4, wantNetwork: false, wantSysctls: false},
+		{family: IPFamilyIPv6, wantNetwork: true, wantSysctls: true},
+		{family: IPFamilyDual, wantNetwork: true, wantSysctls: true},
+	}
+	for _, tc := range cases {
+		cmder := fakeDocker(t)
+		cmder.failArgs = [][]string{{"network", "inspect", "kind-kind"}}
+		opts := &Options{IPFamily: tc.family}
+		if _, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts); err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.family, err)
+		}
+		createdIPv6 := false
+		for _, command := range cmder.commands {
+			if hasArgs(command, "network", "create") {
+				createdIPv6 = hasArgs(command, "--ipv6") &&
+					hasArgs(command, "--subnet", dedicatedNetworkIPv6Subnet) &&
+					command[len(command)-1] == "kind-kind"
+			}
+		}
+		if createdIPv6 != tc.wantNetwork {
+			t.Errorf("%q: expected IPv6 network kind-kind to be created: %v, got %v", tc.family, tc.wantNetwork, cmder.commands)
+		}
+		runs := cmder.dockerRuns()
+		if len(runs) != 2 {
+			t.Fatalf("%q: expected 2 nodes to be created, got %d", tc.family, len(runs))
+		}
+		for _, args := range runs {
+			if hasArgs(args, "--network", "kind-kind") != tc.wantNetwork {
+				t.Errorf("%q: expected the node on network kind-kind: %v, got %v", tc.family, tc.wantNetwork, args)
+			}
+			if hasArgs(args, "--sysctl", "net.ipv6.conf.all.disable_ipv6=0") != tc.wantSysctls ||
+				hasArgs(args, "--sysctl", "net.ipv6.conf.all.forwarding=1") != tc.wantSysctls {
+				t.Errorf("%q: expected the IPv6 sysctls: %v, got %v", tc.family, tc.wantSysctls, args)
+			}
+		}
+	}
+
+	// an existing network must have IPv6 enabled
+	for _, enabled := range []string{"true", "false"} {
+		cmder := fakeDocker(t)
+		cmder.output = func(command []string) []string {
+			if hasArgs(command, "{{.EnableIPv6}}") {
+				return []string{enabled}
+			}
+			return nil
+		}
+		opts := &Options{IPFamily: IPFamilyDual, Network: "existing"}
+		_, err := provisionNodes(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts)
+		if enabled == "true" && err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if enabled == "false" && (err == nil || !strings.Contains(err.Error(), "does not have IPv6 enabled")) {
+			t.Errorf("expected an IPv6 network error, got: %v", err)
+		}
+	}
+
+	if err := validateIPFamily("ipv5"); err == nil {
+		t.Error("expected an unknown IP family error")
+	}
+}
+
+func TestFixupNodeWaitForDockerTimeoutLogs(t *testing.T) {
+	cmder := fakeDocker(t)
+	// docker never becomes active
+	cmder.failArgs = [][]string{{"systemctl", "is-active", "docker"}}
+	for i := 0; i < 60; i++ {
+		cmder.logs = append(cmder.logs, fmt.Sprintf("log line %d", i))
+	}
+	cmder.logs = append(cmder.logs, "Failed to start Docker Application Container Engine.")
+	node := nodes.FromName("kind-worker")
+	opts := &Options{NodeDockerTimeout: time.Millisecond, NodeDockerPollInterval: time.Millisecond}
+	err := fixupNode(node, nodeSpec{Name: node.Name()}, []string{WaitForDockerPhase}, opts)
+	if err == nil {
+		t.Fatalf("expected a timeout error")
+	}
+	if !strings.Contains(err.Error(), "timed out waiting for docker to be ready on node kind-worker") {
+		t.Errorf("expected the error to name the node, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "Failed to start Docker Application Container Engine.") {
+		t.Errorf("expected the error to include the node logs, got: %v", err)
+	}
+	// the logs are bounded
+	for _, command := range cmder.commands {
+		if hasArgs(command, "docker", "logs") && !hasArgs(command, "--tail", "50", "kind-worker") {
+			t.Errorf("expected the logs tail to be bounded, got %v", command)
+		}
+	}
+}
+
+func TestProvisionNodesConcurrentRoleOrders(t *testing.T) {
+	fakeDocker(t)
+	two := int32(2)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest", Replicas: &two},
+			{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two},
+		},
+	}
+	// provisionOrder returns the node names in the dry run plan
+	provisionOrder := func(roleOrder []string) ([]string, error) {
+		var out bytes.Buffer
+		opts := &Options{DryRun: true, RoleOrder: roleOrder, out: &out}
+		status := logutil.NewStatus(ioutil.Discard)
+		if _, err := provisionNodes(context.Background(), status, cfg, "kind", "test-cluster", opts); err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+			names = append(names, strings.Fields(line)[0])
+		}
+		return names, nil
+	}
+	cases := []struct {
+		RoleOrder   []string
+		ExpectNames []string
+	}{
+		{
+			RoleOrder:   []string{"control-plane", "worker"},
+			ExpectNames: []string{"kind-control-plane", "kind-control-plane2", "kind-worker", "kind-worker2"},
+		},
+		{
+			RoleOrder:   []string{"worker", "control-plane"},
+			ExpectNames: []string{"kind-worker", "kind-worker2", "kind-control-plane", "kind-control-plane2"},
+		},
+		{
+			// the default order
+			RoleOrder:   nil,
+			ExpectNames: []string{"kind-control-plane", "kind-control-plane2", "kind-worker", "kind-worker2"},
+		},
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(cases)*10)
+	for _, tc := range cases {
+		tc := tc // capture tc
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				names, err := provisionOrder(tc.RoleOrder)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !reflect.DeepEqual(names, tc.ExpectNames) {
+					errs <- errors.Errorf("role order %v: expected %v, got %v", tc.RoleOrder, tc.ExpectNames, names)
+				}
+			}()
+		}
+	}
+	// modifying a copy of the default does not affect any cluster
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			roleOrder := DefaultRoleOrder()
+			roleOrder[0], roleOrder[len(roleOrder)-1] = roleOrder[len(roleOrder)-1], roleOrder[0]
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCreateNodeContainersPauseAfterMounts(t *testing.T) {
+	cmder := fakeDocker(t)
+	// run the real fixup phases against the fake docker
+	fixupContainer = fixupNode
+	realFixMounts := fixMounts
+	t.Cleanup(func() { fixMounts = realFixMounts })
+	var mu sync.Mutex
+	fixes := 0
+	fixMounts = func(node *nodes.Node) error {
+		mu.Lock()
+		defer mu.Unlock()
+		fixes++
+		return nil
+	}
+
+	opts := &Options{PauseAfterMounts: true}
+	status := logutil.NewStatus(ioutil.Discard)
+	result, err := createNodeContainers(context.Background(), status, newTestConfig(1), "kind", "test-cluster", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Ready) != 2 {
+		t.Errorf("expected 2 nodes to be returned, got %d", len(result.Ready))
+	}
+	if fixes != 2 {
+		t.Errorf("expected the mounts of 2 nodes to be fixed, got %d", fixes)
+	}
+	for _, command := range cmder.commands {
+		// SignalStart and WaitForDocker
+		if hasArgs(command, "docker", "kill") || hasArgs(command, "systemctl", "is-active") {
+			t.Errorf("expected the nodes not to boot, got %v", command)
+		}
+	}
+}
+
+func TestNodesToCreateKubeletExtraArgs(t *testing.T) {
+	two := int32(2)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{
+				Role:             config.ControlPlaneRole,
+				KubeletExtraArgs: map[string]string{"system-reserved": "cpu=1"},
+			},
+			{
+				Role:             config.WorkerRole,
+				Replicas:         &two,
+				KubeletExtraArgs: map[string]string{"system-reserved": "cpu=500m"},
+			},
+		},
+	}
+
+	// each replica gets a copy of the args
+	replicas, err := convertReplicas(cfg.Nodes[1:])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replicas) != 2 {
+		t.Fatalf("expected 2 replicas, got %d", len(replicas))
+	}
+	replicas[0].KubeletExtraArgs["v"] = "4"
+	if _, ok := replicas[1].KubeletExtraArgs["v"]; ok {
+		t.Errorf("expected the replicas not to share their kubelet extra args")
+	}
+	if _, ok := cfg.Nodes[1].KubeletExtraArgs["v"]; ok {
+		t.Errorf("expected the replicas not to share the config's kubelet extra args")
+	}
+
+	desiredNodes, err := nodesToCreate(cfg, "kind", DefaultRoleOrder(), nil, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"kind-control-plane": "cpu=1",
+		"kind-worker":        "cpu=500m",
+		"kind-worker2":       "cpu=500m",
+	}
+	reserved := map[string]string{}
+	for _, desiredNode := range desiredNodes {
+		reserved[desiredNode.Name] = desiredNode.KubeletExtraArgs["system-reserved"]
+	}
+	if !reflect.DeepEqual(reserved, expected) {
+		t.Errorf("expected system-reserved %v, got %v", expected, reserved)
+	}
+}
+
+func TestCreateNodeContainersMutateNode(t *testing.T) {
+	var mu sync.Mutex
+	images := map[string]string{}
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		mu.Lock()
+		defer mu.Unlock()
+		images[desiredNode.Name] = desiredNode.Image
+		return nil
+	})
+	status := logutil.NewStatus(ioutil.Discard)
+
+	// the mutated image reaches Create
+	opts := &Options{
+		MutateNode: func(node *PlannedNode) error {
+			if node.Role == constants.WorkerNodeRoleValue {
+				node.Image = "worker:mutated"
+			}
+			return nil
+		},
+	}
+	if _, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"kind-control-plane": "myImage:latest",
+		"kind-worker":        "worker:mutated",
+		"kind-worker2":       "worker:mutated",
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected images %v, got %v", expected, images)
+	}
+
+	// rejecting a node aborts before creating any node
+	images = map[string]string{}
+	opts.MutateNode = func(node *PlannedNode) error {
+		if node.Name == "kind-worker2" {
+			return errors.New("no second worker")
+		}
+		return nil
+	}
+	_, err := createNodeContainers(context.Background(), status, newTestConfig(2), "kind", "test-cluster", opts)
+	if err == nil || !strings.Contains(err.Error(), "node kind-worker2 was rejected: no second worker") {
+		t.Errorf("expected the node to be rejected, got: %v", err)
+	}
+	if len(images) != 0 {
+		t.Errorf("expected no nodes to be created, got %v", images)
+	}
+
+	// the name may not be changed
+	opts.MutateNode = func(node *PlannedNode) error {
+		node.Name = "renamed"
+		return nil
+	}
+	if _, err := createNodeContainers(context.Background(), status, newTestConfig(0), "kind", "test-cluster", opts); err == nil {
+		t.Errorf("expected an error renaming the node")
+	}
+}
+
+func TestNodeIcons(t *testing.T) {
+	cases := []struct {
+		Count    int
+		Expected string
+	}{
+		{Count: 1, Expected: "📦"},
+		{Count: 3, Expected: "📦📦📦"},
+		{Count: maxNodeIcons, Expected: strings.Repeat("📦", maxNodeIcons)},
+		{Count: maxNodeIcons + 1, Expected: fmt.Sprintf("📦×%d", maxNodeIcons+1)},
+		{Count: 50, Expected: "📦×50"},
+	}
+	for _, tc := range cases {
+		if icons := nodeIcons(tc.Count); icons != tc.Expected {
+			t.Errorf("expected %q for %d nodes, got %q", tc.Expected, tc.Count, icons)
+		}
+	}
+}
+
+func TestCreateNodeContainersHostname(t *testing.T) {
+	two := int32(2)
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "myImage:latest", Replicas: &two, Hostname: "k8s-{{.Role}}-{{.Index}}"},
+		},
+	}
+	cmder := fakeDocker(t)
+	status := logutil.NewStatus(ioutil.Discard)
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"kind-control-plane": "kind-control-plane",
+		"kind-worker":        "k8s-worker-1",
+		"kind-worker2":       "k8s-worker-2",
+	}
+	hostnames := map[string]string{}
+	for _, args := range cmder.dockerRuns() {
+		var name, hostname string
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--name":
+				name = args[i+1]
+			case "--hostname":
+				hostname = args[i+1]
+			}
+		}
+		hostnames[name] = hostname
+	}
+	if !reflect.DeepEqual(hostnames, expected) {
+		t.Errorf("expected hostnames %v, got %v", expected, hostnames)
+	}
+
+	invalid := []struct {
+		Hostname    string
+		ExpectError string
+	}{
+		{Hostname: "{{.Role}}_{{.Index}}", ExpectError: `invalid hostname "worker_1" for node kind-worker`},
+		{Hostname: "worker", ExpectError: `nodes kind-worker and kind-worker2 have the same hostname "worker"`},
+		{Hostname: "{{.Zone}}", ExpectError: `failed to expand hostname template "{{.Zone}}"`},
+	}
+	for _, tc := range invalid {
+		cfg.Nodes[1].Hostname = tc.Hostname
+		cmder = fakeDocker(t)
+		_, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{})
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectError) {
+			t.Errorf("expected an error containing %q, got: %v", tc.ExpectError, err)
+		}
+		if runs := cmder.dockerRuns(); len(runs) != 0 {
+			t.Errorf("expected no nodes to be created, got %d", len(runs))
+		}
+	}
+}
+
+func TestFixupNodeSignalStartRetries(t *testing.T) {
+	realTimeout := signalStartProbeTimeout
+	t.Cleanup(func() { signalStartProbeTimeout = realTimeout })
+	signalStartProbeTimeout = 10 * time.Millisecond
+
+	cases := []struct {
+		TestName     string
+		Retries      int
+		MissedSignal int
+		ExpectKills  int
+		ExpectProbes bool
+	}{
+		{TestName: "Node boots on the first signal", Retries: 0, MissedSignal: 0, ExpectKills: 1, ExpectProbes: true},
+		{TestName: "Missed first signal", Retries: 0, MissedSignal: 1, ExpectKills: 2, ExpectProbes: true},
+		{TestName: "Node never boots", Retries: 2, MissedSignal: 10, ExpectKills: 3, ExpectProbes: true},
+		{TestName: "Retries disabled", Retries: -1, MissedSignal: 1, ExpectKills: 1, ExpectProbes: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			cmder := fakeDocker(t)
+			kills, probes := 0, 0
+			cmder.output = func(command []string) []string {
+				switch {
+				case hasArgs(command, "docker", "kill", "-s", "SIGUSR1"):
+					kills++
+				case hasArgs(command, "cat", "/proc/1/comm"):
+					probes++
+					// the entrypoint is still PID 1 until it gets a signal
+					if kills <= tc.MissedSignal {
+						return []string{"entrypoint"}
+					}
+				}
+				return nil
+			}
+			node := nodes.FromName("kind-worker")
+			opts := &Options{SignalStartRetries: tc.Retries, NodeDockerPollInterval: time.Millisecond}
+			if err := fixupNode(node, nodeSpec{Name: node.Name()}, []string{SignalStartPhase}, opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kills != tc.ExpectKills {
+				t.Errorf("expected %d signals, got %d", tc.ExpectKills, kills)
+			}
+			if (probes > 0) != tc.ExpectProbes {
+				t.Errorf("expected probes: %v, got %d probes", tc.ExpectProbes, probes)
+			}
+		})
+	}
+}
+
+func TestCreateNodeContainersExtraHosts(t *testing.T) {
+	extraHosts := []string{"registry.local:10.0.0.5", "mirror.local:fd00::5"}
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest", ExtraHosts: extraHosts},
+			{Role: config.WorkerRole, Image: "myImage:latest", ExtraHosts: extraHosts},
+			{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest", ExtraHosts: extraHosts},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error validating the config: %v", err)
+	}
+	cmder := fakeDocker(t)
+	status := logutil.NewStatus(ioutil.Discard)
+	opts := &Options{KeepLoadBalancer: true}
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", nodes.NewClusterLabel("kind"), opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runs := cmder.dockerRuns()
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 nodes to be created, got %d", len(runs))
+	}
+	for _, args := range runs {
+		for _, host := range extraHosts {
+			if !hasArgs(args, "--add-host", host) {
+				t.Errorf("expected --add-host %s, got %v", host, args)
+			}
+		}
+	}
+
+	// malformed entries are rejected
+	cfg.Nodes[1].ExtraHosts = []string{"registry.local=10.0.0.5"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "must be host:ip") {
+		t.Errorf("expected a malformed extra host error, got: %v", err)
+	}
+}
+
+func TestCreateNodeContainersContainerLabels(t *testing.T) {
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "myImage:latest", ContainerLabels: map[string]string{"team": "infra"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error validating the config: %v", err)
+	}
+	cmder := fakeDocker(t)
+	status := logutil.NewStatus(ioutil.Discard)
+	label := nodes.NewClusterLabel("kind")
+	if _, err := createNodeContainers(context.Background(), status, cfg, "kind", label, &Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runs := cmder.dockerRuns()
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 nodes to be created, got %d", len(runs))
+	}
+	for _, args := range runs {
+		if !hasArgs(args, "--label", string(label)) {
+			t.Errorf("expected the cluster label, got %v", args)
+		}
+		isWorker := hasArgs(args, "--name", "kind-worker")
+		if isWorker && !hasArgs(args, "--label", constants.NodeRoleKey+"=worker") {
+			t.Errorf("expected the role label, got %v", args)
+		}
+		if hasArgs(args, "--label", "team=infra") != isWorker {
+			t.Errorf("expected only the worker to have the team label, got %v", args)
+		}
+	}
+
+	// the reserved labels are rejected
+	cfg.Nodes[1].ContainerLabels = map[string]string{constants.ClusterLabelKey: "other"}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected an error validating the reserved label")
+	}
+	cmder = fakeDocker(t)
+	_, err := createNodeContainers(context.Background(), status, cfg, "kind", label, &Options{})
+	if err == nil || !strings.Contains(err.Error(), "is reserved by kind") {
+		t.Errorf("expected a reserved label error, got: %v", err)
+	}
+	for _, args := range cmder.dockerRuns() {
+		if hasArgs(args, "--name", "kind-worker") {
+			t.Errorf("expected the worker not to be created, got %v", args)
+		}
+	}
+}
+
+func TestCreateNodeContainersStableOrder(t *testing.T) {
+	// the nodes complete in a random order
+	fakeContainers(t, func(desiredNode *nodeSpec) error {
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		return nil
+	})
+	cfg := &config.Config{
+		Nodes: []config.Node{
+			{Role: config.WorkerRole, Image: "myImage:latest"},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.WorkerRole, Image: "myImage:latest"},
+			{Role: config.ControlPlaneRole, Image: "myImage:latest"},
+			{Role: config.ExternalLoadBalancerRole, Image: "myImage:latest"},
+		},
+	}
+	expected := []string{
+		"kind-external-load-balancer",
+		"kind-control-plane", "kind-control-plane2",
+		"kind-worker", "kind-worker2",
+	}
+	status := logutil.NewStatus(ioutil.Discard)
+	for i := 0; i < 10; i++ {
+		result, err := createNodeContainers(context.Background(), status, cfg, "kind", "test-cluster", &Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names := []string{}
+		for _, node := range result.Ready {
+			names = append(names, node.Name())
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("expected the nodes in order %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestWaitForAPIServer(t *testing.T) {
+	polls := 0
+	check := func(endpoint string) error {
+		if endpoint != "localhost:6443" {
+			t.Errorf("unexpected endpoint %q", endpoint)
+		}
+		polls++
+		if polls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	if err := waitForAPIServer("localhost:6443", time.Second, time.Millisecond, check); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("expected the API server to be checked 3 times, got %d", polls)
+	}
+}
+
+func TestWaitForAPIServerTimeout(t *testing.T) {
+	check := func(string) error {
+		return errors.New("connection refused")
+	}
+	err := waitForAPIServer("localhost:6443", 20*time.Millisecond, time.Millisecond, check)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"localhost:6443", "20ms", "connection refused"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestPlanNodeNames(t *testing.T) {
+	two := int32(2)
+	cases := []struct {
+		TestName    string
+		Config      *config.Config
+		ExpectNames []string
+	}{
+		{
+			TestName:    "Empty config defaults to a single control plane",
+			Config:      &config.Config{},
+			ExpectNames: []string{"kind-control-plane"},
+		},
+		{
+			TestName: "Multiple roles and replicas in provisioning order",
+			Config: &config.Config{
+				Nodes: []config.Node{
+					{Role: config.WorkerRole, Replicas: &two},
+					{Role: config.ControlPlaneRole, Replicas: &two},
+					{Role: config.ExternalLoadBalancerRole},
+				},
+			},
+			ExpectNames: []string{
+				"kind-external-load-balancer",
+				"kind-control-plane",
+				"kind-control-plane2",
+				"kind-worker",
+				"kind-worker2",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			original := tc.Config.DeepCopy()
+			names, err := PlanNodeNames(tc.Config, "kind")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(names, tc.ExpectNames) {
+				t.Errorf("expected names %v, got %v", tc.ExpectNames, names)
+			}
+			if !reflect.DeepEqual(tc.Config, original) {
+				t.Errorf("expected the config not to be modified, got %+v", tc.Config)
+			}
+
+			// the plan is defaulted the same way as the names
+			t.Setenv(MaxNodesEnv, "")
+			plan, err := PlanNodes(tc.Config, "kind")
+			if err != nil {
+				t.Fatalf("unexpected error planning nodes: %v", err)
+			}
+			planned := []string{}
+			for _, node := range plan {
+				planned = append(planned, node.Name)
+				if node.Image == "" {
+					t.Errorf("expected node %s to have the default image", node.Name)
+				}
+			}
+			if !reflect.DeepEqual(planned, tc.ExpectNames) {
+				t.Errorf("expected planned nodes %v, got %v", tc.ExpectNames, planned)
+			}
+			if !reflect.DeepEqual(tc.Config, original) {
+				t.Errorf("expected the config not to be modified by PlanNodes, got %+v", tc.Config)
+			}
+		})
+	}
+}
+
+func TestValidateFixupPhases(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		Phases      []string
+		ExpectError string
+	}{
+		{
+			TestName: "Default order",
+			Phases:   DefaultFixupPhases,
+		},
+		{
+			TestName: "Reordered independent phases",
+			Phases: []string{
+				FixMountsPhase, SignalStartPhase, WaitForDockerPhase,
+				PostCreateExecPhase, LoadImagesPhase, SetProxyPhase,
+			},
+		},
+		{
+			TestName: "Unknown phase",
+			Phases: []string{
+				FixMountsPhase, SetProxyPhase, SignalStartPhase, WaitForDockerPhase,
+				LoadImagesPhase, PostCreateExecPhase, "Reboot",
+			},
+			ExpectError: "unknown fixup phase: Reboot",
+		},
+		{
+			TestName: "Duplicate phase",
+			Phases: []string{
+				FixMountsPhase, SetProxyPhase, SignalStartPhase, WaitForDockerPhase,
+				LoadImagesPhase, PostCreateExecPhase, SetProxyPhase,
+			},
+			ExpectError: "fixup phase SetProxy is specified more than once",
+		},
+		{
+			TestName: "Missing phase",
+			Phases: []string{
+				FixMountsPhase, SignalStartPhase, WaitForDockerPhase,
+				LoadImagesPhase, PostCreateExecPhase,
+			},
+			ExpectError: "fixup phase SetProxy is missing",
+		},
+		{
+			TestName: "SignalStart before FixMounts",
+			Phases: []string{
+				SetProxyPhase, SignalStartPhase, FixMountsPhase, WaitForDockerPhase,
+				LoadImagesPhase, PostCreateExecPhase,
+			},
+			ExpectError: "fixup phase FixMounts must run before fixup phase SignalStart",
+		},
+		{
+			TestName: "WaitForDocker before SignalStart",
+			Phases: []string{
+				FixMountsPhase, SetProxyPhase, WaitForDockerPhase, SignalStartPhase,
+				LoadImagesPhase, PostCreateExecPhase,
+			},
+			ExpectError: "fixup phase SignalStart must run before fixup phase WaitForDocker",
+		},
+		{
+			TestName: "LoadImages before WaitForDocker",
+			Phases: []string{
+				FixMountsPhase, SetProxyPhase, SignalStartPhase, LoadImagesPhase,
+				WaitForDockerPhase, PostCreateExecPhase,
+			},
+			ExpectError: "fixup phase WaitForDocker must run before fixup phase LoadImages",
+		},
+		{
+			TestName: "PostCreateExec before WaitForDocker",
+			Phases: []string{
+				FixMountsPhase, SetProxyPhase, SignalStartPhase, PostCreateExecPhase,
+				WaitForDockerPhase, LoadImagesPhase,
+			},
+			ExpectError: "fixup phase WaitForDocker must run before fixup phase PostCreateExec",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			err := validateFixupPhases(tc.Phases)
+			if tc.ExpectError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.ExpectError {
+				t.Errorf("expected error %q, got: %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
+
+func TestClusterDryRunFailureUsesNoDocker(t *testing.T) {
+	cmder := fakeDocker(t)
+	opts := &Options{
+		DryRun:            true,
+		MaxNodes:          1,
+		DockerAPIVersion:  "1.39",
+		EstimateDownloads: true,
+	}
+	err := Cluster(clustercontext.NewContext("kind"), newTestConfig(2), opts)
+	if err == nil {
+		t.Fatal("expected the dry run to fail with more nodes than allowed")
+	}
+	// in particular no existing cluster with the same name is deleted
+	if len(cmder.commands) != 0 {
+		t.Errorf("expected no docker commands in a dry run, got %v", cmder.commands)
+	}
+}
+
+func TestInjectFailuresRequiresOptIn(t *testing.T) {
+	failures := map[string]string{"kind-worker": CreatePhase}
+	opts := &Options{InjectFailures: failures}
+
+	t.Setenv(InjectFailuresEnv, "")
+	if err := validateInjectFailures(failures); err == nil {
+		t.Errorf("expected an error injecting failures without %s", InjectFailuresEnv)
+	}
+	if err := opts.injectedFailure("kind-worker", CreatePhase); err != nil {
+		t.Errorf("expected no failure to be injected without %s, got: %v", InjectFailuresEnv, err)
+	}
+
+	t.Setenv(InjectFailuresEnv, "true")
+	if err := validateInjectFailures(failures); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := opts.injectedFailure("kind-worker", CreatePhase); err == nil {
+		t.Error("expected the injected failure")
+	}
+	if err := validateInjectFailures(map[string]string{"kind-worker": "Unknown"}); err == nil {
+		t.Error("expected an error for an unknown phase")
+	}
+}
+
+func TestPlanFileRoundTrip(t *testing.T) {
+	stopTimeout := 30 * time.Second
+	plan := []PlannedNode{
+		{
+			Name:        "kind-control-plane",
+			Role:        constants.ControlPlaneNodeRoleValue,
+			Image:       "myImage:latest",
+			ExtraMounts: []cri.Mount{{HostPath: "/host", ContainerPath: "/node", Readonly: true}},
+			StopTimeout: &stopTimeout,
+			ProxyEnv:    map[string]string{},
+			Labels:      map[string]string{"tier": "control"},
+		},
+		{
+			Name:              "kind-worker",
+			Role:              constants.WorkerNodeRoleValue,
+			Image:             "myImage:latest",
+			ExtraPortMappings: []cri.PortMapping{{ContainerPort: 80, HostPort: 8080}},
+			PostCreateExec:    [][]string{{"true"}},
+		},
+	}
+	path := t.TempDir() + "/plan.json"
+	if err := WritePlanFile(path, plan); err != nil {
+		t.Fatalf("unexpected error writing the plan: %v", err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"kind": "NodePlan"`, `"apiVersion": "kind.sigs.k8s.io/v1alpha1"`, `"extraMounts"`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected the plan file to contain %s, got:\n%s", want, content)
+		}
+	}
+	read, err := ReadPlanFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading the plan: %v", err)
+	}
+	if !reflect.DeepEqual(read, plan) {
+		t.Errorf("expected the plan to round trip\nwrote: %+v\nread:  %+v", plan, read)
+	}
+
+	adopted := []PlannedNode{{Name: "kind-worker", Role: constants.WorkerNodeRoleValue, Image: "myImage:latest", Adopted: true}}
+	if err := WritePlanFile(t.TempDir()+"/plan.json", adopted); err == nil {
+		t.Error("expected an error writing a plan with an adopted node")
+	}
+}
+
+func TestReadPlanFileInvalid(t *testing.T) {
+	const header = `"kind": "NodePlan", "apiVersion": "kind.sigs.k8s.io/v1alpha1"`
+	cases := []struct {
+		TestName    string
+		Content     string
+		ExpectError string
+	}{
+		{
+			TestName:    "Not JSON",
+			Content:     `nodes:`,
+			ExpectError: "failed to decode node plan",
+		},
+		{
+			TestName:    "Missing header",
+			Content:     `{"nodes": [{"name": "kind-control-plane", "role": "control-plane", "image": "myImage:latest"}]}`,
+			ExpectError: `has kind "" and apiVersion ""`,
+		},
+		{
+			TestName:    "Unknown version",
+			Content:     `{"kind": "NodePlan", "apiVersion": "kind.sigs.k8s.io/v2", "nodes": [{"name": "kind-control-plane", "role": "control-plane", "image": "myImage:latest"}]}`,
+			ExpectError: `apiVersion "kind.sigs.k8s.io/v2"`,
+		},
+		{
+			TestName:    "Bare node list",
+			Content:     `[{"name": "kind-control-plane", "role": "control-plane", "image": "myImage:latest"}]`,
+			ExpectError: "failed to decode node plan",
+		},
+		{
+			TestName:    "Adopted node",
+			Content:     `{` + header + `, "nodes": [{"name": "kind-control-plane", "role": "control-plane", "image": "myImage:latest", "adopted": true}]}`,
+			ExpectError: `unknown field "adopted"`,
+		},
+		{
+			TestName:    "Unknown field",
+			Content:     `{` + header + `, "nodes": [{"name": "kind-control-plane", "role": "control-plane", "image": "myImage:latest", "replicas": 2}]}`,
+			ExpectError: `unknown field "replicas"`,
+		},
+		{
+			TestName:    "No nodes",
+			Content:     `{` + header + `, "nodes": []}`,
+			ExpectError: "the plan has no nodes",
+		},
+		{
+			TestName:    "Unknown role",
+			Content:     `{` + header + `, "nodes": [{"name": "kind-master", "role": "master", "image": "myImage:latest"}]}`,
+			ExpectError: `node kind-master has unknown role: "master"`,
+		},
+		{
+			TestName:    "No image",
+			Content:     `{` + header + `, "nodes": [{"name": "kind-control-plane", "role": "control-plane"}]}`,
+			ExpectError: "node kind-control-plane has no image",
+		},
+		{
+			TestName:    "Duplicate names",
+			Content:     `{` + header + `, "nodes": [{"name": "kind-worker", "role": "worker", "image": "myImage:latest"}, {"name": "kind-worker", "role": "worker", "image": "myImage:latest"}]}`,
+			ExpectError: "node name kind-worker is planned more than once",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			path := t.TempDir() + "/plan.json"
+			if err := ioutil.WriteFile(path, []byte(tc.Content), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err := ReadPlanFile(path)
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectError) {
+				t.Errorf("expected an error containing %q, got: %v", tc.ExpectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CreatePhase is the node container creation phase, which precedes fixup
+const CreatePhase = "Create"
+
+/* node fixup phases, see fixupNode */
+const (
+	// FixMountsPhase corrects the node container mounts, see nodes.FixMounts
+	FixMountsPhase = "FixMounts"
+	// SetProxyPhase configures the node's docker to use the host proxy
+	SetProxyPhase = "SetProxy"
+	// SignalStartPhase signals the node entrypoint to boot into systemd
+	SignalStartPhase = "SignalStart"
+	// WaitForDockerPhase waits for docker to be ready in the node, or
+	// containerd for containerd nodes
+	WaitForDockerPhase = "WaitForDocker"
+	// LoadImagesPhase loads the image tarballs on the node into docker, or
+	// containerd for containerd nodes
+	LoadImagesPhase = "LoadImages"
+	// PostCreateExecPhase runs the node's PostCreateExec commands in order
+	PostCreateExecPhase = "PostCreateExec"
+)
+
+// DefaultFixupPhases is the default order in which the fixup phases run
+var DefaultFixupPhases = []string{
+	FixMountsPhase,
+	SetProxyPhase,
+	SignalStartPhase,
+	WaitForDockerPhase,
+	LoadImagesPhase,
+	PostCreateExecPhase,
+}
+
+// bootPhases are the fixup phases that depend on the node booting with the
+// default entrypoint, these are skipped for nodes overriding the entrypoint
+var bootPhases = []string{
+	SignalStartPhase,
+	WaitForDockerPhase,
+	LoadImagesPhase,
+	PostCreateExecPhase,
+}
+
+// fixupPhaseDependencies maps fixup phases to the phases that must run
+// before them regardless of the configured order
+var fixupPhaseDependencies = map[string][]string{
+	// systemd should boot with the fixed up mounts
+	SignalStartPhase: {FixMountsPhase},
+	// docker only starts once the node boots into systemd
+	WaitForDockerPhase: {SignalStartPhase},
+	// images are loaded with the node's docker
+	LoadImagesPhase: {WaitForDockerPhase},
+	// the commands run in the booted node
+	PostCreateExecPhase: {WaitForDockerPhase},
+}
+
+// fixupPhases returns the configured fixup phase order or the default
+func (o *Options) fixupPhases() []string {
+	if len(o.FixupPhases) == 0 {
+		return DefaultFixupPhases
+	}
+	return o.FixupPhases
+}
+
+// validateFixupPhases checks that phases contains each known fixup phase
+// exactly once, and that the phase dependencies are respected
+func validateFixupPhases(phases []string) error {
+	position := make(map[string]int, len(phases))
+	for i, phase := range phases {
+		if !isFixupPhase(phase) {
+			return errors.Errorf("unknown fixup phase: %s", phase)
+		}
+		if _, seen := position[phase]; seen {
+			return errors.Errorf("fixup phase %s is specified more than once", phase)
+		}
+		position[phase] = i
+	}
+	for _, phase := range DefaultFixupPhases {
+		if _, ok := position[phase]; !ok {
+			return errors.Errorf("fixup phase %s is missing", phase)
+		}
+	}
+	// in the default order, for a stable error
+	for _, phase := range DefaultFixupPhases {
+		for _, dependency := range fixupPhaseDependencies[phase] {
+			if position[dependency] > position[phase] {
+				return errors.Errorf(
+					"fixup phase %s must run before fixup phase %s",
+					dependency, phase,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// withoutPhases returns phases without any of the phases in skip
+func withoutPhases(phases, skip []string) []string {
+	out := []string{}
+	for _, phase := range phases {
+		skipped := false
+		for _, s := range skip {
+			if s == phase {
+				skipped = true
+			}
+		}
+		if !skipped {
+			out = append(out, phase)
+		}
+	}
+	return out
+}
+
+func isFixupPhase(phase string) bool {
+	for _, p := range DefaultFixupPhases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// InjectFailuresEnv must be set to "true" on the host for failures to be
+// injected with Options.InjectFailures, so that they are never injected by
+// accident outside of testing
+const InjectFailuresEnv = "KIND_INJECT_FAILURES"
+
+// injectFailuresEnabled returns true if InjectFailuresEnv opts in to
+// injecting failures
+func injectFailuresEnabled() bool {
+	return os.Getenv(InjectFailuresEnv) == "true"
+}
+
+// validateInjectFailures checks that failures only names known phases, and
+// that injecting them was enabled with InjectFailuresEnv
+func validateInjectFailures(failures map[string]string) error {
+	if len(failures) > 0 && !injectFailuresEnabled() {
+		return errors.Errorf("injecting failures requires %s=true", InjectFailuresEnv)
+	}
+	for node, phase := range failures {
+		if phase != CreatePhase && !isFixupPhase(phase) {
+			return errors.Errorf("cannot inject failure for node %s at unknown phase: %s", node, phase)
+		}
+	}
+	return nil
+}
+
+// startPhase notifies OnNodePhase, if set, that node is entering phase
+func (o *Options) startPhase(node, phase string) {
+	if o.OnNodePhase != nil {
+		o.OnNodePhase(node, phase)
+	}
+}
+
+// injectedFailure returns an error if a failure was injected for the node
+// at phase, failures at CreatePhase happen after the container is created.
+// Nothing is injected unless InjectFailuresEnv enables it.
+func (o *Options) injectedFailure(node, phase string) error {
+	if !injectFailuresEnabled() {
+		return nil
+	}
+	if failurePhase, ok := o.InjectFailures[node]; ok && failurePhase == phase {
+		return errors.Errorf("injected failure for node %s at phase %s", node, phase)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/kind/pkg/cluster/config"
+)
+
+// PlannedNode is a node container to be provisioned, as planned from the
+// config by PlanNodes
+type PlannedNode nodeSpec
+
+// PlanNodes returns the node containers that would be provisioned for cfg,
+// within the host node budget. cfg is not modified.
+func PlanNodes(cfg *config.Config, clusterName string) ([]PlannedNode, error) {
+	maxNodes, err := nodeBudget(0)
+	if err != nil {
+		return nil, err
+	}
+	desiredNodes, err := planDesiredNodes(cfg, clusterName, maxNodes)
+	if err != nil {
+		return nil, err
+	}
+	plan := []PlannedNode{}
+	for _, desiredNode := range desiredNodes {
+		plan = append(plan, PlannedNode(desiredNode))
+	}
+	return plan, nil
+}
+
+// PlanNodeNames returns the names of the node containers that would be
+// provisioned for cfg, in provisioning order, so that they are known before
+// the cluster exists. Unlike PlanNodes cfg is not defaulted in place and the
+// host node budget is not applied.
+func PlanNodeNames(cfg *config.Config, clusterName string) ([]string, error) {
+	desiredNodes, err := planDesiredNodes(cfg, clusterName, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(desiredNodes))
+	for _, desiredNode := range desiredNodes {
+		names = append(names, desiredNode.Name)
+	}
+	return names, nil
+}
+
+/* the header of plan files, see planFile */
+const (
+	// PlanFileKind is the kind of plan files
+	PlanFileKind = "NodePlan"
+	// PlanFileAPIVersion is the version of plan files, which changes with
+	// incompatible changes to their format
+	PlanFileAPIVersion = "kind.sigs.k8s.io/v1alpha1"
+)
+
+// planFile is the content of a plan file
+type planFile struct {
+	Kind       string        `json:"kind"`
+	APIVersion string        `json:"apiVersion"`
+	Nodes      []PlannedNode `json:"nodes"`
+}
+
+// planDesiredNodes returns the nodes to provision for a defaulted copy of
+// cfg, or an error if there are more than maxNodes, see nodesToCreate
+func planDesiredNodes(cfg *config.Config, clusterName string, maxNodes int) ([]nodeSpec, error) {
+	cfg = cfg.DeepCopy()
+	// the defaulters of the internal config are not registered to
+	// encoding.Scheme, which only defaults the versioned configs
+	config.SetObjectDefaults_Config(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	desiredNodes, err := nodesToCreate(cfg, clusterName, DefaultRoleOrder(), nil, false, maxNodes)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateNodeNames(desiredNodes); err != nil {
+		return nil, err
+	}
+	return desiredNodes, nil
+}
+
+// WritePlanFile validates plan and writes it to path as JSON, see
+// ReadPlanFile
+func WritePlanFile(path string, plan []PlannedNode) error {
+	if err := validatePlan(plan); err != nil {
+		return errors.Wrap(err, "invalid node plan")
+	}
+	content, err := json.MarshalIndent(planFile{
+		Kind:       PlanFileKind,
+		APIVersion: PlanFileAPIVersion,
+		Nodes:      plan,
+	}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode node plan")
+	}
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return errors.Wrap(err, "failed to write node plan")
+	}
+	return nil
+}
+
+// ReadPlanFile reads and validates a plan written by WritePlanFile, unknown
+// fields are rejected
+func ReadPlanFile(path string) ([]PlannedNode, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read node plan")
+	}
+	file := planFile{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode node plan %s", path)
+	}
+	if file.Kind != PlanFileKind || file.APIVersion != PlanFileAPIVersion {
+		return nil, errors.Errorf(
+			"node plan %s has kind %q and apiVersion %q, expected %q and %q",
+			path, file.Kind, file.APIVersion, PlanFileKind, PlanFileAPIVersion,
+		)
+	}
+	if err := validatePlan(file.Nodes); err != nil {
+		return nil, errors.Wrapf(err, "invalid node plan %s", path)
+	}
+	return file.Nodes, nil
+}
+
+// validatePlan checks that every planned node has a known role, an image,
+// and a unique name, and that no node is adopted
+func validatePlan(plan []PlannedNode) error {
+	if len(plan) == 0 {
+		return errors.New("the plan has no nodes")
+	}
+	names := sets.NewString()
+	for i, node := range plan {
+		if node.Name == "" {
+			return errors.Errorf("node %d has no name", i)
+		}
+		if names.Has(node.Name) {
+			return errors.Errorf("node name %s is planned more than once", node.Name)
+		}
+		names.Insert(node.Name)
+		if !knownRoles.Has(node.Role) {
+			return errors.Errorf("node %s has unknown role: %q", node.Name, node.Role)
+		}
+		if node.Image == "" {
+			return errors.Errorf("node %s has no image", node.Name)
+		}
+		if node.Adopted {
+			return errors.Errorf("node %s is adopted, adopted nodes cannot be planned", node.Name)
+		}
+	}
+	return nil
+}
+
+// printPlan prints the nodes to be provisioned as a table, in the order they
+// are provisioned, see Options.DryRun
+func printPlan(w io.Writer, desiredNodes []nodeSpec) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tROLE\tIMAGE\tMOUNTS")
+	for _, desiredNode := range desiredNodes {
+		mounts := []string{}
+		for _, mount := range desiredNode.ExtraMounts {
+			m := mount.HostPath + ":" + mount.ContainerPath
+			if mount.Readonly {
+				m += ":ro"
+			}
+			mounts = append(mounts, m)
+		}
+		if len(mounts) == 0 {
+			mounts = append(mounts, "<none>")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			desiredNode.Name, desiredNode.Role, desiredNode.Image, strings.Join(mounts, ","),
+		)
+	}
+	return tw.Flush()
+}
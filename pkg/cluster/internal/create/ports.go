@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/container/cri"
+)
+
+// validateLoadBalancerPort checks that port is a valid host port, zero
+// picks a random free port
+func validateLoadBalancerPort(port int) error {
+	if port < 0 || port > 65535 {
+		return errors.Errorf("invalid load balancer port %d, must be between 0 (random) and 65535", port)
+	}
+	return nil
+}
+
+// checkLoadBalancerPort checks that a load balancer port is only set when
+// there is an external load balancer node to publish it, as the load
+// balancer of a single control plane node is dropped unless it is kept
+func checkLoadBalancerPort(desiredNodes []nodeSpec, port int) error {
+	if port == 0 {
+		return nil
+	}
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Role == constants.ExternalLoadBalancerNodeRoleValue {
+			return nil
+		}
+	}
+	return errors.Errorf(
+		"load balancer port %d is set, but there is no external load balancer node, keep the load balancer to use it",
+		port,
+	)
+}
+
+// checkAPIServerHostPorts checks that the configured API server host ports
+// are not published by other nodes and are free on the host, so that the
+// conflict is reported before creating any container
+func checkAPIServerHostPorts(desiredNodes []nodeSpec) error {
+	for _, desiredNode := range desiredNodes {
+		port := desiredNode.APIServerHostPort
+		if port == 0 {
+			continue
+		}
+		for _, other := range desiredNodes {
+			for _, pm := range other.ExtraPortMappings {
+				if int(pm.HostPort) == port && pm.Protocol == cri.PortMappingProtocolTCP {
+					return errors.Errorf(
+						"host port %d of node %s is also published by node %s",
+						port, desiredNode.Name, other.Name,
+					)
+				}
+			}
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			return errors.Wrapf(err, "host port %d of node %s is not available", port, desiredNode.Name)
+		}
+		listener.Close()
+	}
+	return nil
+}
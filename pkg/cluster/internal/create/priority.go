@@ -0,0 +1,176 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/config"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+)
+
+// defaultCreationPriorities are the creation priorities of the node roles,
+// for nodes that do not set config.Node.CreationPriority. When more nodes are
+// waiting to be created than MaxConcurrency allows, the nodes with the higher
+// priority are created first:
+//
+//	external-load-balancer: 300
+//	external-etcd:          200
+//	control-plane:          100
+//	worker:                 0
+var defaultCreationPriorities = map[string]int32{
+	constants.ExternalLoadBalancerNodeRoleValue: 300,
+	constants.ExternalEtcdNodeRoleValue:         200,
+	constants.ControlPlaneNodeRoleValue:         100,
+	constants.WorkerNodeRoleValue:               0,
+}
+
+// creationPriority returns the creation priority of configNode with role,
+// its own if set or the default of its role
+func creationPriority(configNode *config.Node, role string) int32 {
+	if configNode.CreationPriority != nil {
+		return *configNode.CreationPriority
+	}
+	return defaultCreationPriorities[role]
+}
+
+// createSlots is a semaphore limiting how many node containers are created
+// at once, see Options.MaxConcurrency. The free slots go to the waiting node
+// with the highest creation priority, and within a priority to the node
+// planned first.
+type createSlots struct {
+	mu   sync.Mutex
+	free int
+	// rank is the priority and provisioning order of each expected node
+	rank map[string]slotRank
+	// waiting are the nodes expected to acquire a slot, see expect
+	waiting map[string]bool
+	// changed is closed and replaced whenever a slot may be acquired
+	changed chan struct{}
+}
+
+type slotRank struct {
+	priority int32
+	order    int
+}
+
+// before returns true if a acquires a slot before b
+func (a slotRank) before(b slotRank) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.order < b.order
+}
+
+func newCreateSlots(size int) *createSlots {
+	return &createSlots{
+		free:    size,
+		rank:    map[string]slotRank{},
+		waiting: map[string]bool{},
+		changed: make(chan struct{}),
+	}
+}
+
+// expect registers the nodes that are about to acquire a slot, in
+// provisioning order, so that no lower priority node takes a slot before
+// them. Adopted nodes are not created and do not acquire slots.
+func (s *createSlots) expect(desiredNodes []nodeSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Adopted {
+			continue
+		}
+		s.rank[desiredNode.Name] = slotRank{
+			priority: desiredNode.CreationPriority,
+			order:    len(s.rank),
+		}
+		s.waiting[desiredNode.Name] = true
+	}
+	s.notify()
+}
+
+// acquire waits for a slot for the node called name, once it is the first
+// waiting node with a free slot. Nodes acquiring a slot again, e.g. to retry,
+// wait with their original rank.
+func (s *createSlots) acquire(ctx context.Context, abandoned <-chan struct{}, name string) error {
+	s.mu.Lock()
+	if _, ok := s.rank[name]; !ok {
+		s.rank[name] = slotRank{order: len(s.rank)}
+	}
+	s.waiting[name] = true
+	for {
+		if s.free > 0 && s.next() == name {
+			s.free--
+			delete(s.waiting, name)
+			s.notify()
+			s.mu.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-abandoned:
+			s.forget(name)
+			return errors.Errorf("node %s was abandoned", name)
+		case <-ctx.Done():
+			s.forget(name)
+			return ctx.Err()
+		}
+		s.mu.Lock()
+	}
+}
+
+// release returns a slot acquired with acquire
+func (s *createSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.free++
+	s.notify()
+}
+
+// forget stops waiting for the node called name to acquire a slot, e.g.
+// because it failed before creating its container
+func (s *createSlots) forget(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.waiting[name] {
+		delete(s.waiting, name)
+		s.notify()
+	}
+}
+
+// next returns the waiting node that acquires the next free slot
+func (s *createSlots) next() string {
+	next := ""
+	for name := range s.waiting {
+		if next == "" || s.rank[name].before(s.rank[next]) {
+			next = name
+		}
+	}
+	return next
+}
+
+// notify wakes up the nodes waiting in acquire, s.mu must be held
+func (s *createSlots) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+)
+
+// quorumSize returns the number of nodes that must be ready for provisioning
+// to succeed given the configured minReadyNodes, where zero means all nodes,
+// and maxWorkerFailures, the stricter of the two applies if both are set.
+// Nodes other than workers are always required.
+func quorumSize(desiredNodes []nodeSpec, minReadyNodes, maxWorkerFailures int) (int, error) {
+	if minReadyNodes < 0 {
+		return 0, errors.Errorf("minimum ready nodes must not be negative, got %d", minReadyNodes)
+	}
+	if maxWorkerFailures < 0 {
+		return 0, errors.Errorf("maximum worker failures must not be negative, got %d", maxWorkerFailures)
+	}
+	if minReadyNodes > len(desiredNodes) {
+		return 0, errors.Errorf(
+			"minimum ready nodes %d exceeds the number of nodes %d",
+			minReadyNodes, len(desiredNodes),
+		)
+	}
+	if minReadyNodes == 0 && maxWorkerFailures == 0 {
+		return len(desiredNodes), nil
+	}
+	required := 0
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Role != constants.WorkerNodeRoleValue {
+			required++
+		}
+	}
+	quorum := required
+	if minReadyNodes > quorum {
+		quorum = minReadyNodes
+	}
+	if maxWorkerFailures > 0 && len(desiredNodes)-maxWorkerFailures > quorum {
+		quorum = len(desiredNodes) - maxWorkerFailures
+	}
+	return quorum, nil
+}
+
+// quorumMet returns true if minReady nodes are ready, including every
+// node other than the workers
+func quorumMet(desiredNodes []nodeSpec, ready []nodes.Node, minReady int) bool {
+	if len(ready) < minReady {
+		return false
+	}
+	readyNames := make(map[string]bool, len(ready))
+	for _, node := range ready {
+		readyNames[node.Name()] = true
+	}
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Role != constants.WorkerNodeRoleValue && !readyNames[desiredNode.Name] {
+			return false
+		}
+	}
+	return true
+}
+
+// abandonStragglers stops waiting on the nodes named by stragglers and
+// removes them, including those which finish provisioning later on
+func abandonStragglers(results <-chan nodeResult, abandoned chan<- struct{}, stragglers []string, adopted sets.String) {
+	close(abandoned)
+	removeStragglers(results, stragglers, adopted)
+}
+
+// removeStragglers deletes the containers of the nodes named by stragglers
+// that are still being provisioned, after provisioning was abandoned. The
+// adopted nodes existed before provisioning and are kept.
+func removeStragglers(results <-chan nodeResult, stragglers []string, adopted sets.String) {
+	// the containers may not exist yet, in which case they are removed
+	// once created, see provisionNode
+	for _, name := range stragglers {
+		if !adopted.Has(name) {
+			removeNodes(*nodes.FromName(name))
+		}
+	}
+	go func() {
+		for range stragglers {
+			if r := <-results; r.node != nil && !r.spec.Adopted {
+				removeNodes(*r.node)
+			}
+		}
+	}()
+}
+
+// cleanupFailedProvision stops provisioning, waits for the nodes named by
+// pending to settle and deletes every node container created so far,
+// including failed, so that a failed provision leaves no containers behind.
+// Adopted nodes existed before provisioning and are kept, as is everything
+// if retain is set.
+func cleanupFailedProvision(
+	result *provisionResult, results <-chan nodeResult, abandoned chan<- struct{},
+	pending sets.String, failed []nodes.Node, retain bool,
+) {
+	// nodes still waiting to be created give up, see provisionNode
+	close(abandoned)
+	created := append([]nodes.Node{}, result.Ready...)
+	created = append(created, failed...)
+	for pending.Len() > 0 {
+		r := <-results
+		pending.Delete(r.spec.Name)
+		if r.node != nil {
+			created = append(created, *r.node)
+		}
+	}
+	if retain {
+		return
+	}
+	adopted := adoptedNodeNames(result.Planned)
+	toDelete := []nodes.Node{}
+	for _, node := range created {
+		if !adopted.Has(node.Name()) {
+			toDelete = append(toDelete, node)
+		}
+	}
+	if len(toDelete) > 0 {
+		log.Infof("Deleting %d node containers created before provisioning failed", len(toDelete))
+	}
+	removeNodes(toDelete...)
+	result.Ready = nil
+}
+
+// adoptedNodeNames returns the names of the adopted desired nodes
+func adoptedNodeNames(desiredNodes []nodeSpec) sets.String {
+	adopted := sets.NewString()
+	for _, desiredNode := range desiredNodes {
+		if desiredNode.Adopted {
+			adopted.Insert(desiredNode.Name)
+		}
+	}
+	return adopted
+}
+
+// removeNodes deletes nodes that will not be part of the cluster, logging
+// rather than returning errors as this is only best effort
+func removeNodes(n ...nodes.Node) {
+	if err := nodes.Delete(n...); err != nil {
+		log.Debugf("Failed to remove nodes: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+/* provisioning result statuses, see Options.ResultsFile */
+const (
+	// ProvisioningSucceeded is the results file status when all of the
+	// required nodes were provisioned
+	ProvisioningSucceeded = "Succeeded"
+	// ProvisioningFailed is the results file status when provisioning failed
+	ProvisioningFailed = "Failed"
+)
+
+// provisionResults is the content of the results file
+type provisionResults struct {
+	Status  string            `json:"status"`
+	Error   string            `json:"error,omitempty"`
+	Cluster string            `json:"cluster"`
+	Nodes   []provisionedNode `json:"nodes"`
+	Skipped []string          `json:"skipped,omitempty"`
+}
+
+// provisionedNode describes a node that was provisioned successfully
+type provisionedNode struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Image string `json:"image"`
+}
+
+// writeResultsFile writes the result of createNodeContainers and its error
+// to path as JSON, writing to a temporary file first so that the results
+// are never partially written
+func writeResultsFile(path, clusterName string, result *provisionResult, provisionErr error) error {
+	results := provisionResults{
+		Status:  ProvisioningSucceeded,
+		Cluster: clusterName,
+		Nodes:   []provisionedNode{},
+	}
+	if provisionErr != nil {
+		results.Status = ProvisioningFailed
+		results.Error = provisionErr.Error()
+	}
+	if result != nil {
+		planned := make(map[string]nodeSpec, len(result.Planned))
+		for _, desiredNode := range result.Planned {
+			planned[desiredNode.Name] = desiredNode
+		}
+		for _, node := range result.Ready {
+			desiredNode := planned[node.Name()]
+			results.Nodes = append(results.Nodes, provisionedNode{
+				Name:  node.Name(),
+				Role:  desiredNode.Role,
+				Image: desiredNode.Image,
+			})
+		}
+		results.Skipped = result.Skipped
+	}
+
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode results")
+	}
+	return writeFileAtomic(path, content)
+}
+
+// writeFileAtomic writes content to a temporary file next to path and then
+// renames it to path, so that path is never partially written
+func writeFileAtomic(path string, content []byte) error {
+	// the temporary file must be on the same filesystem to rename it
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file for %s", path)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to write temporary file for %s", path)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write temporary file for %s", path)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errors.Wrapf(err, "failed to move %s into place", path)
+	}
+	return nil
+}
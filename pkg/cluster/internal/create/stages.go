@@ -0,0 +1,61 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// ProvisionedRoleEnv is set for the BetweenRolesCommand to the role of the
+// nodes that were just provisioned
+const ProvisionedRoleEnv = "KIND_PROVISIONED_ROLE"
+
+// provisioningStages splits the sorted desiredNodes into stages that are
+// provisioned one after another. If there is no command to run between roles
+// all nodes are provisioned at once, otherwise there is one stage per role.
+func provisioningStages(desiredNodes []nodeSpec, betweenRolesCommand []string) [][]nodeSpec {
+	if len(betweenRolesCommand) == 0 || len(desiredNodes) == 0 {
+		return [][]nodeSpec{desiredNodes}
+	}
+	stages := [][]nodeSpec{{desiredNodes[0]}}
+	for _, desiredNode := range desiredNodes[1:] {
+		last := len(stages) - 1
+		if stages[last][0].Role == desiredNode.Role {
+			stages[last] = append(stages[last], desiredNode)
+		} else {
+			stages = append(stages, []nodeSpec{desiredNode})
+		}
+	}
+	return stages
+}
+
+// runBetweenRolesCommand runs command on the host after the nodes of role
+// have been provisioned, returning an error if it fails
+func runBetweenRolesCommand(command []string, role string) error {
+	log.Infof("Running %v after provisioning %s nodes", command, role)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.SetEnv(append(os.Environ(), ProvisionedRoleEnv+"="+role)...)
+	if err := exec.RunLoggingOutputOnFail(cmd); err != nil {
+		return errors.Wrapf(err, "command %v failed after provisioning %s nodes", command, role)
+	}
+	return nil
+}
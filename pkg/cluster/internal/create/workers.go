@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package create
+
+import (
+	stdcontext "context"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/cluster/config"
+	"sigs.k8s.io/kind/pkg/cluster/config/defaults"
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/cluster/internal/context"
+	"sigs.k8s.io/kind/pkg/cluster/internal/kubeadm"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/exec"
+	logutil "sigs.k8s.io/kind/pkg/log"
+)
+
+// Workers creates count additional worker node containers from image
+// (defaults.Image if empty) in the existing cluster, numbered after the
+// existing nodes. The existing nodes are left untouched, and the new nodes
+// are not joined to the cluster. opts is validated like for Cluster, and is
+// not modified.
+func Workers(ctx *context.Context, image string, count int, opts *Options) ([]nodes.Node, error) {
+	// the options are filled in while provisioning, the caller's are kept
+	// as they are so that they may be reused
+	workerOpts := *opts
+	opts = &workerOpts
+	if err := validateOptions(opts); err != nil {
+		return nil, err
+	}
+	if image == "" {
+		image = defaults.Image
+	}
+	if err := prepareHost(opts); err != nil {
+		return nil, err
+	}
+	status := logutil.NewStatus(os.Stdout)
+	status.MaybeWrapLogrus(log.StandardLogger())
+	provisionCtx := opts.Context
+	if provisionCtx == nil {
+		provisionCtx = stdcontext.Background()
+	}
+	return addWorkerNodes(provisionCtx, status, ctx.Name(), ctx.ClusterLabel(), image, count, opts)
+}
+
+// addWorkerNodes creates count worker node containers named after the
+// existing nodes of the cluster, see makeNodeNamer
+func addWorkerNodes(
+	ctx stdcontext.Context, status *logutil.Status, clusterName string, clusterLabel nodes.ClusterLabel, image string, count int, opts *Options,
+) ([]nodes.Node, error) {
+	if count < 1 {
+		return nil, errors.Errorf("worker count must be positive, got %d", count)
+	}
+	existing, err := listClusterNodes(clusterLabel)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the existing nodes")
+	}
+	if len(existing) == 0 {
+		return nil, errors.Errorf("cluster %s has no nodes to add workers to", clusterName)
+	}
+	existingNames := make([]string, 0, len(existing))
+	for _, node := range existing {
+		existingNames = append(existingNames, node.Name())
+	}
+	nameNode := makeNodeNamer(opts.namePrefix(clusterName), existingNames...)
+	// the new workers join with the token the cluster was created with
+	if opts.PreplaceJoinToken {
+		token, err := clusterJoinToken(existing)
+		if err != nil {
+			return nil, err
+		}
+		opts.joinToken = token
+	}
+	// the new workers are provisioned as planned, so that only their
+	// containers are created
+	opts.plan = nil
+	for i := 0; i < count; i++ {
+		opts.plan = append(opts.plan, PlannedNode{
+			Name:  nameNode(constants.WorkerNodeRoleValue),
+			Role:  constants.WorkerNodeRoleValue,
+			Image: image,
+		})
+	}
+	generation, err := newGeneration()
+	if err != nil {
+		return nil, err
+	}
+	opts.generation = generation
+	// the workers join the network of the existing nodes, if any
+	network, _, err := ensureNodeNetwork(opts, clusterName, opts.networkLabels(clusterLabel)...)
+	if err != nil {
+		return nil, err
+	}
+	opts.network = network
+	result, err := createNodeContainers(ctx, status, &config.Config{}, clusterName, clusterLabel, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Ready, nil
+}
+
+// clusterNodes returns the existing nodes of the cluster with clusterLabel
+func clusterNodes(clusterLabel nodes.ClusterLabel) ([]nodes.Node, error) {
+	return nodes.List(clusterLabel.Filter())
+}
+
+// clusterJoinToken returns the bootstrap token the cluster of the existing
+// nodes was created with, from the kubeadm config of its bootstrap control
+// plane node, see PreplaceJoinToken
+func clusterJoinToken(existing []nodes.Node) (string, error) {
+	node, err := nodes.BootstrapControlPlaneNode(existing)
+	if err != nil {
+		return "", err
+	}
+	lines, err := exec.CombinedOutputLines(node.Command("cat", kubeadm.ConfigPath))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the kubeadm config of the cluster")
+	}
+	for _, line := range lines {
+		if token := strings.TrimPrefix(strings.TrimSpace(line), "- token:"); token != strings.TrimSpace(line) {
+			return strings.Trim(strings.TrimSpace(token), `"`), nil
+		}
+	}
+	return "", errors.Errorf("no join token in the kubeadm config of node %s", node.Name())
+}
@@ -26,14 +26,32 @@ import (
 
 	"sigs.k8s.io/kind/pkg/cluster/internal/context"
 	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/docker"
 )
 
 // Cluster deletes the cluster identified by ctx
 func Cluster(c *context.Context) error {
-	n, err := c.ListNodes()
+	return ClusterKeeping(c)
+}
+
+// ClusterKeeping deletes the cluster identified by ctx like Cluster, except
+// for the node containers named by keep, such as adopted nodes which existed
+// before the cluster was created
+func ClusterKeeping(c *context.Context, keep ...string) error {
+	all, err := c.ListNodes()
 	if err != nil {
 		return errors.Wrap(err, "error listing nodes")
 	}
+	kept := make(map[string]bool, len(keep))
+	for _, name := range keep {
+		kept[name] = true
+	}
+	n := []nodes.Node{}
+	for _, node := range all {
+		if !kept[node.Name()] {
+			n = append(n, node)
+		}
+	}
 
 	// try to remove the kind kube config file generated by "kind create cluster"
 	err = os.Remove(c.KubeConfigPath())
@@ -46,5 +64,10 @@ func Cluster(c *context.Context) error {
 		fmt.Printf("$KUBECONFIG is still set to use %s even though that file has been deleted, remember to unset it\n", c.KubeConfigPath())
 	}
 
-	return nodes.Delete(n...)
+	if err := nodes.Delete(n...); err != nil {
+		return err
+	}
+
+	// delete networks created for the cluster, like the macvlan network
+	return docker.DeleteNetworks(c.ClusterLabel().Filter())
 }
@@ -23,6 +23,14 @@ const APIServerPort = 6443
 // Token defines a dummy, well known token for automating TLS bootstrap process
 const Token = "abcdef.0123456789abcdef"
 
+// ConfigPath is where the kubeadm config is written on the bootstrap control
+// plane node
+const ConfigPath = "/kind/kubeadm.conf"
+
+// JoinTokenPath is where the join token may be placed on worker nodes ahead
+// of joining them
+const JoinTokenPath = "/kind/join-token"
+
 // ObjectName is the name every generated object will have
 // I.E. `metadata:\nname: config`
 const ObjectName = "config"
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeadm
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// tokenCharset are the characters of bootstrap tokens,
+// see https://kubernetes.io/docs/reference/access-authn-authz/bootstrap-tokens/
+const tokenCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// NewToken returns a random bootstrap token, to use instead of the well
+// known Token
+func NewToken() (string, error) {
+	id, err := randomString(6)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	return id + "." + secret, nil
+}
+
+func randomString(length int) (string, error) {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(tokenCharset)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to generate a bootstrap token")
+		}
+		b[i] = tokenCharset[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeadm
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewToken(t *testing.T) {
+	// https://kubernetes.io/docs/reference/access-authn-authz/bootstrap-tokens/#token-format
+	format := regexp.MustCompile(`^[a-z0-9]{6}\.[a-z0-9]{16}$`)
+	token, err := NewToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !format.MatchString(token) {
+		t.Errorf("expected a bootstrap token, got %q", token)
+	}
+	if token == Token {
+		t.Error("expected a token other than the well known one")
+	}
+	other, err := NewToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other == token {
+		t.Errorf("expected different tokens, got %q twice", token)
+	}
+}
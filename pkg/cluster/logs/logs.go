@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/container/docker"
 	"sigs.k8s.io/kind/pkg/exec"
 	"sigs.k8s.io/kind/pkg/util"
 )
@@ -58,7 +59,7 @@ func Collect(nodes []nodes.Node, dir string) error {
 		// TODO(bentheelder): record the kind version here as well
 		// record info about the host docker
 		execToPathFn(
-			exec.Command("docker", "info"),
+			docker.Command("info"),
 			"docker-info.txt",
 		),
 	}
@@ -70,7 +71,7 @@ func Collect(nodes []nodes.Node, dir string) error {
 			return coalesce(
 				// record info about the node container
 				execToPathFn(
-					exec.Command("docker", "inspect", name),
+					docker.Command("inspect", name),
 					filepath.Join(name, "inspect.json"),
 				),
 				// grab all of the node logs
@@ -18,10 +18,13 @@ package nodes
 
 import (
 	"fmt"
+	"math"
 	"net"
-	"os"
+	"sort"
+	"strconv"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/kind/pkg/cluster/config"
 	"sigs.k8s.io/kind/pkg/cluster/constants"
 	"sigs.k8s.io/kind/pkg/cluster/internal/haproxy"
@@ -51,15 +54,18 @@ func getPort() (int, error) {
 
 // CreateControlPlaneNode creates a contol-plane node
 // and gets ready for exposing the the API server
-func CreateControlPlaneNode(name, image, clusterLabel string, mounts []cri.Mount) (node *Node, err error) {
-	// gets a random host port for the API server
-	port, err := getPort()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get port for API server")
+func CreateControlPlaneNode(name, image string, clusterLabel ClusterLabel, mounts []cri.Mount, opts ...CreateOpt) (node *Node, err error) {
+	// gets a random host port for the API server, unless configured
+	port := buildCreateOpts(opts).APIServerHostPort
+	if port == 0 {
+		port, err = getPort()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get port for API server")
+		}
 	}
 
 	node, err = createNode(
-		name, image, clusterLabel, config.ControlPlaneRole, mounts,
+		name, image, clusterLabel, config.ControlPlaneRole, mounts, opts,
 		// publish selected port for the API server
 		"--expose", fmt.Sprintf("%d", port),
 		"-p", fmt.Sprintf("%d:%d", port, kubeadm.APIServerPort),
@@ -78,15 +84,19 @@ func CreateControlPlaneNode(name, image, clusterLabel string, mounts []cri.Mount
 
 // CreateExternalLoadBalancerNode creates an external loab balancer node
 // and gets ready for exposing the the API server and the load balancer admin console
-func CreateExternalLoadBalancerNode(name, image, clusterLabel string) (node *Node, err error) {
-	// gets a random host port for control-plane load balancer
-	port, err := getPort()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get port for control-plane load balancer")
+func CreateExternalLoadBalancerNode(name, image string, clusterLabel ClusterLabel, opts ...CreateOpt) (node *Node, err error) {
+	// gets a random host port for control-plane load balancer, unless
+	// configured
+	port := buildCreateOpts(opts).APIServerHostPort
+	if port == 0 {
+		port, err = getPort()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get port for control-plane load balancer")
+		}
 	}
 
 	node, err = createNode(name, image, clusterLabel, config.ExternalLoadBalancerRole,
-		nil,
+		nil, opts,
 		// publish selected port for the control plane
 		"--expose", fmt.Sprintf("%d", port),
 		"-p", fmt.Sprintf("%d:%d", port, haproxy.ControlPlanePort),
@@ -103,9 +113,15 @@ func CreateExternalLoadBalancerNode(name, image, clusterLabel string) (node *Nod
 	return node, nil
 }
 
+// CreateExternalEtcdNode creates an external etcd node, which is provisioned
+// like any other node but does not join the cluster
+func CreateExternalEtcdNode(name, image string, clusterLabel ClusterLabel, opts ...CreateOpt) (node *Node, err error) {
+	return createNode(name, image, clusterLabel, config.ExternalEtcdRole, nil, opts)
+}
+
 // CreateWorkerNode creates a worker node
-func CreateWorkerNode(name, image, clusterLabel string, mounts []cri.Mount) (node *Node, err error) {
-	node, err = createNode(name, image, clusterLabel, config.WorkerRole, mounts)
+func CreateWorkerNode(name, image string, clusterLabel ClusterLabel, mounts []cri.Mount, opts ...CreateOpt) (node *Node, err error) {
+	node, err = createNode(name, image, clusterLabel, config.WorkerRole, mounts, opts)
 	if err != nil {
 		return node, err
 	}
@@ -116,7 +132,13 @@ func CreateWorkerNode(name, image, clusterLabel string, mounts []cri.Mount) (nod
 // createNode `docker run`s the node image, note that due to
 // images/node/entrypoint being the entrypoint, this container will
 // effectively be paused until we call actuallyStartNode(...)
-func createNode(name, image, clusterLabel string, role config.NodeRole, mounts []cri.Mount, extraArgs ...string) (handle *Node, err error) {
+func createNode(name, image string, clusterLabel ClusterLabel, role config.NodeRole, mounts []cri.Mount, opts []CreateOpt, extraArgs ...string) (handle *Node, err error) {
+	o := buildCreateOpts(opts)
+	hostname := name
+	if o.Hostname != "" {
+		hostname = o.Hostname
+	}
+
 	runArgs := []string{
 		"-d", // run the container detached
 		// running containers in a container requires privileged
@@ -125,34 +147,134 @@ func createNode(name, image, clusterLabel string, role config.NodeRole, mounts [
 		// including some ones docker would otherwise do by default.
 		// for now this is what we want. in the future we may revisit this.
 		"--privileged",
-		"--security-opt", "seccomp=unconfined", // also ignore seccomp
 		"--tmpfs", "/tmp", // various things depend on working /tmp
 		"--tmpfs", "/run", // systemd wants a writable /run
 		// some k8s things want /lib/modules
 		"-v", "/lib/modules:/lib/modules:ro",
-		"--hostname", name, // make hostname match container name
+		"--hostname", hostname, // make hostname match container name, by default
 		"--name", name, // ... and set the container name
 		// label the node with the cluster ID
-		"--label", clusterLabel,
+		"--label", string(clusterLabel),
 		// label the node with the role ID
 		"--label", fmt.Sprintf("%s=%s", constants.NodeRoleKey, role),
-		// explicitly set the entrypoint
-		"--entrypoint=/usr/local/bin/entrypoint",
 	}
 
+	// also ignore seccomp, unless a profile is set
+	if o.SeccompProfile != "" {
+		log.Warningf(
+			"Node %s runs privileged, the seccomp profile %s may not restrict it as expected",
+			name, o.SeccompProfile,
+		)
+		runArgs = append(runArgs, "--security-opt", "seccomp="+o.SeccompProfile)
+	} else {
+		runArgs = append(runArgs, "--security-opt", "seccomp=unconfined")
+	}
+
+	// explicitly set the entrypoint, unless it is overridden
+	entrypoint := []string{"/usr/local/bin/entrypoint", "/sbin/init"}
+	if len(o.Entrypoint) > 0 {
+		log.Warningf(
+			"Node %s has an overridden entrypoint %v, it will likely not boot like a normal node",
+			name, o.Entrypoint,
+		)
+		entrypoint = o.Entrypoint
+	}
+	runArgs = append(runArgs, "--entrypoint="+entrypoint[0])
+
 	// pass proxy environment variables to be used by node's docker deamon
-	httpProxy := os.Getenv("HTTP_PROXY")
-	if httpProxy != "" {
-		runArgs = append(runArgs, "-e", "HTTP_PROXY="+httpProxy)
+	proxyEnv := o.ProxyEnv
+	if proxyEnv == nil {
+		proxyEnv = HostProxyEnv()
+	}
+	for _, name := range proxyEnvs {
+		if proxyEnv[name] != "" {
+			runArgs = append(runArgs, "-e", name+"="+proxyEnv[name])
+		}
 	}
-	httpsProxy := os.Getenv("HTTPS_PROXY")
-	if httpsProxy != "" {
-		runArgs = append(runArgs, "-e", "HTTPS_PROXY="+httpsProxy)
+
+	// systemd environment, for systemd itself as the container's init
+	for _, name := range sortedKeys(o.SystemdEnv) {
+		runArgs = append(runArgs, "-e", fmt.Sprintf("%s=%s", name, o.SystemdEnv[name]))
+	}
+
+	// additional environment, which may not set the variables above
+	for _, name := range sortedKeys(o.ExtraEnv) {
+		runArgs = append(runArgs, "-e", fmt.Sprintf("%s=%s", name, o.ExtraEnv[name]))
 	}
 
-	noProxy := os.Getenv("NO_PROXY")
-	if noProxy != "" {
-		runArgs = append(runArgs, "-e", "NO_PROXY="+noProxy)
+	if o.DomainName != "" {
+		runArgs = append(runArgs, "--domainname", o.DomainName)
+	}
+
+	if o.Network != "" {
+		runArgs = append(runArgs, "--network", o.Network)
+	}
+
+	// additional labels, sorted for a stable command line
+	labelKeys := make([]string, 0, len(o.Labels))
+	for key := range o.Labels {
+		// the labels identifying the node may not be overwritten
+		if key == constants.ClusterLabelKey || key == constants.NodeRoleKey {
+			return nil, errors.Errorf("container label %q is reserved by kind", key)
+		}
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		runArgs = append(runArgs, "--label", fmt.Sprintf("%s=%s", key, o.Labels[key]))
+	}
+
+	for _, host := range o.ExtraHosts {
+		runArgs = append(runArgs, "--add-host", host)
+	}
+
+	annotationKeys := make([]string, 0, len(o.Annotations))
+	for key := range o.Annotations {
+		annotationKeys = append(annotationKeys, key)
+	}
+	sort.Strings(annotationKeys)
+	for _, key := range annotationKeys {
+		runArgs = append(runArgs, "--annotation", fmt.Sprintf("%s=%s", key, o.Annotations[key]))
+	}
+
+	// --privileged grants every capability, so adding them is only useful
+	// after dropping them
+	if len(o.CapAdd) > 0 && len(o.CapDrop) == 0 {
+		log.Warningf(
+			"Node %s runs privileged with every capability, adding capabilities %v has no effect",
+			name, o.CapAdd,
+		)
+	}
+	for _, capability := range o.CapAdd {
+		runArgs = append(runArgs, "--cap-add", capability)
+	}
+	for _, capability := range o.CapDrop {
+		runArgs = append(runArgs, "--cap-drop", capability)
+	}
+
+	if o.CPUs != "" {
+		runArgs = append(runArgs, "--cpus", o.CPUs)
+	}
+	if o.Memory != "" {
+		runArgs = append(runArgs, "--memory", o.Memory)
+	}
+	if o.MemorySwap != "" {
+		runArgs = append(runArgs, "--memory-swap", o.MemorySwap)
+	}
+	if o.PidsLimit != 0 {
+		runArgs = append(runArgs, "--pids-limit", strconv.FormatInt(o.PidsLimit, 10))
+	}
+	if o.GPUs != "" {
+		runArgs = append(runArgs, "--gpus", o.GPUs)
+	}
+	for _, key := range sortedKeys(o.Sysctls) {
+		runArgs = append(runArgs, "--sysctl", fmt.Sprintf("%s=%s", key, o.Sysctls[key]))
+	}
+
+	if o.StopTimeout != nil {
+		// docker only supports whole seconds, round up
+		seconds := int64(math.Ceil(o.StopTimeout.Seconds()))
+		runArgs = append(runArgs, "--stop-timeout", fmt.Sprintf("%d", seconds))
 	}
 
 	// adds node specific args
@@ -167,11 +289,10 @@ func createNode(name, image, clusterLabel string, role config.NodeRole, mounts [
 	id, err := docker.Run(
 		image,
 		docker.WithRunArgs(runArgs...),
-		docker.WithContainerArgs(
-			// explicitly pass the entrypoint argument
-			"/sbin/init",
-		),
-		docker.WithMounts(mounts),
+		// explicitly pass the entrypoint arguments
+		docker.WithContainerArgs(entrypoint[1:]...),
+		docker.WithMounts(withInitScript(mounts, o.InitScript)),
+		docker.WithPortMappings(o.PortMappings),
 	)
 
 	// if there is a returned ID then we did create a container
@@ -184,6 +305,12 @@ func createNode(name, image, clusterLabel string, role config.NodeRole, mounts [
 		return handle, errors.Wrap(err, "docker run error")
 	}
 
+	for _, network := range o.Networks {
+		if err := docker.ConnectNetwork(network, name); err != nil {
+			return handle, err
+		}
+	}
+
 	// Deletes the machine-id embedded in the node image and regenerate a new one.
 	// This is necessary because both kubelet and other components like weave net
 	// use machine-id internally to distinguish nodes.
@@ -195,5 +322,65 @@ func createNode(name, image, clusterLabel string, role config.NodeRole, mounts [
 		return handle, errors.Wrap(err, "machine-id-setup error")
 	}
 
+	// ... and for the units it starts, this is written before the node boots
+	// and apart from the docker drop-in SetProxy writes
+	if len(o.SystemdEnv) > 0 {
+		if err := handle.writeSystemdEnv(o.SystemdEnv); err != nil {
+			return handle, err
+		}
+	}
+
+	if o.InitScript != "" {
+		if err := handle.installInitScriptUnit(); err != nil {
+			return handle, err
+		}
+	}
+
+	// --privileged disables the container runtime's path masking, so we
+	// mask the requested paths ourselves before the node boots
+	if len(o.MaskedPaths) > 0 || len(o.ReadonlyPaths) > 0 {
+		log.Warningf(
+			"Node %s runs privileged, processes in it may undo the masked and read only paths",
+			name,
+		)
+	}
+	if err := handle.maskPaths(o.MaskedPaths); err != nil {
+		return handle, err
+	}
+	if err := handle.readonlyPaths(o.ReadonlyPaths); err != nil {
+		return handle, err
+	}
+
 	return handle, nil
 }
+
+// maskPaths masks paths in the node like the container runtime would for an
+// unprivileged container: directories are covered with an empty read only
+// tmpfs and files with /dev/null, paths that do not exist are ignored
+func (n *Node) maskPaths(paths []string) error {
+	for _, path := range paths {
+		if err := n.Command(
+			"/bin/sh", "-c",
+			`if [ -d "$1" ]; then mount -t tmpfs -o ro tmpfs "$1"; elif [ -e "$1" ]; then mount --bind /dev/null "$1"; fi`,
+			"mask", path,
+		).Run(); err != nil {
+			return errors.Wrapf(err, "failed to mask path %s", path)
+		}
+	}
+	return nil
+}
+
+// readonlyPaths bind mounts paths in the node over themselves read only,
+// paths that do not exist are ignored
+func (n *Node) readonlyPaths(paths []string) error {
+	for _, path := range paths {
+		if err := n.Command(
+			"/bin/sh", "-c",
+			`if [ -e "$1" ]; then mount --bind "$1" "$1" && mount -o remount,bind,ro "$1"; fi`,
+			"readonly", path,
+		).Run(); err != nil {
+			return errors.Wrapf(err, "failed to make path %s read only", path)
+		}
+	}
+	return nil
+}
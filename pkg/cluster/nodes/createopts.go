@@ -0,0 +1,276 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"time"
+
+	"sigs.k8s.io/kind/pkg/container/cri"
+)
+
+// CreateOpt is an option for the Create*Node functions
+type CreateOpt func(*createOpts) *createOpts
+
+// actual options struct
+type createOpts struct {
+	MaskedPaths    []string
+	ReadonlyPaths  []string
+	Hostname       string
+	DomainName     string
+	Labels         map[string]string
+	ExtraHosts     []string
+	Annotations    map[string]string
+	Entrypoint     []string
+	CapAdd         []string
+	CapDrop        []string
+	StopTimeout    *time.Duration
+	SeccompProfile string
+	Network        string
+	Networks       []string
+	InitScript     string
+	CPUs           string
+	Memory         string
+	MemorySwap     string
+	PidsLimit      int64
+	SystemdEnv     map[string]string
+	PortMappings   []cri.PortMapping
+	ProxyEnv       map[string]string
+	ExtraEnv       map[string]string
+	GPUs           string
+	Sysctls        map[string]string
+	// APIServerHostPort publishes the API server, see WithAPIServerHostPort
+	APIServerHostPort int
+}
+
+// WithMaskedPaths sets paths to mask in the node container
+func WithMaskedPaths(paths []string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.MaskedPaths = paths
+		return c
+	}
+}
+
+// WithReadonlyPaths sets paths to make read only in the node container
+func WithReadonlyPaths(paths []string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.ReadonlyPaths = paths
+		return c
+	}
+}
+
+// WithHostname sets the hostname of the node container, by default it is
+// the node name
+func WithHostname(hostname string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Hostname = hostname
+		return c
+	}
+}
+
+// WithDomainName sets the NIS domain name of the node container
+func WithDomainName(domainName string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.DomainName = domainName
+		return c
+	}
+}
+
+// WithLabels sets additional labels on the node container
+func WithLabels(labels map[string]string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Labels = labels
+		return c
+	}
+}
+
+// WithExtraHosts sets additional host:ip entries for the node's /etc/hosts
+func WithExtraHosts(hosts []string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.ExtraHosts = hosts
+		return c
+	}
+}
+
+// WithAnnotations sets OCI annotations on the node container
+func WithAnnotations(annotations map[string]string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Annotations = annotations
+		return c
+	}
+}
+
+// WithEntrypoint overrides the node container's entrypoint and its
+// arguments, the node image's entrypoint will not run
+func WithEntrypoint(entrypoint []string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Entrypoint = entrypoint
+		return c
+	}
+}
+
+// WithCapabilities adds and drops Linux capabilities for the node container
+func WithCapabilities(add, drop []string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.CapAdd = add
+		c.CapDrop = drop
+		return c
+	}
+}
+
+// WithStopTimeout sets how long the node container is given to stop
+// gracefully before it is killed
+func WithStopTimeout(timeout *time.Duration) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.StopTimeout = timeout
+		return c
+	}
+}
+
+// WithSeccompProfile sets the path to a seccomp profile for the node
+// container instead of running it unconfined
+func WithSeccompProfile(path string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.SeccompProfile = path
+		return c
+	}
+}
+
+// WithNetwork creates the node container on the docker network instead of
+// the default bridge network
+func WithNetwork(network string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Network = network
+		return c
+	}
+}
+
+// WithNetworks connects the node container to additional docker networks,
+// besides the default network
+func WithNetworks(networks []string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Networks = networks
+		return c
+	}
+}
+
+// WithInitScript runs the executable script at hostPath in the node on
+// boot, see InitScriptPath
+func WithInitScript(hostPath string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.InitScript = hostPath
+		return c
+	}
+}
+
+// WithResources limits the CPUs and memory of the node container, as
+// accepted by docker run --cpus and --memory, empty values are not limited
+func WithResources(cpus, memory string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.CPUs = cpus
+		c.Memory = memory
+		return c
+	}
+}
+
+// WithMemorySwap limits the memory and swap of the node container together,
+// as accepted by docker run --memory-swap, empty values are not limited
+func WithMemorySwap(memorySwap string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.MemorySwap = memorySwap
+		return c
+	}
+}
+
+// WithPidsLimit limits the number of processes in the node container, as
+// docker run --pids-limit, zero is not limited
+func WithPidsLimit(limit int64) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.PidsLimit = limit
+		return c
+	}
+}
+
+// WithSystemdEnv sets environment variables for systemd in the node and the
+// units it starts, see constants.ReservedNodeEnv for the variables kind sets
+func WithSystemdEnv(env map[string]string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.SystemdEnv = env
+		return c
+	}
+}
+
+// WithPortMappings publishes the node container ports on the host
+func WithPortMappings(portMappings []cri.PortMapping) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.PortMappings = portMappings
+		return c
+	}
+}
+
+// WithProxyEnv sets the proxy environment variables of the node container
+// instead of passing those of the host, see HostProxyEnv. An empty non-nil
+// env configures no proxy.
+func WithProxyEnv(env map[string]string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.ProxyEnv = env
+		return c
+	}
+}
+
+// WithExtraEnv sets additional environment variables in the node container,
+// see constants.ReservedNodeEnv for the variables kind sets
+func WithExtraEnv(env map[string]string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.ExtraEnv = env
+		return c
+	}
+}
+
+// WithGPUs requests GPUs for the node container as with docker run --gpus
+func WithGPUs(gpus string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.GPUs = gpus
+		return c
+	}
+}
+
+// WithAPIServerHostPort publishes the API server of a control plane node,
+// or the control plane port of a load balancer node, on port of the host
+// instead of a random free port
+func WithAPIServerHostPort(port int) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.APIServerHostPort = port
+		return c
+	}
+}
+
+// WithSysctls sets namespaced kernel parameters in the node container, as
+// docker run --sysctl
+func WithSysctls(sysctls map[string]string) CreateOpt {
+	return func(c *createOpts) *createOpts {
+		c.Sysctls = sysctls
+		return c
+	}
+}
+
+func buildCreateOpts(opts []CreateOpt) *createOpts {
+	o := &createOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	return o
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+	"sigs.k8s.io/kind/pkg/container/cri"
+)
+
+// InitScriptPath is where a node's init script is mounted in the node
+const InitScriptPath = constants.NodeInitScriptPath
+
+// the systemd unit running the init script
+const initScriptUnitPath = "/etc/systemd/system/kind-init-script.service"
+
+// initScriptUnit runs the init script on boot, after the local filesystems
+// are mounted (including the script itself) and before the kubelet starts
+const initScriptUnit = `[Unit]
+Description=kind node init script
+After=local-fs.target
+Before=kubelet.service
+
+[Service]
+Type=oneshot
+ExecStart=` + InitScriptPath + `
+RemainAfterExit=yes
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// withInitScript returns mounts with the init script at hostPath mounted,
+// if hostPath is set
+func withInitScript(mounts []cri.Mount, hostPath string) []cri.Mount {
+	if hostPath == "" {
+		return mounts
+	}
+	return append(append([]cri.Mount{}, mounts...), cri.Mount{
+		HostPath:      hostPath,
+		ContainerPath: InitScriptPath,
+		Readonly:      true,
+	})
+}
+
+// installInitScriptUnit installs and enables the init script unit, this
+// must be called before the node boots into systemd
+func (n *Node) installInitScriptUnit() error {
+	if err := n.WriteFile(initScriptUnitPath, initScriptUnit); err != nil {
+		return errors.Wrap(err, "failed to write init script unit")
+	}
+	cmd := n.Command(
+		"ln", "-sf", initScriptUnitPath,
+		"/etc/systemd/system/multi-user.target.wants/kind-init-script.service",
+	)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrap(err, "failed to enable init script unit")
+	}
+	return nil
+}
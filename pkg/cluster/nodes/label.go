@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+)
+
+// ClusterLabel is the docker object label identifying the "node" containers
+// (and other docker objects) of a cluster, in the key=value form accepted
+// by docker's --label flag
+type ClusterLabel string
+
+// labelValueEscapes are the characters escaped in the cluster label value,
+// they would otherwise break parsing docker's ps and inspect output
+const labelValueEscapes = "%'\t\r\n"
+
+// NewClusterLabel returns the cluster label for the cluster named clusterName
+func NewClusterLabel(clusterName string) ClusterLabel {
+	return ClusterLabel(fmt.Sprintf("%s=%s", constants.ClusterLabelKey, escapeLabelValue(clusterName)))
+}
+
+// ParseClusterLabel parses a key=value docker label into a cluster label,
+// the key must be constants.ClusterLabelKey
+func ParseClusterLabel(label string) (ClusterLabel, error) {
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) != 2 || parts[0] != constants.ClusterLabelKey {
+		return "", errors.Errorf("%q is not a %s label", label, constants.ClusterLabelKey)
+	}
+	if _, err := unescapeLabelValue(parts[1]); err != nil {
+		return "", errors.Wrapf(err, "invalid %s label %q", constants.ClusterLabelKey, label)
+	}
+	return ClusterLabel(label), nil
+}
+
+// ClusterName returns the name of the cluster identified by the label
+func (l ClusterLabel) ClusterName() string {
+	value := strings.TrimPrefix(string(l), constants.ClusterLabelKey+"=")
+	// labels are validated on construction
+	name, _ := unescapeLabelValue(value)
+	return name
+}
+
+// Filter returns the docker filter matching objects with the label
+func (l ClusterLabel) Filter() string {
+	return "label=" + string(l)
+}
+
+func escapeLabelValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(labelValueEscapes, value[i]) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", value[i])
+		} else {
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+func unescapeLabelValue(value string) (string, error) {
+	return url.PathUnescape(value)
+}
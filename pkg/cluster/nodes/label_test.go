@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"testing"
+
+	"sigs.k8s.io/kind/pkg/cluster/constants"
+)
+
+func TestClusterLabel(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		ClusterName string
+		Expected    ClusterLabel
+	}{
+		{
+			TestName:    "plain name",
+			ClusterName: "kind",
+			Expected:    constants.ClusterLabelKey + "=kind",
+		},
+		{
+			TestName:    "equals sign is not escaped",
+			ClusterName: "a=b",
+			Expected:    constants.ClusterLabelKey + "=a=b",
+		},
+		{
+			TestName:    "percent sign",
+			ClusterName: "100%",
+			Expected:    constants.ClusterLabelKey + "=100%25",
+		},
+		{
+			TestName:    "quotes and whitespace",
+			ClusterName: "it's\ta\r\nname",
+			Expected:    constants.ClusterLabelKey + "=it%27s%09a%0D%0Aname",
+		},
+		{
+			TestName:    "empty name",
+			ClusterName: "",
+			Expected:    constants.ClusterLabelKey + "=",
+		},
+	}
+	for _, tc := range cases {
+		tc := tc // capture tc
+		t.Run(tc.TestName, func(t *testing.T) {
+			label := NewClusterLabel(tc.ClusterName)
+			if label != tc.Expected {
+				t.Errorf("expected label %q, got %q", tc.Expected, label)
+			}
+			if label.Filter() != "label="+string(tc.Expected) {
+				t.Errorf("unexpected filter %q", label.Filter())
+			}
+			parsed, err := ParseClusterLabel(string(label))
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %v", label, err)
+			}
+			if parsed != label {
+				t.Errorf("expected parsed label %q, got %q", label, parsed)
+			}
+			if name := parsed.ClusterName(); name != tc.ClusterName {
+				t.Errorf("expected cluster name %q, got %q", tc.ClusterName, name)
+			}
+		})
+	}
+}
+
+func TestParseClusterLabelInvalid(t *testing.T) {
+	for _, label := range []string{
+		"",
+		"kind",
+		"io.k8s.sigs.kind.role=kind",
+		constants.ClusterLabelKey,
+		constants.ClusterLabelKey + "=bad%zzescape",
+	} {
+		if _, err := ParseClusterLabel(label); err == nil {
+			t.Errorf("expected an error parsing %q", label)
+		}
+	}
+}
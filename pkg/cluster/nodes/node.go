@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -135,11 +136,38 @@ func (n *Node) CopyFrom(source, dest string) error {
 	return docker.CopyFrom(n.name, source, dest)
 }
 
-// WaitForDocker waits for Docker to be ready on the node
-// it returns true on success, and false on a timeout
-func (n *Node) WaitForDocker(until time.Time) bool {
-	return tryUntil(until, func() bool {
-		cmd := n.Command("systemctl", "is-active", "docker")
+// WaitForDocker waits for Docker to be ready on the node, checking every
+// interval, it returns how long it waited and true on success, and false on
+// a timeout
+func (n *Node) WaitForDocker(until time.Time, interval time.Duration) (time.Duration, bool) {
+	return n.waitForService(until, interval, "docker")
+}
+
+// WaitForInit waits for the node entrypoint to hand over to the init after
+// SignalStart, checking every interval, it returns how long it waited and
+// true on success, and false on a timeout
+func (n *Node) WaitForInit(until time.Time, interval time.Duration) (time.Duration, bool) {
+	return tryUntilEvery(until, interval, func() bool {
+		// the entrypoint execs the init as PID 1
+		cmd := n.Command("cat", "/proc/1/comm")
+		out, err := exec.CombinedOutputLines(cmd)
+		if err != nil {
+			return false
+		}
+		return len(out) == 1 && out[0] != "entrypoint"
+	})
+}
+
+// WaitForContainerd is like WaitForDocker, but waits for containerd, for
+// nodes running their containers with containerd directly
+func (n *Node) WaitForContainerd(until time.Time, interval time.Duration) (time.Duration, bool) {
+	return n.waitForService(until, interval, "containerd")
+}
+
+// waitForService waits for the systemd service to be active on the node
+func (n *Node) waitForService(until time.Time, interval time.Duration, service string) (time.Duration, bool) {
+	return tryUntilEvery(until, interval, func() bool {
+		cmd := n.Command("systemctl", "is-active", service)
 		out, err := exec.CombinedOutputLines(cmd)
 		if err != nil {
 			return false
@@ -148,15 +176,33 @@ func (n *Node) WaitForDocker(until time.Time) bool {
 	})
 }
 
+// now and sleep are the clock used by tryUntilEvery, these are variables so
+// that tests may fake them
+var (
+	now   = time.Now
+	sleep = time.Sleep
+)
+
 // helper that calls `try()`` in a loop until the deadline `until`
 // has passed or `try()`returns true, returns wether try ever returned true
 func tryUntil(until time.Time, try func() bool) bool {
-	for until.After(time.Now()) {
+	_, ok := tryUntilEvery(until, 0, try)
+	return ok
+}
+
+// tryUntilEvery is like tryUntil, but waits interval between the calls to
+// try, it also returns how long it tried for
+func tryUntilEvery(until time.Time, interval time.Duration, try func() bool) (time.Duration, bool) {
+	start := now()
+	for until.After(now()) {
 		if try() {
-			return true
+			return now().Sub(start), true
+		}
+		if interval > 0 {
+			sleep(interval)
 		}
 	}
-	return false
+	return now().Sub(start), false
 }
 
 // LoadImages loads image tarballs stored on the node into docker on the node
@@ -171,6 +217,48 @@ func (n *Node) LoadImages() {
 		return
 	}
 
+	n.RetagImages()
+}
+
+// imagesDir is where image tarballs are stored on the node
+const imagesDir = "/kind/images"
+
+// ImageArchives returns the paths of the image tarballs stored on the node,
+// see LoadImageArchive
+func (n *Node) ImageArchives() ([]string, error) {
+	lines, err := exec.CombinedOutputLines(n.Command(
+		"/bin/bash", "-c",
+		// nodes without stored images have no images directory
+		`if [ -d "$1" ]; then find "$1" -name '*.tar'; fi`,
+		"list", imagesDir,
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list image archives")
+	}
+	return lines, nil
+}
+
+// LoadImageArchive loads an image tarball stored on the node into docker on
+// the node
+func (n *Node) LoadImageArchive(archive string) error {
+	if err := n.Command("docker", "load", "-i", archive).Run(); err != nil {
+		return errors.Wrapf(err, "failed to load image archive %s", archive)
+	}
+	return nil
+}
+
+// ImportImageArchive is like LoadImageArchive, but imports the image tarball
+// into containerd with ctr, in the namespace used by Kubernetes
+func (n *Node) ImportImageArchive(archive string) error {
+	if err := n.Command("ctr", "--namespace=k8s.io", "images", "import", archive).Run(); err != nil {
+		return errors.Wrapf(err, "failed to import image archive %s", archive)
+	}
+	return nil
+}
+
+// RetagImages adds the arch to the name of images loaded on the node, as
+// required by older Kubernetes releases, see LoadImages
+func (n *Node) RetagImages() {
 	// if this fails, we don't care yet, but try to get the kubernetes version
 	// and see if we can skip retagging for amd64
 	// if this fails, we can just assume some unknown version and re-tag
@@ -257,20 +345,34 @@ func (n *Node) KubeVersion() (version string, err error) {
 	return version, nil
 }
 
-// IP returns the IP address of the node
+// IP returns the IP address of the node on the network it was created on,
+// the node may be connected to more networks
 func (n *Node) IP() (ip string, err error) {
 	// use the cached version first
 	cachedIP := n.cache.IP()
 	if cachedIP != "" {
 		return cachedIP, nil
 	}
-	// retrive the IP address of the node using docker inspect
-	lines, err := docker.Inspect(n.name, "{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}")
+	// retrive the network the node was created on using docker inspect,
+	// nodes created without a network are on the default bridge network
+	lines, err := docker.Inspect(n.name, "{{.HostConfig.NetworkMode}}")
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get file")
+		return "", errors.Wrap(err, "failed to get node network")
 	}
 	if len(lines) != 1 {
-		return "", errors.Errorf("file should only be one line, got %d lines", len(lines))
+		return "", errors.Errorf("network should only be one line, got %d lines", len(lines))
+	}
+	network := lines[0]
+	if network == "" || network == "default" {
+		network = "bridge"
+	}
+	// then the IP address of the node on that network
+	lines, err = docker.Inspect(n.name, fmt.Sprintf("{{with index .NetworkSettings.Networks %q}}{{.IPAddress}}{{end}}", network))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get node IP address")
+	}
+	if len(lines) != 1 || lines[0] == "" {
+		return "", errors.Errorf("node %s has no IP address on network %s", n.name, network)
 	}
 	ip = lines[0]
 	n.cache.set(func(cache *nodeCache) {
@@ -412,10 +514,16 @@ var proxyEnvs = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
 //
 // See also: NeedProxy
 func (n *Node) SetProxy() error {
+	return n.SetProxyEnv(HostProxyEnv())
+}
+
+// SetProxyEnv is like SetProxy, but configures the proxy settings in env
+// rather than those of the host, empty settings are skipped
+func (n *Node) SetProxyEnv(env map[string]string) error {
 	// configure Docker daemon to use proxy
 	proxies := ""
 	for _, name := range proxyEnvs {
-		val := os.Getenv(name)
+		val := env[name]
 		if val != "" {
 			proxies += fmt.Sprintf("\"%s=%s\" ", name, val)
 		}
@@ -425,20 +533,43 @@ func (n *Node) SetProxy() error {
 		err := n.WriteFile("/etc/systemd/system/docker.service.d/http-proxy.conf",
 			"[Service]\nEnvironment="+proxies)
 		if err != nil {
-			errors.Wrap(err, "failed to create http-proxy drop-in")
+			return errors.Wrap(err, "failed to create http-proxy drop-in")
 		}
 	}
 
 	return nil
 }
 
+// HostProxyEnv returns the proxy environment variables set on the host
+func HostProxyEnv() map[string]string {
+	env := map[string]string{}
+	for _, name := range proxyEnvs {
+		if val := os.Getenv(name); val != "" {
+			env[name] = val
+		}
+	}
+	return env
+}
+
 // NeedProxy returns true if the host environment appears to have proxy settings
-// that should be passed to the nodes
-func NeedProxy() bool {
+// that should be passed to the nodes, and an error if the proxy URLs are invalid
+func NeedProxy() (bool, error) {
+	need := false
 	for _, env := range proxyEnvs {
-		if os.Getenv(env) != "" {
-			return true
+		val := os.Getenv(env)
+		if val == "" {
+			continue
+		}
+		need = true
+		if env == "NO_PROXY" {
+			continue
+		}
+		// like net/http, accept proxies without a scheme
+		if _, err := url.Parse(val); err != nil {
+			if _, err := url.Parse("http://" + val); err != nil {
+				return true, errors.Wrapf(err, "invalid %s", env)
+			}
 		}
 	}
-	return false
+	return need, nil
 }
@@ -0,0 +1,195 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// fakeClock replaces the clock used by tryUntilEvery for the duration of a
+// test, sleeping advances the fake time instantly
+func fakeClock(t *testing.T) {
+	realNow, realSleep := now, sleep
+	t.Cleanup(func() {
+		now, sleep = realNow, realSleep
+	})
+	current := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		return current
+	}
+	sleep = func(d time.Duration) {
+		current = current.Add(d)
+	}
+}
+
+func TestTryUntilEvery(t *testing.T) {
+	cases := []struct {
+		TestName       string
+		Interval       time.Duration
+		Timeout        time.Duration
+		ReadyAttempt   int
+		ExpectAttempts int
+		ExpectElapsed  time.Duration
+		ExpectReady    bool
+	}{
+		{
+			TestName:       "Times out",
+			Interval:       time.Second,
+			Timeout:        10 * time.Second,
+			ExpectAttempts: 10,
+			ExpectElapsed:  10 * time.Second,
+			ExpectReady:    false,
+		},
+		{
+			TestName:       "Slower polling times out after fewer attempts",
+			Interval:       3 * time.Second,
+			Timeout:        10 * time.Second,
+			ExpectAttempts: 4,
+			ExpectElapsed:  12 * time.Second,
+			ExpectReady:    false,
+		},
+		{
+			TestName:       "Ready on the third attempt",
+			Interval:       time.Second,
+			Timeout:        10 * time.Second,
+			ReadyAttempt:   3,
+			ExpectAttempts: 3,
+			ExpectElapsed:  2 * time.Second,
+			ExpectReady:    true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			fakeClock(t)
+			attempts := 0
+			elapsed, ready := tryUntilEvery(now().Add(tc.Timeout), tc.Interval, func() bool {
+				attempts++
+				return attempts == tc.ReadyAttempt
+			})
+			if attempts != tc.ExpectAttempts {
+				t.Errorf("expected %d attempts, got %d", tc.ExpectAttempts, attempts)
+			}
+			if elapsed != tc.ExpectElapsed {
+				t.Errorf("expected %v elapsed, got %v", tc.ExpectElapsed, elapsed)
+			}
+			if ready != tc.ExpectReady {
+				t.Errorf("expected ready to be %v, got %v", tc.ExpectReady, ready)
+			}
+		})
+	}
+}
+
+// fakeInspect replaces the docker commands for the duration of a test with
+// docker inspect of a container created on networkMode and connected to
+// networks, a map of network names to IP addresses
+func fakeInspect(t *testing.T, networkMode string, networks map[string]string) {
+	realCmder := exec.DefaultCmder
+	t.Cleanup(func() { exec.DefaultCmder = realCmder })
+	exec.DefaultCmder = &inspectCmder{networkMode: networkMode, networks: networks}
+}
+
+type inspectCmder struct {
+	networkMode string
+	networks    map[string]string
+}
+
+func (c *inspectCmder) Command(name string, args ...string) exec.Cmd {
+	output := ""
+	if format := args[len(args)-2]; format == "{{.HostConfig.NetworkMode}}" {
+		output = c.networkMode
+	} else {
+		for network, ip := range c.networks {
+			if strings.Contains(format, fmt.Sprintf("%q", network)) {
+				output = ip
+			}
+		}
+	}
+	return &inspectCmd{output: output}
+}
+
+type inspectCmd struct {
+	output string
+	stdout io.Writer
+}
+
+func (c *inspectCmd) Run() error {
+	_, err := fmt.Fprintln(c.stdout, c.output)
+	return err
+}
+func (c *inspectCmd) SetEnv(...string) exec.Cmd      { return c }
+func (c *inspectCmd) SetStdin(io.Reader) exec.Cmd    { return c }
+func (c *inspectCmd) SetStdout(w io.Writer) exec.Cmd { c.stdout = w; return c }
+func (c *inspectCmd) SetStderr(w io.Writer) exec.Cmd { return c }
+
+func TestNodeIP(t *testing.T) {
+	cases := []struct {
+		TestName    string
+		NetworkMode string
+		Networks    map[string]string
+		ExpectIP    string
+		ExpectError bool
+	}{
+		{
+			TestName:    "Default bridge network",
+			NetworkMode: "default",
+			Networks:    map[string]string{"bridge": "172.17.0.2"},
+			ExpectIP:    "172.17.0.2",
+		},
+		{
+			TestName:    "Dedicated network",
+			NetworkMode: "kind",
+			Networks:    map[string]string{"kind": "172.18.0.2"},
+			ExpectIP:    "172.18.0.2",
+		},
+		{
+			TestName:    "Connected to more networks",
+			NetworkMode: "kind",
+			Networks:    map[string]string{"kind": "172.18.0.2", "kind-macvlan": "192.168.1.10"},
+			ExpectIP:    "172.18.0.2",
+		},
+		{
+			TestName:    "Not on the network it was created on",
+			NetworkMode: "kind",
+			Networks:    map[string]string{"kind-macvlan": "192.168.1.10"},
+			ExpectError: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.TestName, func(t *testing.T) {
+			fakeInspect(t, tc.NetworkMode, tc.Networks)
+			ip, err := FromName("kind-control-plane").IP()
+			if tc.ExpectError {
+				if err == nil {
+					t.Errorf("expected an error, got IP %s", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ip != tc.ExpectIP {
+				t.Errorf("expected IP %s, got %s", tc.ExpectIP, ip)
+			}
+		})
+	}
+}
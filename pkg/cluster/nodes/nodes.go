@@ -24,6 +24,7 @@ import (
 	"github.com/pkg/errors"
 	"sigs.k8s.io/kind/pkg/cluster/constants"
 
+	"sigs.k8s.io/kind/pkg/container/docker"
 	"sigs.k8s.io/kind/pkg/exec"
 )
 
@@ -36,8 +37,7 @@ func Delete(nodes ...Node) error {
 	for _, node := range nodes {
 		ids = append(ids, node.name)
 	}
-	cmd := exec.Command(
-		"docker",
+	cmd := docker.Command(
 		append(
 			[]string{
 				"rm",
@@ -84,7 +84,7 @@ func list(visit func(string, *Node), filters ...string) error {
 	for _, filter := range filters {
 		args = append(args, "--filter", filter)
 	}
-	cmd := exec.Command("docker", args...)
+	cmd := docker.Command(args...)
 	lines, err := exec.CombinedOutputLines(cmd)
 	if err != nil {
 		return errors.Wrap(err, "failed to list nodes")
@@ -95,7 +95,11 @@ func list(visit func(string, *Node), filters ...string) error {
 			return errors.Errorf("invalid output when listing nodes: %s", line)
 		}
 		names := strings.Split(parts[0], ",")
-		cluster := parts[1]
+		cluster, err := unescapeLabelValue(parts[1])
+		if err != nil {
+			// not created by NewClusterLabel, use the value as is
+			cluster = parts[1]
+		}
 		visit(cluster, FromName(names[0]))
 	}
 	return nil
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// the systemd manager drop-in setting the default environment of units
+const systemdEnvPath = "/etc/systemd/system.conf.d/kind-env.conf"
+
+// writeSystemdEnv writes a systemd manager drop-in setting env as the
+// default environment of every unit, this must be called before the node
+// boots into systemd
+func (n *Node) writeSystemdEnv(env map[string]string) error {
+	assignments := []string{}
+	for _, name := range sortedKeys(env) {
+		assignments = append(assignments, quoteSystemdEnv(name, env[name]))
+	}
+	contents := "[Manager]\nDefaultEnvironment=" + strings.Join(assignments, " ") + "\n"
+	if err := n.WriteFile(systemdEnvPath, contents); err != nil {
+		return errors.Wrap(err, "failed to write systemd environment drop-in")
+	}
+	return nil
+}
+
+// quoteSystemdEnv returns name=value double quoted for a systemd
+// configuration file
+func quoteSystemdEnv(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return fmt.Sprintf(`"%s=%s"`, name, value)
+}
+
+// sortedKeys returns the keys of m in order, for stable output
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -65,3 +65,44 @@ func (m *Mount) UnmarshalJSON(data []byte) error {
 	}
 	return nil
 }
+
+// MarshalJSON implements custom encoding for JSON and Yaml
+// https://golang.org/pkg/encoding/json/
+func (p *PortMapping) MarshalJSON() ([]byte, error) {
+	type Alias PortMapping
+	name, ok := PortMappingProtocolValueToName[p.Protocol]
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol value: %v", p.Protocol)
+	}
+	return json.Marshal(&struct {
+		Protocol string `json:"protocol"`
+		*Alias
+	}{
+		Protocol: name,
+		Alias:    (*Alias)(p),
+	})
+}
+
+// UnmarshalJSON implements custom decoding for JSON and Yaml
+// https://golang.org/pkg/encoding/json/
+func (p *PortMapping) UnmarshalJSON(data []byte) error {
+	type Alias PortMapping
+	aux := &struct {
+		Protocol string `json:"protocol"`
+		*Alias
+	}{
+		Alias: (*Alias)(p),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	// if unset, will fallback to the default (0)
+	if aux.Protocol != "" {
+		val, ok := PortMappingProtocolNameToValue[aux.Protocol]
+		if !ok {
+			return fmt.Errorf("unknown protocol value: %s", aux.Protocol)
+		}
+		p.Protocol = PortMappingProtocol(val)
+	}
+	return nil
+}
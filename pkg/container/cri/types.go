@@ -81,3 +81,46 @@ var MountPropagationNameToValue = map[string]MountPropagation{
 	"HostToContainer": MountPropagationHostToContainer,
 	"Bidirectional":   MountPropagationBidirectional,
 }
+
+// PortMapping specifies a host port mapped into a container port.
+// In yaml this looks like:
+//  containerPort: 80
+//  hostPort: 8080
+//  hostIP: 127.0.0.1
+//  protocol: TCP
+// Protocol may be one of: TCP, UDP
+type PortMapping struct {
+	// Protocol of the port mapping.
+	Protocol PortMappingProtocol `protobuf:"varint,1,opt,name=protocol,proto3,enum=runtime.v1alpha2.Protocol" json:"protocol,omitempty"`
+	// Port number within the container.
+	ContainerPort int32 `protobuf:"varint,2,opt,name=container_port,json=containerPort,proto3" json:"containerPort,omitempty"`
+	// Port number on the host. If unset a random port is used.
+	HostPort int32 `protobuf:"varint,3,opt,name=host_port,json=hostPort,proto3" json:"hostPort,omitempty"`
+	// Host IP to bind the port on. If unset every host IP is used.
+	HostIP string `protobuf:"bytes,4,opt,name=host_ip,json=hostIp,proto3" json:"hostIP,omitempty"`
+}
+
+// PortMappingProtocol represents an "enum" for port mapping protocols,
+// see also PortMapping.
+type PortMappingProtocol int32
+
+const (
+	// PortMappingProtocolTCP specifies TCP protocol
+	PortMappingProtocolTCP PortMappingProtocol = 0
+	// PortMappingProtocolUDP specifies UDP protocol
+	PortMappingProtocolUDP PortMappingProtocol = 1
+)
+
+// PortMappingProtocolValueToName is a map of valid PortMappingProtocol
+// values to their string names
+var PortMappingProtocolValueToName = map[PortMappingProtocol]string{
+	PortMappingProtocolTCP: "TCP",
+	PortMappingProtocolUDP: "UDP",
+}
+
+// PortMappingProtocolNameToValue is a map of valid PortMappingProtocol names
+// to their values
+var PortMappingProtocolNameToValue = map[string]PortMappingProtocol{
+	"TCP": PortMappingProtocolTCP,
+	"UDP": PortMappingProtocolUDP,
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// APIVersionEnv is the environment variable the docker client reads to
+// pin the API version instead of negotiating it with the daemon
+const APIVersionEnv = "DOCKER_API_VERSION"
+
+// docker API versions are of the form major.minor, eg 1.39
+var apiVersionRE = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// ValidateAPIVersion returns an error if version is not a docker API version
+func ValidateAPIVersion(version string) error {
+	if !apiVersionRE.MatchString(version) {
+		return errors.Errorf("invalid docker API version %q, expected a version like 1.39", version)
+	}
+	return nil
+}
+
+var (
+	apiVersionMu sync.RWMutex
+	// apiVersion is the docker API version pinned with SetAPIVersion
+	apiVersion string
+)
+
+// SetAPIVersion pins the docker API version used by the docker commands
+// subsequently created with Command. The environment of this process is left
+// unchanged, APIVersionEnv is only set for the docker commands.
+func SetAPIVersion(version string) error {
+	if err := ValidateAPIVersion(version); err != nil {
+		return err
+	}
+	apiVersionMu.Lock()
+	defer apiVersionMu.Unlock()
+	apiVersion = version
+	return nil
+}
+
+// Command returns a docker command with args, using the docker API version
+// pinned with SetAPIVersion if any
+func Command(args ...string) exec.Cmd {
+	cmd := exec.Command("docker", args...)
+	apiVersionMu.RLock()
+	version := apiVersion
+	apiVersionMu.RUnlock()
+	if version != "" {
+		cmd.SetEnv(append(os.Environ(), APIVersionEnv+"="+version)...)
+	}
+	return cmd
+}
+
+// wrapAPIVersionError points at the API version setting if output looks
+// like the docker client and daemon failed to agree on an API version
+func wrapAPIVersionError(err error, output []string) error {
+	for _, line := range output {
+		if strings.Contains(line, "API version") {
+			return errors.Wrapf(err,
+				"docker client and daemon API versions are incompatible, pin a version supported by the daemon with the DockerAPIVersion option or the --docker-api-version flag",
+			)
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+func TestSetAPIVersion(t *testing.T) {
+	t.Setenv(APIVersionEnv, "")
+	defer func() { apiVersion = "" }()
+
+	if err := SetAPIVersion("latest"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+	if err := SetAPIVersion("1.39"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version := os.Getenv(APIVersionEnv); version != "" {
+		t.Errorf("expected the environment of the process to be unchanged, got %s=%s", APIVersionEnv, version)
+	}
+	cmd, ok := Command("ps").(*exec.LocalCmd)
+	if !ok {
+		t.Fatal("expected a local command")
+	}
+	found := false
+	for _, env := range cmd.Env {
+		if env == APIVersionEnv+"=1.39" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the docker command to set %s=1.39, got %v", APIVersionEnv, cmd.Env)
+	}
+}
+
+func TestWrapAPIVersionError(t *testing.T) {
+	err := errors.New("exit status 1")
+	wrapped := wrapAPIVersionError(err, []string{"Error response from daemon: client version 1.41 is too new. Maximum supported API version is 1.39"})
+	if !strings.Contains(wrapped.Error(), "--docker-api-version") {
+		t.Errorf("expected the error to point at the API version flag, got: %v", wrapped)
+	}
+	if wrapped := wrapAPIVersionError(err, []string{"no such image"}); wrapped != err {
+		t.Errorf("expected other errors to be unchanged, got: %v", wrapped)
+	}
+}
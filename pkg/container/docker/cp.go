@@ -16,14 +16,10 @@ limitations under the License.
 
 package docker
 
-import (
-	"sigs.k8s.io/kind/pkg/exec"
-)
-
 // CopyTo copies the file at hostPath to the container at destPath
 func CopyTo(hostPath, containerNameOrID, destPath string) error {
-	cmd := exec.Command(
-		"docker", "cp",
+	cmd := Command(
+		"cp",
 		hostPath,                       // from the source file
 		containerNameOrID+":"+destPath, // to the node, at dest
 	)
@@ -32,8 +28,8 @@ func CopyTo(hostPath, containerNameOrID, destPath string) error {
 
 // CopyFrom copies the file or dir in the container at srcPath to the host at hostPath
 func CopyFrom(containerNameOrID, srcPath, hostPath string) error {
-	cmd := exec.Command(
-		"docker", "cp",
+	cmd := Command(
+		"cp",
 		containerNameOrID+":"+srcPath, // from the node, at src
 		hostPath,                      // to the host
 	)
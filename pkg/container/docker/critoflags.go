@@ -71,3 +71,43 @@ func generateMountBindings(mounts ...cri.Mount) []string {
 	}
 	return result
 }
+
+// generatePortMappings converts the port mappings to docker --publish flags,
+// binding the host port on every host IP unless HostIP is set, and a random
+// host port unless HostPort is set
+func generatePortMappings(portMappings ...cri.PortMapping) []string {
+	result := make([]string, 0, len(portMappings))
+	for _, pm := range portMappings {
+		var protocol string
+		switch pm.Protocol {
+		case cri.PortMappingProtocolTCP:
+			protocol = "tcp"
+		case cri.PortMappingProtocolUDP:
+			protocol = "udp"
+		default:
+			log.Warningf("unknown protocol for container port %d", pm.ContainerPort)
+			// Falls back to tcp
+			protocol = "tcp"
+		}
+		// [hostIP:][hostPort:]containerPort/protocol, with an empty host port
+		// if only the host IP is set
+		publish := fmt.Sprintf("%d/%s", pm.ContainerPort, protocol)
+		if pm.HostPort != 0 || pm.HostIP != "" {
+			hostPort := ""
+			if pm.HostPort != 0 {
+				hostPort = fmt.Sprintf("%d", pm.HostPort)
+			}
+			publish = hostPort + ":" + publish
+		}
+		if pm.HostIP != "" {
+			// IPv6 addresses must be bracketed to be told apart from the ports
+			hostIP := pm.HostIP
+			if strings.Contains(hostIP, ":") {
+				hostIP = "[" + hostIP + "]"
+			}
+			publish = hostIP + ":" + publish
+		}
+		result = append(result, fmt.Sprintf("--publish=%s", publish))
+	}
+	return result
+}
@@ -87,7 +87,7 @@ func (c *containerCmd) Run() error {
 		// finally, with the caller args
 		c.args...,
 	)
-	cmd := exec.Command("docker", args...)
+	cmd := Command(args...)
 	if c.stdin != nil {
 		cmd.SetStdin(c.stdin)
 	}
@@ -22,7 +22,7 @@ import (
 
 // Inspect return low-level information on containers
 func Inspect(containerNameOrID, format string) ([]string, error) {
-	cmd := exec.Command("docker", "inspect",
+	cmd := Command("inspect",
 		"-f", format,
 		containerNameOrID, // ... against the "node" container
 	)
@@ -0,0 +1,32 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"strconv"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// LogsTail returns the last lines of the container's logs
+func LogsTail(containerNameOrID string, lines int) ([]string, error) {
+	cmd := Command("logs",
+		"--tail", strconv.Itoa(lines),
+		containerNameOrID,
+	)
+	return exec.CombinedOutputLines(cmd)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// the subset of `docker manifest inspect -v` output we need
+type verboseManifest struct {
+	Descriptor struct {
+		Platform *struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	}
+	SchemaV2Manifest *imageManifest
+	OCIManifest      *imageManifest
+}
+
+type imageManifest struct {
+	Config ManifestLayer   `json:"config"`
+	Layers []ManifestLayer `json:"layers"`
+}
+
+// ManifestLayer is a blob of an image manifest, the image config or a layer
+type ManifestLayer struct {
+	Digest string `json:"digest"`
+	// Size is the compressed size of the blob as it is downloaded
+	Size int64 `json:"size"`
+}
+
+// ManifestLayers returns the config and layers of the image for the os/arch
+// platform, as reported by the registry's image manifest. If configFile is
+// set the registry is queried with the credentials in that docker
+// config.json, like PullWithConfig.
+func ManifestLayers(image, configFile, os, arch string) ([]ManifestLayer, error) {
+	var buff bytes.Buffer
+	inspect := func(args ...string) error {
+		cmd := Command(append(args, "manifest", "inspect", "-v", image)...)
+		cmd.SetStdout(&buff)
+		return cmd.Run()
+	}
+	var err error
+	if configFile == "" {
+		err = inspect()
+	} else {
+		err = withConfigDir(configFile, func(configDir string) error {
+			return inspect("--config", configDir)
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect manifest for image %s", image)
+	}
+
+	// manifest lists are an array of manifests, one per platform
+	manifests := []verboseManifest{}
+	if err := json.Unmarshal(buff.Bytes(), &manifests); err != nil {
+		manifest := verboseManifest{}
+		if err := json.Unmarshal(buff.Bytes(), &manifest); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse manifest for image %s", image)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	for _, m := range manifests {
+		platform := m.Descriptor.Platform
+		if len(manifests) > 1 && (platform == nil || platform.OS != os || platform.Architecture != arch) {
+			continue
+		}
+		manifest := m.SchemaV2Manifest
+		if manifest == nil {
+			manifest = m.OCIManifest
+		}
+		if manifest == nil {
+			return nil, errors.Errorf("unsupported manifest type for image %s", image)
+		}
+		return append([]ManifestLayer{manifest.Config}, manifest.Layers...), nil
+	}
+	return nil, errors.Errorf("no manifest for platform %s/%s for image %s", os, arch, image)
+}
+
+// LocalLayers returns the digests of the layers of all images present
+// locally, as listed by docker image inspect
+// NOTE: docker identifies local layers by the digest of their uncompressed
+// content, while registries usually list the digest of the compressed layer
+func LocalLayers() ([]string, error) {
+	ids, err := exec.CombinedOutputLines(Command("image", "ls", "--quiet", "--no-trunc"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list local images")
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	lines, err := exec.CombinedOutputLines(Command(append(
+		[]string{"image", "inspect", "-f", "{{range .RootFS.Layers}}{{println .}}{{end}}"}, ids...,
+	)...))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to inspect local images")
+	}
+	layers := []string{}
+	for _, line := range lines {
+		if line != "" {
+			layers = append(layers, line)
+		}
+	}
+	return layers, nil
+}
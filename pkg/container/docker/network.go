@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// NetworkExists returns true if a docker network called name exists
+func NetworkExists(name string) bool {
+	return Command("network", "inspect", name).Run() == nil
+}
+
+// CreateNetwork creates a bridge docker network called name
+func CreateNetwork(name string, labels ...string) error {
+	args := []string{"network", "create", "--driver", "bridge"}
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	args = append(args, name)
+	if err := exec.RunLoggingOutputOnFail(Command(args...)); err != nil {
+		return errors.Wrapf(err, "failed to create network %s", name)
+	}
+	return nil
+}
+
+// CreateIPv6Network creates a bridge docker network called name with IPv6
+// enabled, with IPv6 addresses allocated by docker from subnet
+func CreateIPv6Network(name, subnet string, labels ...string) error {
+	args := []string{
+		"network", "create",
+		"--driver", "bridge",
+		"--ipv6",
+		"--subnet", subnet,
+	}
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	args = append(args, name)
+	if err := exec.RunLoggingOutputOnFail(Command(args...)); err != nil {
+		return errors.Wrapf(err, "failed to create IPv6 network %s", name)
+	}
+	return nil
+}
+
+// NetworkIPv6Enabled returns true if the docker network called name has
+// IPv6 enabled
+func NetworkIPv6Enabled(name string) (bool, error) {
+	cmd := Command("network", "inspect", "-f", "{{.EnableIPv6}}", name)
+	lines, err := exec.CombinedOutputLines(cmd)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to inspect network %s", name)
+	}
+	if len(lines) != 1 {
+		return false, errors.Errorf("network %s IPv6 setting should only be one line, got %d lines", name, len(lines))
+	}
+	return lines[0] == "true", nil
+}
+
+// NetworkContainers returns the names of the containers connected to the
+// docker network called name
+func NetworkContainers(name string) ([]string, error) {
+	cmd := Command(
+		"network", "inspect",
+		"-f", "{{range .Containers}}{{.Name}} {{end}}",
+		name,
+	)
+	lines, err := exec.CombinedOutputLines(cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect network %s", name)
+	}
+	return strings.Fields(strings.Join(lines, " ")), nil
+}
+
+// DeleteNetwork deletes the docker network called name
+func DeleteNetwork(name string) error {
+	if err := exec.RunLoggingOutputOnFail(Command("network", "rm", name)); err != nil {
+		return errors.Wrapf(err, "failed to delete network %s", name)
+	}
+	return nil
+}
+
+// CreateMacvlanNetwork creates a macvlan docker network called name on the
+// host interface parent, with IPs allocated by docker from subnet
+func CreateMacvlanNetwork(name, parent, subnet, gateway string, labels ...string) error {
+	args := []string{
+		"network", "create",
+		"--driver", "macvlan",
+		"--opt", "parent=" + parent,
+		"--subnet", subnet,
+	}
+	if gateway != "" {
+		args = append(args, "--gateway", gateway)
+	}
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+	args = append(args, name)
+	if err := exec.RunLoggingOutputOnFail(Command(args...)); err != nil {
+		return errors.Wrapf(err, "failed to create macvlan network %s", name)
+	}
+	return nil
+}
+
+// ConnectNetwork connects the container to the docker network
+func ConnectNetwork(network, containerNameOrID string) error {
+	cmd := Command("network", "connect", network, containerNameOrID)
+	if err := exec.RunLoggingOutputOnFail(cmd); err != nil {
+		return errors.Wrapf(err, "failed to connect %s to network %s", containerNameOrID, network)
+	}
+	return nil
+}
+
+// DeleteNetworks deletes the docker networks matching the docker network ls
+// filters, networks still in use are not deleted
+func DeleteNetworks(filters ...string) error {
+	args := []string{"network", "ls", "-q"}
+	for _, filter := range filters {
+		args = append(args, "--filter", filter)
+	}
+	ids, err := exec.CombinedOutputLines(Command(args...))
+	if err != nil {
+		return errors.Wrap(err, "failed to list networks")
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return Command(append([]string{"network", "rm"}, ids...)...).Run()
+}
@@ -20,8 +20,6 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-
-	"sigs.k8s.io/kind/pkg/exec"
 )
 
 // PullIfNotPresent will pull an image if it is not present locally
@@ -31,7 +29,7 @@ func PullIfNotPresent(image string, retries int) (pulled bool, err error) {
 	// TODO(bentheelder): switch most (all) of the logging here to debug level
 	// once we have configurable log levels
 	// if this did not return an error, then the image exists locally
-	cmd := exec.Command("docker", "inspect", "--type=image", image)
+	cmd := Command("inspect", "--type=image", image)
 	if err := cmd.Run(); err == nil {
 		log.Infof("Image: %s present locally", image)
 		return false, nil
@@ -43,14 +41,14 @@ func PullIfNotPresent(image string, retries int) (pulled bool, err error) {
 // Pull pulls an image, retrying up to retries times
 func Pull(image string, retries int) error {
 	log.Infof("Pulling image: %s ...", image)
-	err := exec.Command("docker", "pull", image).Run()
+	err := Command("pull", image).Run()
 	// retry pulling up to retries times if necessary
 	if err != nil {
 		for i := 0; i < retries; i++ {
 			time.Sleep(time.Second * time.Duration(i+1))
 			log.WithError(err).Infof("Trying again to pull image: %s ...", image)
 			// TODO(bentheelder): add some backoff / sleep?
-			err = exec.Command("docker", "pull", image).Run()
+			err = Command("pull", image).Run()
 			if err == nil {
 				break
 			}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/kind/pkg/fs"
+)
+
+// ValidatePullConfig checks that configFile is a docker config.json
+// NOTE: errors never include the file content, which contains credentials
+func ValidatePullConfig(configFile string) error {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return errors.Errorf("failed to read docker config %s", configFile)
+	}
+	var config struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return errors.Errorf("failed to parse docker config %s", configFile)
+	}
+	return nil
+}
+
+// PullWithConfigIfNotPresent is like PullIfNotPresent, but pulls using
+// PullWithConfig
+func PullWithConfigIfNotPresent(image, configFile string, retries int) (pulled bool, err error) {
+	cmd := Command("inspect", "--type=image", image)
+	if err := cmd.Run(); err == nil {
+		log.Infof("Image: %s present locally", image)
+		return false, nil
+	}
+	return true, PullWithConfig(image, configFile, retries)
+}
+
+// PullWithConfig is like Pull, but uses the credentials in the docker
+// config.json configFile instead of the default docker config
+func PullWithConfig(image, configFile string, retries int) error {
+	return withConfigDir(configFile, func(configDir string) error {
+		log.Infof("Pulling image: %s with credentials from %s ...", image, configFile)
+		pull := func() error {
+			return Command("--config", configDir, "pull", image).Run()
+		}
+		err := pull()
+		for i := 0; err != nil && i < retries; i++ {
+			time.Sleep(time.Second * time.Duration(i+1))
+			log.WithError(err).Infof("Trying again to pull image: %s ...", image)
+			err = pull()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to pull image %s", image)
+		}
+		return nil
+	})
+}
+
+// withConfigDir calls f with a temporary docker config directory holding
+// the docker config.json configFile, for docker --config
+func withConfigDir(configFile string, f func(configDir string) error) error {
+	// docker only reads config.json from the config directory
+	configDir, err := fs.TempDir("", "kind-docker-config-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(configDir)
+	if err := fs.CopyFile(configFile, filepath.Join(configDir, "config.json")); err != nil {
+		return errors.Errorf("failed to copy docker config %s", configFile)
+	}
+	return f(configDir)
+}
@@ -38,6 +38,7 @@ type runOpts struct {
 	RunArgs       []string
 	ContainerArgs []string
 	Mounts        []cri.Mount
+	PortMappings  []cri.PortMapping
 }
 
 // WithRunArgs sets the args for docker run
@@ -67,6 +68,14 @@ func WithMounts(mounts []cri.Mount) RunOpt {
 	}
 }
 
+// WithPortMappings sets the container port mappings to the host
+func WithPortMappings(portMappings []cri.PortMapping) RunOpt {
+	return func(r *runOpts) *runOpts {
+		r.PortMappings = portMappings
+		return r
+	}
+}
+
 // Run creates a container with "docker run", with some error handling
 // it will return the ID of the created container if any, even on error
 func Run(image string, opts ...RunOpt) (id string, err error) {
@@ -79,19 +88,20 @@ func Run(image string, opts ...RunOpt) (id string, err error) {
 	for _, mount := range o.Mounts {
 		runArgs = append(runArgs, generateMountBindings(mount)...)
 	}
+	runArgs = append(runArgs, generatePortMappings(o.PortMappings...)...)
 	// construct the actual docker run argv
 	args := []string{"run"}
 	args = append(args, runArgs...)
 	args = append(args, image)
 	args = append(args, o.ContainerArgs...)
-	cmd := exec.Command("docker", args...)
+	cmd := Command(args...)
 	output, err := exec.CombinedOutputLines(cmd)
 	if err != nil {
 		// log error output if there was any
 		for _, line := range output {
 			log.Error(line)
 		}
-		return "", err
+		return "", wrapAPIVersionError(err, output)
 	}
 	// if docker created a container the id will be the first line and match
 	// validate the output and get the id
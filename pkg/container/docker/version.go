@@ -0,0 +1,37 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"sigs.k8s.io/kind/pkg/exec"
+)
+
+// ServerVersion returns the version of the docker daemon
+func ServerVersion() (*version.Version, error) {
+	cmd := Command("version", "--format", "{{.Server.Version}}")
+	lines, err := exec.CombinedOutputLines(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get docker server version")
+	}
+	if len(lines) != 1 {
+		return nil, errors.Errorf("docker server version should only be one line, got %d lines", len(lines))
+	}
+	return version.ParseGeneric(lines[0])
+}
@@ -46,10 +46,9 @@ type Cmder interface {
 
 // DefaultCmder is a LocalCmder instance used for convienience, packages
 // originally using os/exec.Command can instead use pkg/kind/exec.Command
-// which forwards to this instance
-// TODO(bentheelder): swap this for testing
+// which forwards to this instance, tests may swap it for a fake Cmder
 // TODO(bentheelder): consider not using a global for this :^)
-var DefaultCmder = &LocalCmder{}
+var DefaultCmder Cmder = &LocalCmder{}
 
 // Command is a convience wrapper over DefaultCmder.Command
 func Command(command string, args ...string) Cmd {
@@ -113,6 +113,21 @@ func (s *Status) Start(status string) {
 	}
 }
 
+// Update changes the message of the current status without ending it, to
+// report progress. Without a terminal the new message is printed on its own
+// line.
+func (s *Status) Update(status string) {
+	if s.status == "" {
+		return
+	}
+	s.status = status
+	if IsTerminal(s.writer) {
+		s.spinner.SetSuffix(fmt.Sprintf(" %s ", s.status))
+	} else {
+		fmt.Fprintf(s.writer, " • %s  ...\n", s.status)
+	}
+}
+
 // End completes the current status, ending any previous spinning and
 // marking the status as success or failure
 func (s *Status) End(success bool) {